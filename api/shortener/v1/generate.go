@@ -0,0 +1,5 @@
+// Package shortenerv1 holds the gRPC API of the shortener, the Go code
+// is generated from shortener.proto.
+package shortenerv1
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative shortener.proto
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	fs "github.com/MomsEngineer/urlshortener/internal/adapters/storage/file_storage"
+)
+
+// compactor rewrites the storage file of a stopped shortener without
+// superseded entries.
+func main() {
+	path := flag.String("f", "/tmp/short-url-db.json", "The path to storage file")
+	flag.Parse()
+
+	if err := fs.Compact(*path); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to compact", *path+":", err)
+		os.Exit(1)
+	}
+}
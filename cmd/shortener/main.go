@@ -1,23 +1,157 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
 	"github.com/MomsEngineer/urlshortener/internal/adapters/config"
+	"github.com/MomsEngineer/urlshortener/internal/adapters/grpcapi"
+	"github.com/MomsEngineer/urlshortener/internal/adapters/health"
+	"github.com/MomsEngineer/urlshortener/internal/adapters/logger"
+	"github.com/MomsEngineer/urlshortener/internal/adapters/metrics"
+	"github.com/MomsEngineer/urlshortener/internal/adapters/ratelimit"
+	"github.com/MomsEngineer/urlshortener/internal/adapters/tracing"
 	"github.com/MomsEngineer/urlshortener/internal/adapters/web"
+	"github.com/MomsEngineer/urlshortener/internal/adapters/web/cookie"
 	"github.com/MomsEngineer/urlshortener/internal/usecases/storage"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 )
 
 func main() {
-	cfg := config.NewConfig()
+	os.Exit(run())
+}
+
+// run serves until SIGINT or SIGTERM and returns the exit code, it is
+// non-zero if the service failed to start or to stop cleanly. A second
+// signal kills the process without waiting.
+func run() (code int) {
+	cfg, err := config.NewConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid config:", err)
+		return 1
+	}
+
+	log, err := logger.New(cfg.LogLevel, cfg.LogFormat)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Could not create a logger:", err)
+		return 1
+	}
+	defer log.Sync()
+
+	ctx := logger.NewContext(context.Background(), log)
+	log.Info(ctx, "Effective config:\n"+cfg.String())
+
+	shutdownTracing, err := tracing.Setup(ctx, cfg)
+	if err != nil {
+		log.Error(ctx, "Could not configure tracing", err)
+		return 1
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(ctx, cfg.ShutdownTimeout)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			log.Error(ctx, "Could not flush traces", err)
+			code = 1
+		}
+	}()
+
+	s, err := storage.Create(cfg, log)
+	if err != nil {
+		log.Error(ctx, "Could not create a storage", err)
+		return 1
+	}
+	defer func() {
+		if err := s.Close(); err != nil {
+			log.Error(ctx, "Could not close the storage", err)
+			code = 1
+		}
+	}()
+
+	cookies, err := cookie.New(cfg, s, log)
+	if err != nil {
+		log.Error(ctx, "Could not configure user cookies", err)
+		return 1
+	}
+	cookies.UseBanList(s)
+	cookies.UseRoles(s)
+
+	trustedSubnet, err := web.ParseTrustedSubnet(cfg.TrustedSubnet)
+	if err != nil {
+		log.Error(ctx, "Could not parse the trusted subnet", err)
+		return 1
+	}
+
+	trustedProxies, err := web.ParseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		log.Error(ctx, "Could not parse the trusted proxies", err)
+		return 1
+	}
 
-	s, err := storage.Create(cfg.DataBaseDSN, cfg.FilePath)
+	limiter, err := ratelimit.Create(cfg, log)
 	if err != nil {
-		panic("could not create a storage")
+		log.Error(ctx, "Could not configure rate limits", err)
+		return 1
 	}
-	defer s.Close()
+	defer func() {
+		if err := limiter.Close(); err != nil {
+			log.Error(ctx, "Could not close the rate limiter", err)
+			code = 1
+		}
+	}()
 
-	router := web.NewRouter()
-	web.SetupRoutes(router, s, cfg.BaseURL)
+	checker := health.NewChecker(s.HealthChecks()...)
+
+	router, err := web.NewRouter(trustedProxies)
+	if err != nil {
+		log.Error(ctx, "Could not configure the router", err)
+		return 1
+	}
+	web.SetupRoutes(router, s, cookies, cfg.BaseURL, trustedSubnet, limiter, log, checker)
+
+	if cfg.EnableHTTPS && cfg.TLSCertFile == "" {
+		log.Warn(ctx, "No TLS certificate configured, using a self-signed one")
+	}
+	srv, err := web.NewServer(cfg, router)
+	if err != nil {
+		log.Error(ctx, "Could not configure the server", err)
+		return 1
+	}
+
+	servers := []web.Server{web.HTTP(srv)}
+	if cfg.EnableHTTPS && cfg.HTTPRedirect != "" {
+		servers = append(servers, web.HTTP(web.NewRedirectServer(cfg)))
+	}
+	if cfg.MetricsAddress != "" {
+		servers = append(servers, web.HTTP(metrics.NewServer(cfg)))
+	}
+	if cfg.GRPCAddress != "" {
+		servers = append(servers, grpcapi.NewServer(cfg, s, cookies, trustedSubnet, trustedProxies, limiter,
+			log, srv.TLSConfig))
+	}
+
+	// On a signal readiness fails at once, the servers keep serving for
+	// the shutdown delay so load balancers notice before they drain.
+	signalCtx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	serveCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stopDraining := context.AfterFunc(signalCtx, func() {
+		stop()
+		checker.Drain()
+		log.Info(ctx, "Shutdown requested, readiness is failing", logger.Duration("delay", cfg.ShutdownDelay))
+		time.AfterFunc(cfg.ShutdownDelay, cancel)
+	})
+	defer stopDraining()
+
+	if err := web.Serve(serveCtx, cfg.ShutdownTimeout, servers...); err != nil {
+		log.Error(ctx, "Server failed", err)
+		return 1
+	}
+	log.Info(ctx, "Server stopped")
 
-	router.Run(cfg.Address)
+	return 0
 }
@@ -1,48 +1,279 @@
 package config
 
 import (
+	"errors"
 	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"time"
 
 	"github.com/caarlos0/env"
-	"github.com/gofiber/fiber/v2/log"
+	"gopkg.in/yaml.v3"
 )
 
+// Config is read from flags, env variables, a JSON or YAML file and
+// defaults, the first source setting a value wins. Keys of the file
+// are the env variable names in lower case.
 type Config struct {
-	Address     string `env:"SERVER_ADDRESS"`
-	BaseURL     string `env:"BASE_URL"`
-	FilePath    string `env:"FILE_STORAGE_PATH"`
-	DataBaseDSN string `env:"DATABASE_DSN"`
+	ConfigFile string `env:"CONFIG" yaml:"-" flag:"c"`
+
+	Address     string `env:"SERVER_ADDRESS" yaml:"server_address" flag:"a"`
+	BaseURL     string `env:"BASE_URL" yaml:"base_url" flag:"b"`
+	FilePath    string `env:"FILE_STORAGE_PATH" yaml:"file_storage_path" flag:"f"`
+	FileSync    string `env:"FILE_STORAGE_SYNC" yaml:"file_storage_sync" flag:"fsync"`
+	DataBaseDSN string `env:"DATABASE_DSN" yaml:"database_dsn" flag:"d"`
+
+	ReaperInterval time.Duration `env:"REAPER_INTERVAL" yaml:"reaper_interval" flag:"r"`
+
+	ShortCodeGenerator string `env:"SHORT_CODE_GENERATOR" yaml:"short_code_generator" flag:"g"`
+	ShortCodeLength    int    `env:"SHORT_CODE_LENGTH" yaml:"short_code_length" flag:"l"`
+
+	UniqueOriginals string `env:"UNIQUE_ORIGINALS" yaml:"unique_originals" flag:"u"`
+	StripFragments  bool   `env:"STRIP_FRAGMENTS" yaml:"strip_fragments" flag:"strip-fragments"`
+
+	IPHashKey string `env:"IP_HASH_KEY" yaml:"ip_hash_key" flag:"ip-hash-key"`
+
+	JWTKeys        string        `env:"JWT_KEYS" yaml:"jwt_keys" flag:"jwt-keys"`
+	JWTLegacyKey   string        `env:"JWT_LEGACY_KEY" yaml:"jwt_legacy_key" flag:"jwt-legacy-key"`
+	JWTIssuer      string        `env:"JWT_ISSUER" yaml:"jwt_issuer" flag:"jwt-issuer"`
+	TokenTTL       time.Duration `env:"TOKEN_TTL" yaml:"token_ttl" flag:"token-ttl"`
+	CookieDomain   string        `env:"COOKIE_DOMAIN" yaml:"cookie_domain" flag:"cookie-domain"`
+	CookieSecure   bool          `env:"COOKIE_SECURE" yaml:"cookie_secure" flag:"cookie-secure"`
+	CookieSameSite string        `env:"COOKIE_SAMESITE" yaml:"cookie_samesite" flag:"cookie-samesite"`
+
+	AdminLogins    string `env:"ADMIN_LOGINS" yaml:"admin_logins" flag:"admin-logins"`
+	TrustedSubnet  string `env:"TRUSTED_SUBNET" yaml:"trusted_subnet" flag:"t"`
+	TrustedProxies string `env:"TRUSTED_PROXIES" yaml:"trusted_proxies" flag:"trusted-proxies"`
+
+	RateLimitCreate   string `env:"RATE_LIMIT_CREATE" yaml:"rate_limit_create" flag:"rate-limit-create"`
+	RateLimitRedirect string `env:"RATE_LIMIT_REDIRECT" yaml:"rate_limit_redirect" flag:"rate-limit-redirect"`
+	RateLimitStore    string `env:"RATE_LIMIT_STORE" yaml:"rate_limit_store" flag:"rate-limit-store"`
+
+	QuotaLinks       int `env:"QUOTA_LINKS" yaml:"quota_links" flag:"quota-links"`
+	QuotaLinksPerDay int `env:"QUOTA_LINKS_PER_DAY" yaml:"quota_links_per_day" flag:"quota-links-per-day"`
+	QuotaBatchSize   int `env:"QUOTA_BATCH_SIZE" yaml:"quota_batch_size" flag:"quota-batch-size"`
+
+	ReadTimeout     time.Duration `env:"READ_TIMEOUT" yaml:"read_timeout" flag:"read-timeout"`
+	WriteTimeout    time.Duration `env:"WRITE_TIMEOUT" yaml:"write_timeout" flag:"write-timeout"`
+	IdleTimeout     time.Duration `env:"IDLE_TIMEOUT" yaml:"idle_timeout" flag:"idle-timeout"`
+	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT" yaml:"shutdown_timeout" flag:"shutdown-timeout"`
+	ShutdownDelay   time.Duration `env:"SHUTDOWN_DELAY" yaml:"shutdown_delay" flag:"shutdown-delay"`
+
+	EnableHTTPS  bool   `env:"ENABLE_HTTPS" yaml:"enable_https" flag:"s"`
+	TLSCertFile  string `env:"TLS_CERT_FILE" yaml:"tls_cert_file" flag:"tls-cert"`
+	TLSKeyFile   string `env:"TLS_KEY_FILE" yaml:"tls_key_file" flag:"tls-key"`
+	HTTPRedirect string `env:"HTTP_REDIRECT_ADDRESS" yaml:"http_redirect_address" flag:"http-redirect"`
+
+	MetricsAddress string `env:"METRICS_ADDRESS" yaml:"metrics_address" flag:"metrics-address"`
+	GRPCAddress    string `env:"GRPC_ADDRESS" yaml:"grpc_address" flag:"grpc-address"`
+
+	TraceExporter    string  `env:"TRACE_EXPORTER" yaml:"trace_exporter" flag:"trace-exporter"`
+	TraceEndpoint    string  `env:"TRACE_ENDPOINT" yaml:"trace_endpoint" flag:"trace-endpoint"`
+	TraceFile        string  `env:"TRACE_FILE" yaml:"trace_file" flag:"trace-file"`
+	TraceSampleRatio float64 `env:"TRACE_SAMPLE_RATIO" yaml:"trace_sample_ratio" flag:"trace-sample-ratio"`
+
+	LogLevel  string `env:"LOG_LEVEL" yaml:"log_level" flag:"log-level"`
+	LogFormat string `env:"LOG_FORMAT" yaml:"log_format" flag:"log-format"`
 }
 
-func NewConfig() *Config {
-	cfg := &Config{}
+func defaults() *Config {
+	return &Config{
+		Address:  "localhost:8080",
+		BaseURL:  "http://localhost:8080",
+		FilePath: "/tmp/short-url-db.json",
+		FileSync: "none",
 
-	if err := env.Parse(cfg); err != nil {
-		log.Error(err)
+		ReaperInterval: time.Minute,
+
+		ShortCodeGenerator: "random",
+		ShortCodeLength:    8,
+
+		UniqueOriginals: "global",
+
+		JWTIssuer:      "urlshortener",
+		TokenTTL:       time.Hour,
+		CookieSameSite: "lax",
+
+		RateLimitCreate:   "100/m",
+		RateLimitRedirect: "1000/m",
+		RateLimitStore:    "memory",
+
+		QuotaBatchSize: 1000,
+
+		ReadTimeout:     10 * time.Second,
+		WriteTimeout:    30 * time.Second,
+		IdleTimeout:     2 * time.Minute,
+		ShutdownTimeout: 30 * time.Second,
+
+		TraceExporter:    "none",
+		TraceSampleRatio: 1,
+
+		LogLevel:  "info",
+		LogFormat: "console",
 	}
+}
 
-	var a, b, f, d string
-	flag.StringVar(&a, "a", "localhost:8080", "HTTP server address")
-	flag.StringVar(&b, "b", "http://localhost:8080", "Base URL for shortened links")
-	flag.StringVar(&f, "f", "/tmp/short-url-db.json", "The path to storage file")
-	flag.StringVar(&d, "d", "", "The database Data Source Name")
+// NewConfig reads the config from the command line, the environment
+// and the config file, in that order of precedence, and validates it.
+func NewConfig() (*Config, error) {
+	fl := defaults()
+	defineFlags(flag.CommandLine, fl)
 	flag.Parse()
 
-	if cfg.Address == "" {
-		cfg.Address = a
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	cfg := defaults()
+	path := os.Getenv("CONFIG")
+	if set["c"] {
+		path = fl.ConfigFile
+	}
+	if path != "" {
+		if err := cfg.load(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := env.Parse(cfg); err != nil {
+		return nil, fmt.Errorf("invalid environment: %w", err)
 	}
 
-	if cfg.BaseURL == "" {
-		cfg.BaseURL = b
+	applyFlags(cfg, fl, set)
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
 	}
 
-	if cfg.FilePath == "" {
-		cfg.FilePath = f
+	return cfg, nil
+}
+
+func defineFlags(fs *flag.FlagSet, cfg *Config) {
+	fs.StringVar(&cfg.ConfigFile, "c", "", "The path to a JSON or YAML config file")
+
+	fs.StringVar(&cfg.Address, "a", cfg.Address, "HTTP server address")
+	fs.StringVar(&cfg.BaseURL, "b", cfg.BaseURL, "Base URL for shortened links")
+	fs.StringVar(&cfg.FilePath, "f", cfg.FilePath, "The path to storage file")
+	fs.StringVar(&cfg.FileSync, "fsync", cfg.FileSync,
+		"When to flush the storage file to disk: none, always or an interval like 1s")
+	fs.StringVar(&cfg.DataBaseDSN, "d", cfg.DataBaseDSN, "The database Data Source Name")
+
+	fs.DurationVar(&cfg.ReaperInterval, "r", cfg.ReaperInterval,
+		"The interval between expired links cleanups")
+
+	fs.StringVar(&cfg.ShortCodeGenerator, "g", cfg.ShortCodeGenerator,
+		"The short code generator: random, counter, hash or word")
+	fs.IntVar(&cfg.ShortCodeLength, "l", cfg.ShortCodeLength,
+		"The initial length of generated short codes")
+
+	fs.StringVar(&cfg.UniqueOriginals, "u", cfg.UniqueOriginals,
+		"Which links may not share an original URL: global or user")
+	fs.BoolVar(&cfg.StripFragments, "strip-fragments", cfg.StripFragments,
+		"Drop the #fragment of original URLs before shortening")
+
+	fs.StringVar(&cfg.IPHashKey, "ip-hash-key", cfg.IPHashKey,
+		"The secret keying the visitor IP hashes of click stats, generated and kept in the storage if empty")
+
+	fs.StringVar(&cfg.JWTKeys, "jwt-keys", cfg.JWTKeys,
+		"Comma separated kid:secret JWT keys, the first one signs new tokens, generated and kept in the storage if empty")
+	fs.StringVar(&cfg.JWTLegacyKey, "jwt-legacy-key", cfg.JWTLegacyKey,
+		"The secret of old tokens without a key id, they are accepted once and re-issued")
+	fs.StringVar(&cfg.JWTIssuer, "jwt-issuer", cfg.JWTIssuer, "The issuer of user tokens")
+	fs.DurationVar(&cfg.TokenTTL, "token-ttl", cfg.TokenTTL,
+		"The lifetime of user tokens and cookies")
+	fs.StringVar(&cfg.CookieDomain, "cookie-domain", cfg.CookieDomain, "The domain of user cookies")
+	fs.BoolVar(&cfg.CookieSecure, "cookie-secure", cfg.CookieSecure, "Send user cookies over HTTPS only")
+	fs.StringVar(&cfg.CookieSameSite, "cookie-samesite", cfg.CookieSameSite,
+		"The SameSite mode of user cookies: default, lax, strict or none")
+
+	fs.StringVar(&cfg.AdminLogins, "admin-logins", cfg.AdminLogins,
+		"Comma separated logins of accounts that always have the admin role and cannot be demoted")
+	fs.StringVar(&cfg.TrustedSubnet, "t", cfg.TrustedSubnet,
+		"The CIDR of clients allowed to read internal stats, nobody if empty")
+	fs.StringVar(&cfg.TrustedProxies, "trusted-proxies", cfg.TrustedProxies,
+		"Comma separated IPs or CIDRs of proxies whose client IP headers and gRPC x-real-ip are trusted, none if empty")
+
+	fs.StringVar(&cfg.RateLimitCreate, "rate-limit-create", cfg.RateLimitCreate,
+		"Links a user or IP may create, like 100/m, off disables the limit")
+	fs.StringVar(&cfg.RateLimitRedirect, "rate-limit-redirect", cfg.RateLimitRedirect,
+		"Redirects a user or IP may follow, like 1000/m, off disables the limit")
+	fs.StringVar(&cfg.RateLimitStore, "rate-limit-store", cfg.RateLimitStore,
+		"Where rate limits are counted: memory or postgres")
+
+	fs.IntVar(&cfg.QuotaLinks, "quota-links", cfg.QuotaLinks,
+		"Live links a user may own, 0 means no limit")
+	fs.IntVar(&cfg.QuotaLinksPerDay, "quota-links-per-day", cfg.QuotaLinksPerDay,
+		"Links a user may create per UTC day, 0 means no limit")
+	fs.IntVar(&cfg.QuotaBatchSize, "quota-batch-size", cfg.QuotaBatchSize,
+		"Links a batch may hold, 0 means no limit")
+
+	fs.DurationVar(&cfg.ReadTimeout, "read-timeout", cfg.ReadTimeout,
+		"The time to read a whole request")
+	fs.DurationVar(&cfg.WriteTimeout, "write-timeout", cfg.WriteTimeout,
+		"The time to handle a request and write the response")
+	fs.DurationVar(&cfg.IdleTimeout, "idle-timeout", cfg.IdleTimeout,
+		"How long idle keep-alive connections stay open")
+	fs.DurationVar(&cfg.ShutdownTimeout, "shutdown-timeout", cfg.ShutdownTimeout,
+		"How long in-flight requests may run after a shutdown signal")
+	fs.DurationVar(&cfg.ShutdownDelay, "shutdown-delay", cfg.ShutdownDelay,
+		"How long to keep serving with /readyz failing before draining connections")
+
+	fs.BoolVar(&cfg.EnableHTTPS, "s", cfg.EnableHTTPS,
+		"Serve HTTPS, with a self-signed certificate unless files are given")
+	fs.StringVar(&cfg.TLSCertFile, "tls-cert", cfg.TLSCertFile, "The path to the PEM certificate chain")
+	fs.StringVar(&cfg.TLSKeyFile, "tls-key", cfg.TLSKeyFile, "The path to the PEM private key")
+	fs.StringVar(&cfg.HTTPRedirect, "http-redirect", cfg.HTTPRedirect,
+		"The address of a plain HTTP listener redirecting to HTTPS, none if empty")
+
+	fs.StringVar(&cfg.MetricsAddress, "metrics-address", cfg.MetricsAddress,
+		"The private address serving Prometheus metrics, none if empty")
+	fs.StringVar(&cfg.GRPCAddress, "grpc-address", cfg.GRPCAddress,
+		"The address serving the gRPC API, none if empty")
+
+	fs.StringVar(&cfg.TraceExporter, "trace-exporter", cfg.TraceExporter,
+		"Where to export traces: none, otlp, stdout or file")
+	fs.StringVar(&cfg.TraceEndpoint, "trace-endpoint", cfg.TraceEndpoint,
+		"The OTLP/HTTP collector URL, the OTEL_EXPORTER_OTLP_* variables are used if empty")
+	fs.StringVar(&cfg.TraceFile, "trace-file", cfg.TraceFile, "The file the file exporter appends spans to")
+	fs.Float64Var(&cfg.TraceSampleRatio, "trace-sample-ratio", cfg.TraceSampleRatio,
+		"The share of new traces to sample, from 0 to 1")
+
+	fs.StringVar(&cfg.LogLevel, "log-level", cfg.LogLevel, "The initial log level: debug, info, warn or error")
+	fs.StringVar(&cfg.LogFormat, "log-format", cfg.LogFormat, "The log format: json or console")
+}
+
+// load reads the config file over the current values. JSON is parsed
+// as YAML, so both accept durations like "30s". Unknown keys are
+// rejected to catch typos.
+func (c *Config) load(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open config file: %w", err)
 	}
+	defer file.Close()
 
-	if cfg.DataBaseDSN == "" {
-		cfg.DataBaseDSN = d
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
 	}
+	c.ConfigFile = path
+
+	return nil
+}
+
+// applyFlags copies the values of the flags set on the command line,
+// the defaults of the other flags must not hide env and file values.
+func applyFlags(cfg, fl *Config, set map[string]bool) {
+	dst := reflect.ValueOf(cfg).Elem()
+	src := reflect.ValueOf(fl).Elem()
 
-	return cfg
+	for i := 0; i < dst.NumField(); i++ {
+		if set[dst.Type().Field(i).Tag.Get("flag")] {
+			dst.Field(i).Set(src.Field(i))
+		}
+	}
 }
@@ -0,0 +1,76 @@
+package config
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const redacted = "xxxxx"
+
+var dsnPassword = regexp.MustCompile(`(password\s*=\s*)('(?:[^'\\]|\\.)*'|\S+)`)
+
+// Redacted returns a copy that is safe to log, passwords and secrets
+// are masked.
+func (c Config) Redacted() Config {
+	c.DataBaseDSN = redactDSN(c.DataBaseDSN)
+	c.JWTKeys = redactKeys(c.JWTKeys)
+	if c.IPHashKey != "" {
+		c.IPHashKey = redacted
+	}
+	if c.JWTLegacyKey != "" {
+		c.JWTLegacyKey = redacted
+	}
+
+	return c
+}
+
+// String renders the redacted config as YAML.
+func (c Config) String() string {
+	out, err := yaml.Marshal(c.Redacted())
+	if err != nil {
+		return err.Error()
+	}
+
+	return string(out)
+}
+
+// redactDSN masks the password of a URL or a keyword/value DSN.
+func redactDSN(dsn string) string {
+	if strings.Contains(dsn, "://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return redacted
+		}
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redacted)
+		}
+		q := u.Query()
+		if q.Has("password") {
+			q.Set("password", redacted)
+			u.RawQuery = q.Encode()
+		}
+
+		return u.String()
+	}
+
+	return dsnPassword.ReplaceAllString(dsn, "${1}"+redacted)
+}
+
+// redactKeys keeps the key IDs, which tell which keys are configured.
+func redactKeys(keys string) string {
+	var res []string
+	for _, pair := range strings.Split(keys, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		id, _, _ := strings.Cut(pair, ":")
+		res = append(res, id+":"+redacted)
+	}
+
+	return strings.Join(res, ",")
+}
@@ -0,0 +1,235 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MomsEngineer/urlshortener/internal/entities/link"
+	"github.com/jackc/pgx/v5"
+)
+
+var rateLimitPattern = regexp.MustCompile(`^[1-9][0-9]*/[smh]$`)
+
+// Validate reports every invalid value at once, so a broken config can
+// be fixed in one go.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(name string, err error) {
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	positive := func(name string, d time.Duration) {
+		if d <= 0 {
+			check(name, fmt.Errorf("must be positive, got %s", d))
+		}
+	}
+	notNegative := func(name string, n int64) {
+		if n < 0 {
+			check(name, fmt.Errorf("must not be negative, got %d", n))
+		}
+	}
+
+	check("server address", validateAddress(c.Address))
+	check("base URL", validateBaseURL(c.BaseURL))
+	check("file storage sync", validateFileSync(c.FileSync))
+	if c.DataBaseDSN != "" {
+		if _, err := pgx.ParseConfig(c.DataBaseDSN); err != nil {
+			check("database DSN", errors.New("cannot be parsed"))
+		}
+	}
+
+	notNegative("reaper interval", int64(c.ReaperInterval))
+
+	_, err := link.NewGenerator(c.ShortCodeGenerator)
+	check("short code generator", err)
+	if c.ShortCodeLength <= 0 {
+		check("short code length", fmt.Errorf("must be positive, got %d", c.ShortCodeLength))
+	}
+	_, err = link.ParseUniqueScope(c.UniqueOriginals)
+	check("unique originals", err)
+
+	check("JWT keys", validateKeys(c.JWTKeys))
+	positive("token TTL", c.TokenTTL)
+	switch strings.ToLower(c.CookieSameSite) {
+	case "", "default", "lax", "strict", "none":
+	default:
+		check("cookie SameSite", fmt.Errorf("unknown mode %q", c.CookieSameSite))
+	}
+
+	if c.TrustedSubnet != "" {
+		_, _, err := net.ParseCIDR(strings.TrimSpace(c.TrustedSubnet))
+		check("trusted subnet", err)
+	}
+	check("trusted proxies", validateProxies(c.TrustedProxies))
+
+	check("create rate limit", validateRateLimit(c.RateLimitCreate))
+	check("redirect rate limit", validateRateLimit(c.RateLimitRedirect))
+	switch c.RateLimitStore {
+	case "memory":
+	case "postgres":
+		if c.DataBaseDSN == "" {
+			check("rate limit store", errors.New("postgres needs a database DSN"))
+		}
+	default:
+		check("rate limit store", fmt.Errorf("unknown store %q", c.RateLimitStore))
+	}
+
+	notNegative("links quota", int64(c.QuotaLinks))
+	notNegative("daily links quota", int64(c.QuotaLinksPerDay))
+	notNegative("batch size quota", int64(c.QuotaBatchSize))
+
+	notNegative("read timeout", int64(c.ReadTimeout))
+	notNegative("write timeout", int64(c.WriteTimeout))
+	notNegative("idle timeout", int64(c.IdleTimeout))
+	positive("shutdown timeout", c.ShutdownTimeout)
+	notNegative("shutdown delay", int64(c.ShutdownDelay))
+
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		check("TLS", errors.New("both the certificate and the key file are required"))
+	}
+	if c.HTTPRedirect != "" {
+		check("HTTP redirect address", validateAddress(c.HTTPRedirect))
+	}
+	if c.MetricsAddress != "" {
+		check("metrics address", validateAddress(c.MetricsAddress))
+	}
+	if c.GRPCAddress != "" {
+		check("gRPC address", validateAddress(c.GRPCAddress))
+	}
+
+	switch c.TraceExporter {
+	case "none", "otlp", "stdout":
+	case "file":
+		if c.TraceFile == "" {
+			check("trace exporter", errors.New("file needs a trace file"))
+		}
+	default:
+		check("trace exporter", fmt.Errorf("unknown exporter %q", c.TraceExporter))
+	}
+	if c.TraceEndpoint != "" {
+		check("trace endpoint", validateEndpoint(c.TraceEndpoint))
+	}
+	if c.TraceSampleRatio < 0 || c.TraceSampleRatio > 1 {
+		check("trace sample ratio", fmt.Errorf("must be from 0 to 1, got %g", c.TraceSampleRatio))
+	}
+
+	switch c.LogLevel {
+	case "debug", "info", "warn", "error":
+	default:
+		check("log level", fmt.Errorf("unknown level %q", c.LogLevel))
+	}
+	switch c.LogFormat {
+	case "json", "console":
+	default:
+		check("log format", fmt.Errorf("unknown format %q", c.LogFormat))
+	}
+
+	return errors.Join(errs...)
+}
+
+func validateAddress(address string) error {
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return fmt.Errorf("invalid port %q", port)
+	}
+
+	return nil
+}
+
+func validateBaseURL(base string) error {
+	u, err := url.Parse(base)
+	if err != nil {
+		return err
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("scheme must be http or https, got %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return errors.New("host is missing")
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return errors.New("must not have a query or a fragment")
+	}
+
+	return nil
+}
+
+func validateEndpoint(endpoint string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return err
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("scheme must be http or https, got %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return errors.New("host is missing")
+	}
+
+	return nil
+}
+
+func validateFileSync(mode string) error {
+	switch mode {
+	case "", "none", "always":
+		return nil
+	}
+
+	if d, err := time.ParseDuration(mode); err != nil || d <= 0 {
+		return fmt.Errorf("unknown mode %q", mode)
+	}
+
+	return nil
+}
+
+func validateKeys(keys string) error {
+	for _, pair := range strings.Split(keys, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		if id, secret, ok := strings.Cut(pair, ":"); !ok || id == "" || secret == "" {
+			return errors.New("use comma separated kid:secret pairs")
+		}
+	}
+
+	return nil
+}
+
+func validateRateLimit(limit string) error {
+	limit = strings.TrimSpace(limit)
+	if limit == "" || limit == "off" || rateLimitPattern.MatchString(limit) {
+		return nil
+	}
+
+	return fmt.Errorf("invalid limit %q, use a form like 100/m", limit)
+}
+
+// validateProxies accepts a comma separated list of IPs and CIDRs.
+func validateProxies(s string) error {
+	for _, proxy := range strings.Split(s, ",") {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" || net.ParseIP(proxy) != nil {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(proxy); err != nil {
+			return fmt.Errorf("%q is neither an IP nor a CIDR", proxy)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,47 @@
+package grpcapi
+
+import (
+	"errors"
+
+	"github.com/MomsEngineer/urlshortener/internal/entities/link"
+	ierrors "github.com/MomsEngineer/urlshortener/internal/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errorCodes maps the error taxonomy to gRPC codes, the first matching
+// error wins. gRPC has no Gone, a deleted or expired link is NotFound.
+var errorCodes = []struct {
+	err  error
+	code codes.Code
+}{
+	{err: ierrors.ErrInvalidURL, code: codes.InvalidArgument},
+	{err: link.ErrInvalidAlias, code: codes.InvalidArgument},
+	{err: ierrors.ErrUnauthorized, code: codes.Unauthenticated},
+	{err: ierrors.ErrNotFound, code: codes.NotFound},
+	{err: ierrors.ErrGone, code: codes.NotFound},
+	{err: ierrors.ErrForbidden, code: codes.PermissionDenied},
+	{err: ierrors.ErrAliasTaken, code: codes.AlreadyExists},
+	{err: ierrors.ErrDuplicate, code: codes.AlreadyExists},
+	{err: ierrors.ErrLinksQuota, code: codes.PermissionDenied},
+	{err: ierrors.ErrBatchQuota, code: codes.PermissionDenied},
+	{err: ierrors.ErrQuotaExceeded, code: codes.ResourceExhausted},
+	{err: ierrors.ErrRateLimited, code: codes.ResourceExhausted},
+	{err: ierrors.ErrStorageUnavailable, code: codes.Unavailable},
+}
+
+// toStatus describes err as a gRPC status, details of unknown errors
+// are hidden from the client.
+func toStatus(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	for _, c := range errorCodes {
+		if errors.Is(err, c.err) {
+			return status.Error(c.code, err.Error())
+		}
+	}
+
+	return status.Error(codes.Internal, "internal error")
+}
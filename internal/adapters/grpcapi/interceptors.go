@@ -0,0 +1,265 @@
+package grpcapi
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	shortenerv1 "github.com/MomsEngineer/urlshortener/api/shortener/v1"
+	"github.com/MomsEngineer/urlshortener/internal/adapters/logger"
+	"github.com/MomsEngineer/urlshortener/internal/adapters/ratelimit"
+	"github.com/MomsEngineer/urlshortener/internal/adapters/web/cookie"
+	ierrors "github.com/MomsEngineer/urlshortener/internal/errors"
+	"github.com/MomsEngineer/urlshortener/internal/usecases/storage"
+	"github.com/google/uuid"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+const (
+	authorizationKey = "authorization"
+	requestIDKey     = "x-request-id"
+	realIPKey        = "x-real-ip"
+)
+
+// anonymousMethods give callers without a valid token a new user, like
+// the public cookie of the HTTP API.
+var anonymousMethods = map[string]bool{
+	shortenerv1.Shortener_ShortenURL_FullMethodName:   true,
+	shortenerv1.Shortener_ShortenBatch_FullMethodName: true,
+	shortenerv1.Shortener_GetOriginal_FullMethodName:  true,
+}
+
+// trustedMethods are served to the trusted subnet instead of a user.
+var trustedMethods = map[string]bool{
+	shortenerv1.Shortener_Stats_FullMethodName: true,
+}
+
+// rateLimits are the methods limited like their HTTP routes, cost
+// tells how many tokens a call takes.
+var rateLimits = map[string]struct {
+	class ratelimit.Class
+	cost  func(req any) int
+}{
+	shortenerv1.Shortener_ShortenURL_FullMethodName:   {ratelimit.ClassCreate, oneToken},
+	shortenerv1.Shortener_ShortenBatch_FullMethodName: {ratelimit.ClassCreate, batchCost},
+	shortenerv1.Shortener_GetOriginal_FullMethodName:  {ratelimit.ClassRedirect, oneToken},
+}
+
+type userIDKey struct{}
+
+type clientIPKey struct{}
+
+func withUserID(ctx context.Context, userID string) context.Context {
+	return logger.WithUserID(context.WithValue(ctx, userIDKey{}, userID), userID)
+}
+
+func userIDFrom(ctx context.Context) string {
+	userID, _ := ctx.Value(userIDKey{}).(string)
+	return userID
+}
+
+// ClientIPInterceptor puts the address of the caller in the context.
+// The x-real-ip metadata is only believed when the peer is one of the
+// trusted proxies, anyone else could set it to any address. Unlike
+// web.TrustedSubnetMiddleware, the trusted subnet check of Stats relies
+// on this address, not on the raw metadata.
+func ClientIPInterceptor(trustedProxies []*net.IPNet) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (any, error) {
+		ip := peerIP(ctx)
+		if realIP := net.ParseIP(strings.TrimSpace(first(ctx, realIPKey))); realIP != nil &&
+			trusted(trustedProxies, net.ParseIP(ip)) {
+			ip = realIP.String()
+		}
+
+		return handler(context.WithValue(ctx, clientIPKey{}, ip), req)
+	}
+}
+
+// clientIP returns the address found by ClientIPInterceptor.
+func clientIP(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey{}).(string)
+	return ip
+}
+
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+
+	return host
+}
+
+func trusted(proxies []*net.IPNet, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, proxy := range proxies {
+		if proxy.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// LoggingInterceptor keeps the x-request-id of the caller or generates
+// one, echoes it in the header metadata and logs every call once it is
+// served. Handlers get log and the ID through the context.
+func LoggingInterceptor(log *logger.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+
+		id := first(ctx, requestIDKey)
+		if !logger.ValidRequestID(id) {
+			id = uuid.NewString()
+		}
+		grpc.SetHeader(ctx, metadata.Pairs(requestIDKey, id))
+		ctx = logger.NewContext(logger.WithRequestID(ctx, id), log)
+
+		resp, err := handler(ctx, req)
+
+		code := status.Code(err)
+		fields := []logger.Field{
+			logger.String("method", info.FullMethod),
+			logger.String("code", code.String()),
+			logger.Duration("duration", time.Since(start)),
+		}
+		if p, ok := peer.FromContext(ctx); ok {
+			fields = append(fields, logger.String("peer", p.Addr.String()))
+		}
+		if code == codes.Internal || code == codes.Unknown {
+			log.Error(ctx, "Call failed", err, fields...)
+		} else {
+			log.Info(ctx, "Call served", fields...)
+		}
+
+		return resp, err
+	}
+}
+
+// AuthInterceptor identifies the caller by the JWT of the
+// "authorization: Bearer <token>" metadata, checked like the HTTP
+// cookie. A fresh token is sent back in the header metadata, it
+// extends the session and moves it to the current signing key.
+func AuthInterceptor(cookies *cookie.Manager, trustedSubnet *net.IPNet) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (any, error) {
+		log := logger.FromContext(ctx)
+
+		if trustedMethods[info.FullMethod] {
+			ip := net.ParseIP(clientIP(ctx))
+			if trustedSubnet == nil || ip == nil || !trustedSubnet.Contains(ip) {
+				log.Debug(ctx, "Rejected untrusted client", logger.String("client_ip", clientIP(ctx)))
+				return nil, status.Error(codes.PermissionDenied, "client is not in the trusted subnet")
+			}
+			return handler(ctx, req)
+		}
+
+		claims, err := checkToken(ctx, cookies)
+		if err != nil {
+			if !anonymousMethods[info.FullMethod] {
+				log.Debug(ctx, "Invalid token", logger.Err(err))
+				return nil, status.Error(codes.Unauthenticated, "missing or invalid token")
+			}
+			log.Debug(ctx, "No valid token, issuing a new user", logger.Err(err))
+			claims = &cookie.Claims{UserID: uuid.NewString()}
+		}
+
+		if err := cookies.CheckBan(ctx, claims.UserID); err != nil {
+			return nil, toStatus(err)
+		}
+
+		token, err := cookies.IssueToken(claims)
+		if err != nil {
+			log.Error(ctx, "Failed to create a token", err)
+			return nil, status.Error(codes.Internal, "internal error")
+		}
+		grpc.SetHeader(ctx, metadata.Pairs(authorizationKey, "Bearer "+token))
+
+		ctx = withUserID(ctx, claims.UserID)
+		if claims.AccountID == "" {
+			ctx = storage.WithAnonymousIP(ctx, clientIP(ctx))
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// RateLimitInterceptor takes the tokens of the rate limited methods
+// from the buckets of the client IP and of the user, a batch takes a
+// token per link. A rejected call gets ResourceExhausted with the time
+// to wait in a RetryInfo detail.
+func RateLimitInterceptor(l *ratelimit.Limiter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (any, error) {
+		rl, ok := rateLimits[info.FullMethod]
+		if !ok || !l.Limit(rl.class).Enabled() {
+			return handler(ctx, req)
+		}
+
+		keys := []string{"ip:" + clientIP(ctx)}
+		if userID := userIDFrom(ctx); userID != "" {
+			keys = append(keys, "user:"+userID)
+		}
+
+		res := l.AllowN(ctx, rl.class, rl.cost(req), keys...)
+		if !res.Allowed {
+			st := status.New(codes.ResourceExhausted, fmt.Sprintf("%s: retry in %s",
+				ierrors.ErrRateLimited, res.RetryAfter.Round(time.Second)))
+			if detailed, err := st.WithDetails(&errdetails.RetryInfo{
+				RetryDelay: durationpb.New(res.RetryAfter)}); err == nil {
+				st = detailed
+			}
+			return nil, st.Err()
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+func oneToken(any) int {
+	return 1
+}
+
+// batchCost counts the items of a batch, an empty batch costs one
+// token and is rejected by the handler.
+func batchCost(req any) int {
+	if batch, ok := req.(*shortenerv1.ShortenBatchRequest); ok && len(batch.GetItems()) > 0 {
+		return len(batch.GetItems())
+	}
+
+	return 1
+}
+
+func checkToken(ctx context.Context, cookies *cookie.Manager) (*cookie.Claims, error) {
+	scheme, token, ok := strings.Cut(first(ctx, authorizationKey), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return nil, status.Error(codes.Unauthenticated, "no bearer token")
+	}
+
+	return cookies.CheckToken(strings.TrimSpace(token))
+}
+
+// first returns the first value of the incoming metadata key.
+func first(ctx context.Context, key string) string {
+	if values := metadata.ValueFromIncomingContext(ctx, key); len(values) > 0 {
+		return values[0]
+	}
+
+	return ""
+}
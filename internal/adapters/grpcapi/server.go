@@ -0,0 +1,82 @@
+package grpcapi
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+
+	shortenerv1 "github.com/MomsEngineer/urlshortener/api/shortener/v1"
+	"github.com/MomsEngineer/urlshortener/internal/adapters/config"
+	"github.com/MomsEngineer/urlshortener/internal/adapters/logger"
+	"github.com/MomsEngineer/urlshortener/internal/adapters/metrics"
+	"github.com/MomsEngineer/urlshortener/internal/adapters/ratelimit"
+	"github.com/MomsEngineer/urlshortener/internal/adapters/tracing"
+	"github.com/MomsEngineer/urlshortener/internal/adapters/web/cookie"
+	"github.com/MomsEngineer/urlshortener/internal/usecases/storage"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// Server serves the Shortener API on the gRPC address, it can be run
+// by web.Serve next to the HTTP servers.
+type Server struct {
+	addr string
+	grpc *grpc.Server
+}
+
+// NewServer serves s with the tracing, metrics, logging, auth and rate
+// limit interceptors, over TLS if tlsConfig is not nil. x-real-ip is
+// only taken from the trusted proxies, see ClientIPInterceptor.
+func NewServer(cfg *config.Config, s storage.StoregeInterface, cookies *cookie.Manager,
+	trustedSubnet *net.IPNet, trustedProxies []*net.IPNet, limiter *ratelimit.Limiter,
+	log *logger.Logger, tlsConfig *tls.Config) *Server {
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(
+			tracing.UnaryServerInterceptor(),
+			metrics.UnaryServerInterceptor(),
+			ClientIPInterceptor(trustedProxies),
+			LoggingInterceptor(log),
+			AuthInterceptor(cookies, trustedSubnet),
+			RateLimitInterceptor(limiter),
+		),
+	}
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	srv := grpc.NewServer(opts...)
+	shortenerv1.RegisterShortenerServer(srv, &service{storage: s, baseURL: cfg.BaseURL})
+
+	return &Server{addr: cfg.GRPCAddress, grpc: srv}
+}
+
+func (s *Server) Addr() string {
+	return s.addr
+}
+
+func (s *Server) Serve(ln net.Listener) error {
+	return s.grpc.Serve(ln)
+}
+
+// Shutdown stops accepting calls and waits for the running ones until
+// ctx is done, then cuts them off.
+func (s *Server) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.grpc.GracefulStop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.grpc.Stop()
+		return ctx.Err()
+	}
+}
+
+func (s *Server) Close() error {
+	s.grpc.Stop()
+	return nil
+}
@@ -0,0 +1,344 @@
+package grpcapi
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	shortenerv1 "github.com/MomsEngineer/urlshortener/api/shortener/v1"
+	"github.com/MomsEngineer/urlshortener/internal/adapters/config"
+	"github.com/MomsEngineer/urlshortener/internal/adapters/logger"
+	"github.com/MomsEngineer/urlshortener/internal/adapters/ratelimit"
+	"github.com/MomsEngineer/urlshortener/internal/adapters/web"
+	"github.com/MomsEngineer/urlshortener/internal/adapters/web/cookie"
+	"github.com/MomsEngineer/urlshortener/internal/usecases/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const baseURL = "http://localhost:8080"
+
+// newClient serves the API on an in-process listener backed by a map
+// storage, without rate limits.
+func newClient(t *testing.T) shortenerv1.ShortenerClient {
+	t.Helper()
+
+	return newClientWith(t, ratelimit.New(ratelimit.NewMemoryStore(), nil))
+}
+
+// newClientWith is newClient with the limiter. The peer address of
+// the client is not an IP, so it is never a trusted proxy.
+func newClientWith(t *testing.T, limiter *ratelimit.Limiter) shortenerv1.ShortenerClient {
+	t.Helper()
+
+	cfg := &config.Config{
+		BaseURL:            baseURL,
+		ShortCodeGenerator: "random",
+		ShortCodeLength:    8,
+		UniqueOriginals:    "global",
+	}
+	s, err := storage.Create(cfg, logger.NewNop())
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+
+	cookies, err := cookie.New(&config.Config{
+		JWTKeys:   "k:secret",
+		JWTIssuer: "test",
+		TokenTTL:  time.Hour,
+	}, nil, logger.NewNop())
+	require.NoError(t, err)
+
+	_, subnet, err := net.ParseCIDR("192.168.1.0/24")
+	require.NoError(t, err)
+
+	srv := NewServer(cfg, s, cookies, subnet, nil, limiter, logger.NewNop(), nil)
+	ln := bufconn.Listen(1 << 20)
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return ln.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return shortenerv1.NewShortenerClient(conn)
+}
+
+func withToken(token string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), authorizationKey, token)
+}
+
+func TestShortenAndResolve(t *testing.T) {
+	client := newClient(t)
+
+	var header metadata.MD
+	resp, err := client.ShortenURL(context.Background(),
+		&shortenerv1.ShortenURLRequest{Url: "https://example.com", TtlSeconds: 60}, grpc.Header(&header))
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(resp.GetShortUrl(), baseURL+"/"))
+	assert.False(t, resp.GetExisting())
+
+	token := header.Get(authorizationKey)
+	require.Len(t, token, 1, "an anonymous caller must get a token")
+	ctx := withToken(token[0])
+
+	again, err := client.ShortenURL(ctx, &shortenerv1.ShortenURLRequest{Url: "https://example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, resp.GetShortUrl(), again.GetShortUrl())
+	assert.True(t, again.GetExisting())
+
+	code := strings.TrimPrefix(resp.GetShortUrl(), baseURL+"/")
+	original, err := client.GetOriginal(context.Background(), &shortenerv1.GetOriginalRequest{ShortCode: code})
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com", original.GetOriginalUrl())
+
+	_, err = client.GetOriginal(ctx, &shortenerv1.GetOriginalRequest{ShortCode: "missing"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	list, err := client.ListUserURLs(ctx, &shortenerv1.ListUserURLsRequest{})
+	require.NoError(t, err)
+	require.Len(t, list.GetUrls(), 1)
+	assert.Equal(t, resp.GetShortUrl(), list.GetUrls()[0].GetShortUrl())
+
+	_, err = client.DeleteUserURLs(ctx, &shortenerv1.DeleteUserURLsRequest{ShortCodes: []string{code}})
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		_, err := client.GetOriginal(ctx, &shortenerv1.GetOriginalRequest{ShortCode: code})
+		return status.Code(err) == codes.NotFound
+	}, 5*time.Second, 50*time.Millisecond, "the deleted link must be gone")
+}
+
+func TestShortenErrors(t *testing.T) {
+	client := newClient(t)
+	ctx := context.Background()
+
+	_, err := client.ShortenURL(ctx, &shortenerv1.ShortenURLRequest{Url: "not a url"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.ShortenURL(ctx, &shortenerv1.ShortenURLRequest{
+		Url: "https://example.com", TtlSeconds: 60, ExpiresAt: timestamppb.Now()})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.ShortenURL(ctx, &shortenerv1.ShortenURLRequest{Url: "https://a.example.com", Alias: "mine"})
+	require.NoError(t, err)
+	_, err = client.ShortenURL(ctx, &shortenerv1.ShortenURLRequest{Url: "https://b.example.com", Alias: "mine"})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+}
+
+func TestShortenBatch(t *testing.T) {
+	client := newClient(t)
+	ctx := context.Background()
+
+	resp, err := client.ShortenBatch(ctx, &shortenerv1.ShortenBatchRequest{Items: []*shortenerv1.BatchItem{
+		{CorrelationId: "1", OriginalUrl: "https://one.example.com"},
+		{CorrelationId: "2", OriginalUrl: "https://two.example.com"},
+	}})
+	require.NoError(t, err)
+	require.Len(t, resp.GetResults(), 2)
+	assert.Equal(t, "2", resp.GetResults()[1].GetCorrelationId())
+	assert.True(t, strings.HasPrefix(resp.GetResults()[1].GetShortUrl(), baseURL+"/"))
+
+	_, err = client.ShortenBatch(ctx, &shortenerv1.ShortenBatchRequest{Items: []*shortenerv1.BatchItem{
+		{CorrelationId: "1", OriginalUrl: "https://three.example.com"},
+		{CorrelationId: "2", OriginalUrl: "bad"},
+	}})
+	st := status.Convert(err)
+	require.Equal(t, codes.InvalidArgument, st.Code())
+	require.Len(t, st.Details(), 1)
+	details, ok := st.Details()[0].(*errdetails.BadRequest)
+	require.True(t, ok)
+	require.Len(t, details.GetFieldViolations(), 1)
+	assert.Equal(t, "items[1].original_url", details.GetFieldViolations()[0].GetField())
+}
+
+func TestAuthInterceptor(t *testing.T) {
+	client := newClient(t)
+
+	_, err := client.ListUserURLs(context.Background(), &shortenerv1.ListUserURLsRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = client.DeleteUserURLs(withToken("Bearer forged"), &shortenerv1.DeleteUserURLsRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// A forged token on a public method gets a new user, not an error.
+	var header metadata.MD
+	_, err = client.ShortenURL(withToken("Bearer forged"),
+		&shortenerv1.ShortenURLRequest{Url: "https://example.com"}, grpc.Header(&header))
+	require.NoError(t, err)
+	assert.NotEmpty(t, header.Get(authorizationKey))
+
+	list, err := client.ListUserURLs(withToken(header.Get(authorizationKey)[0]), &shortenerv1.ListUserURLsRequest{})
+	require.NoError(t, err)
+	assert.Len(t, list.GetUrls(), 1)
+}
+
+func TestStats(t *testing.T) {
+	client := newClient(t)
+
+	_, err := client.Stats(context.Background(), &shortenerv1.StatsRequest{})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), realIPKey, "192.168.1.10")
+	_, err = client.Stats(ctx, &shortenerv1.StatsRequest{})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err),
+		"x-real-ip must only be taken from a trusted proxy")
+}
+
+// withPeer is the context of a call from addr with the incoming
+// metadata pairs.
+func withPeer(addr string, pairs ...string) context.Context {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(pairs...))
+	return peer.NewContext(ctx, &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(addr), Port: 50000}})
+}
+
+func TestClientIPInterceptor(t *testing.T) {
+	proxies, err := web.ParseTrustedProxies("10.0.0.1")
+	require.NoError(t, err)
+	interceptor := ClientIPInterceptor(proxies)
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		expected string
+	}{
+		{
+			name:     "Direct call",
+			ctx:      withPeer("203.0.113.7"),
+			expected: "203.0.113.7",
+		},
+		{
+			name:     "Real IP from an untrusted peer",
+			ctx:      withPeer("203.0.113.7", realIPKey, "192.168.1.10"),
+			expected: "203.0.113.7",
+		},
+		{
+			name:     "Real IP from a trusted proxy",
+			ctx:      withPeer("10.0.0.1", realIPKey, "192.168.1.10"),
+			expected: "192.168.1.10",
+		},
+		{
+			name:     "Invalid real IP from a trusted proxy",
+			ctx:      withPeer("10.0.0.1", realIPKey, "proxy"),
+			expected: "10.0.0.1",
+		},
+		{
+			name:     "No peer",
+			ctx:      context.Background(),
+			expected: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := interceptor(tt.ctx, nil, &grpc.UnaryServerInfo{},
+				func(ctx context.Context, _ any) (any, error) {
+					assert.Equal(t, tt.expected, clientIP(ctx))
+					return nil, nil
+				})
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestStatsFromTrustedProxy(t *testing.T) {
+	proxies, err := web.ParseTrustedProxies("10.0.0.1")
+	require.NoError(t, err)
+	_, subnet, err := net.ParseCIDR("192.168.1.0/24")
+	require.NoError(t, err)
+
+	s, err := storage.Create(&config.Config{ShortCodeGenerator: "random", ShortCodeLength: 8,
+		UniqueOriginals: "global"}, logger.NewNop())
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	_, err = s.SaveLink(context.Background(), "user", "https://example.com")
+	require.NoError(t, err)
+
+	svc := &service{storage: s, baseURL: baseURL}
+	clientIPs := ClientIPInterceptor(proxies)
+	auth := AuthInterceptor(nil, subnet)
+	info := &grpc.UnaryServerInfo{FullMethod: shortenerv1.Shortener_Stats_FullMethodName}
+	call := func(ctx context.Context) (*shortenerv1.StatsResponse, error) {
+		resp, err := clientIPs(ctx, &shortenerv1.StatsRequest{}, info,
+			func(ctx context.Context, req any) (any, error) {
+				return auth(ctx, req, info, func(ctx context.Context, req any) (any, error) {
+					return svc.Stats(ctx, req.(*shortenerv1.StatsRequest))
+				})
+			})
+		if err != nil {
+			return nil, err
+		}
+		return resp.(*shortenerv1.StatsResponse), nil
+	}
+
+	stats, err := call(withPeer("10.0.0.1", realIPKey, "192.168.1.10"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), stats.GetUrls())
+	assert.Equal(t, int64(1), stats.GetUsers())
+
+	_, err = call(withPeer("192.168.1.20"))
+	assert.NoError(t, err)
+
+	_, err = call(withPeer("10.0.0.1", realIPKey, "10.0.0.2"))
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = call(withPeer("10.0.0.2", realIPKey, "192.168.1.10"))
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestRateLimitBatch(t *testing.T) {
+	limit, err := ratelimit.ParseLimit("3/h")
+	require.NoError(t, err)
+	client := newClientWith(t, ratelimit.New(ratelimit.NewMemoryStore(),
+		map[ratelimit.Class]ratelimit.Limit{ratelimit.ClassCreate: limit}))
+	ctx := context.Background()
+
+	_, err = client.ShortenBatch(ctx, &shortenerv1.ShortenBatchRequest{Items: []*shortenerv1.BatchItem{
+		{CorrelationId: "1", OriginalUrl: "https://one.example.com"},
+		{CorrelationId: "2", OriginalUrl: "https://two.example.com"},
+	}})
+	require.NoError(t, err)
+
+	// The batch took two tokens, a batch of two doesn't fit in the last one.
+	_, err = client.ShortenBatch(ctx, &shortenerv1.ShortenBatchRequest{Items: []*shortenerv1.BatchItem{
+		{CorrelationId: "1", OriginalUrl: "https://three.example.com"},
+		{CorrelationId: "2", OriginalUrl: "https://four.example.com"},
+	}})
+	st := status.Convert(err)
+	require.Equal(t, codes.ResourceExhausted, st.Code())
+	require.Len(t, st.Details(), 1)
+	retry, ok := st.Details()[0].(*errdetails.RetryInfo)
+	require.True(t, ok)
+	assert.Positive(t, retry.GetRetryDelay().AsDuration())
+
+	_, err = client.ShortenURL(ctx, &shortenerv1.ShortenURLRequest{Url: "https://five.example.com"})
+	require.NoError(t, err)
+	_, err = client.ShortenURL(ctx, &shortenerv1.ShortenURLRequest{Url: "https://six.example.com"})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
+
+func TestLoggingInterceptorRequestID(t *testing.T) {
+	client := newClient(t)
+
+	var header metadata.MD
+	ctx := metadata.AppendToOutgoingContext(context.Background(), requestIDKey, "req-1")
+	_, err := client.ShortenURL(ctx, &shortenerv1.ShortenURLRequest{Url: "https://example.com"}, grpc.Header(&header))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"req-1"}, header.Get(requestIDKey))
+
+	_, err = client.ListUserURLs(context.Background(), &shortenerv1.ListUserURLsRequest{}, grpc.Header(&header))
+	require.Error(t, err)
+	assert.Len(t, header.Get(requestIDKey), 1, "a generated ID is echoed even on errors")
+}
@@ -0,0 +1,174 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	shortenerv1 "github.com/MomsEngineer/urlshortener/api/shortener/v1"
+	"github.com/MomsEngineer/urlshortener/internal/adapters/logger"
+	"github.com/MomsEngineer/urlshortener/internal/entities/link"
+	ierrors "github.com/MomsEngineer/urlshortener/internal/errors"
+	"github.com/MomsEngineer/urlshortener/internal/usecases/storage"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// service implements the Shortener API on the storage used by the
+// HTTP handlers, the auth interceptor puts the caller in the context.
+type service struct {
+	shortenerv1.UnimplementedShortenerServer
+	storage storage.StoregeInterface
+	baseURL string
+}
+
+func (s *service) ShortenURL(ctx context.Context,
+	req *shortenerv1.ShortenURLRequest) (*shortenerv1.ShortenURLResponse, error) {
+	expiresAt, err := parseExpiry(req.GetExpiresAt(), req.GetTtlSeconds())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	short, err := s.storage.SaveLink(ctx, userIDFrom(ctx), req.GetUrl(),
+		link.WithAlias(req.GetAlias()), link.WithExpiry(expiresAt))
+	if errors.Is(err, ierrors.ErrDuplicate) {
+		logger.FromContext(ctx).Debug(ctx, "Link already shortened", logger.String("url", req.GetUrl()))
+		return &shortenerv1.ShortenURLResponse{ShortUrl: s.baseURL + "/" + short, Existing: true}, nil
+	}
+	if errors.Is(err, ierrors.ErrAliasTaken) {
+		return nil, toStatus(fmt.Errorf("%w: %q", err, req.GetAlias()))
+	}
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &shortenerv1.ShortenURLResponse{ShortUrl: s.baseURL + "/" + short}, nil
+}
+
+// ShortenBatch rejects the whole batch if any URL is invalid, the
+// rejected items are listed in the BadRequest details of the status.
+func (s *service) ShortenBatch(ctx context.Context,
+	req *shortenerv1.ShortenBatchRequest) (*shortenerv1.ShortenBatchResponse, error) {
+	var items []*storage.BatchItem
+	for _, item := range req.GetItems() {
+		expiresAt, err := parseExpiry(item.GetExpiresAt(), item.GetTtlSeconds())
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "correlation_id %q: %v", item.GetCorrelationId(), err)
+		}
+
+		items = append(items, &storage.BatchItem{
+			CorrelationID: item.GetCorrelationId(),
+			OriginalURL:   item.GetOriginalUrl(),
+			ExpiresAt:     expiresAt,
+		})
+	}
+
+	if err := s.storage.SaveLinksBatch(ctx, userIDFrom(ctx), items); err != nil {
+		if errors.Is(err, ierrors.ErrInvalidURL) {
+			return nil, invalidItems(err, items)
+		}
+		return nil, toStatus(err)
+	}
+
+	resp := &shortenerv1.ShortenBatchResponse{}
+	for _, item := range items {
+		resp.Results = append(resp.Results, &shortenerv1.BatchResult{
+			CorrelationId: item.CorrelationID,
+			ShortUrl:      s.baseURL + "/" + item.ShortURL,
+		})
+	}
+
+	return resp, nil
+}
+
+func invalidItems(err error, items []*storage.BatchItem) error {
+	details := &errdetails.BadRequest{}
+	for i, item := range items {
+		if item.Err != nil {
+			details.FieldViolations = append(details.FieldViolations, &errdetails.BadRequest_FieldViolation{
+				Field:       fmt.Sprintf("items[%d].original_url", i),
+				Description: fmt.Sprintf("correlation_id %q: %v", item.CorrelationID, item.Err),
+			})
+		}
+	}
+
+	st, detailsErr := status.New(codes.InvalidArgument, err.Error()).WithDetails(details)
+	if detailsErr != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return st.Err()
+}
+
+// GetOriginal resolves a short code and counts it as a click, like a
+// redirect of the HTTP API.
+func (s *service) GetOriginal(ctx context.Context,
+	req *shortenerv1.GetOriginalRequest) (*shortenerv1.GetOriginalResponse, error) {
+	original, err := s.storage.GetLink(ctx, userIDFrom(ctx), req.GetShortCode())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	err = s.storage.RecordClick(ctx, req.GetShortCode(), "", first(ctx, "user-agent"), clientIP(ctx))
+	if err != nil {
+		logger.FromContext(ctx).Error(ctx, "Failed to record click", err, logger.String("code", req.GetShortCode()))
+	}
+
+	return &shortenerv1.GetOriginalResponse{OriginalUrl: original}, nil
+}
+
+func (s *service) ListUserURLs(ctx context.Context,
+	_ *shortenerv1.ListUserURLsRequest) (*shortenerv1.ListUserURLsResponse, error) {
+	links, err := s.storage.GetLinksByUser(ctx, userIDFrom(ctx))
+	if err != nil && !errors.Is(err, ierrors.ErrNoContent) {
+		return nil, toStatus(err)
+	}
+
+	resp := &shortenerv1.ListUserURLsResponse{}
+	for short, original := range links {
+		resp.Urls = append(resp.Urls, &shortenerv1.UserURL{
+			ShortUrl:    s.baseURL + "/" + short,
+			OriginalUrl: original,
+		})
+	}
+	sort.Slice(resp.Urls, func(i, j int) bool {
+		return resp.Urls[i].ShortUrl < resp.Urls[j].ShortUrl
+	})
+
+	return resp, nil
+}
+
+func (s *service) DeleteUserURLs(ctx context.Context,
+	req *shortenerv1.DeleteUserURLsRequest) (*shortenerv1.DeleteUserURLsResponse, error) {
+	if err := s.storage.DeleteLinks(ctx, userIDFrom(ctx), req.GetShortCodes()); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &shortenerv1.DeleteUserURLsResponse{}, nil
+}
+
+func (s *service) Stats(ctx context.Context, _ *shortenerv1.StatsRequest) (*shortenerv1.StatsResponse, error) {
+	stats, err := s.storage.GetStats(ctx)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &shortenerv1.StatsResponse{Urls: int64(stats.URLs), Users: int64(stats.Users)}, nil
+}
+
+func parseExpiry(expiresAt *timestamppb.Timestamp, ttlSeconds int64) (time.Time, error) {
+	var t *time.Time
+	if expiresAt != nil {
+		if err := expiresAt.CheckValid(); err != nil {
+			return time.Time{}, fmt.Errorf("invalid expires_at: %w", err)
+		}
+		at := expiresAt.AsTime()
+		t = &at
+	}
+
+	return link.ParseExpiry(t, ttlSeconds, time.Now())
+}
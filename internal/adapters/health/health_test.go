@@ -0,0 +1,54 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckerReady(t *testing.T) {
+	ok := Check{Name: "storage", Run: func(context.Context) error { return nil }}
+	failing := Check{Name: "disk", Run: func(context.Context) error { return errors.New("read-only") }}
+	slow := Check{Name: "workers", Run: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}}
+
+	report := NewChecker(ok).Ready(context.Background())
+	assert.True(t, report.OK())
+	assert.Equal(t, StatusOK, report.Checks["storage"].Status)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	report = NewChecker(ok, failing, slow).Ready(ctx)
+	assert.False(t, report.OK())
+	assert.Equal(t, StatusFailing, report.Status)
+	assert.Equal(t, StatusOK, report.Checks["storage"].Status)
+	assert.Equal(t, StatusFailing, report.Checks["disk"].Status)
+	assert.Equal(t, "read-only", report.Checks["disk"].Error)
+	assert.Equal(t, StatusFailing, report.Checks["workers"].Status)
+}
+
+func TestCheckerDrain(t *testing.T) {
+	c := NewChecker(Check{Name: "storage", Run: func(context.Context) error { return nil }})
+	c.Drain()
+
+	report := c.Ready(context.Background())
+	assert.False(t, report.OK())
+	assert.Equal(t, StatusDraining, report.Status)
+	assert.Equal(t, StatusOK, report.Checks["storage"].Status)
+}
+
+func TestCheckTimeout(t *testing.T) {
+	res := run(context.Background(), Check{Name: "hang", Run: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}}, 10*time.Millisecond)
+
+	assert.Equal(t, StatusFailing, res.Status)
+	assert.Equal(t, "timed out", res.Error)
+	assert.GreaterOrEqual(t, res.LatencyMS, 10.0)
+}
@@ -0,0 +1,65 @@
+package logger
+
+import "context"
+
+// maxRequestIDLen bounds the request IDs taken from callers.
+const maxRequestIDLen = 128
+
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	userIDKey
+	loggerKey
+)
+
+// WithRequestID returns a context whose log entries carry the request ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// ValidRequestID accepts printable ASCII IDs of a sane length, callers
+// replace anything else so clients can't inject into the logs.
+func ValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+
+	return true
+}
+
+// WithUserID returns a context whose log entries carry the user ID.
+func WithUserID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, userIDKey, id)
+}
+
+func UserID(ctx context.Context) string {
+	id, _ := ctx.Value(userIDKey).(string)
+	return id
+}
+
+// NewContext returns a context carrying l, for code that has a context
+// but no logger of its own, such as HTTP handlers.
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, loggerKey, l)
+}
+
+// FromContext returns the logger of ctx, a no-op one if there is none.
+func FromContext(ctx context.Context) *Logger {
+	if l, ok := ctx.Value(loggerKey).(*Logger); ok {
+		return l
+	}
+
+	return NewNop()
+}
@@ -1,106 +1,156 @@
 package logger
 
 import (
+	"context"
 	"fmt"
-	"path/filepath"
-	"runtime"
-	"strings"
+	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
+// Field is a typed key and value of a log entry.
+type Field = zap.Field
+
+var (
+	String   = zap.String
+	Strings  = zap.Strings
+	Int      = zap.Int
+	Int64    = zap.Int64
+	Bool     = zap.Bool
+	Duration = zap.Duration
+	Time     = zap.Time
+	Any      = zap.Any
+	Err      = zap.Error
+)
+
+// Logger writes structured entries, the request ID, the user ID and the
+// trace ID found in the context of a call are added to its entry. One
+// Logger is built at startup and handed to every component.
 type Logger struct {
-	logger *zap.Logger
+	zap   *zap.Logger
+	level zap.AtomicLevel
 }
 
-type Level int8
-
-const (
-	DebugLevel Level = iota - 1
-	InfoLevel
-	WarnLevel
-	ErrorLevel
-	DPanicLevel
-	PanicLevel
-	FatalLevel
-)
+// New builds a logger writing JSON or console entries to stderr from
+// the given level up.
+func New(level, format string) (*Logger, error) {
+	lvl, err := zap.ParseAtomicLevel(level)
+	if err != nil {
+		return nil, err
+	}
 
-func Create(level Level) Logger {
-	config := zap.NewDevelopmentConfig()
-	config.EncoderConfig.StacktraceKey = ""
-	config.Level = zap.NewAtomicLevelAt(zapcore.Level(level))
+	var config zap.Config
+	switch format {
+	case "json":
+		config = zap.NewProductionConfig()
+		config.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	case "console":
+		config = zap.NewDevelopmentConfig()
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+	config.Level = lvl
+	config.DisableStacktrace = true
+	config.Sampling = nil
 
-	logger, err := config.Build()
+	z, err := config.Build(zap.AddCallerSkip(2))
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	return Logger{
-		logger: logger,
-	}
+	return &Logger{zap: z, level: lvl}, nil
 }
 
-func (l Logger) Logger() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		start := time.Now()
+// NewNop returns a logger that drops everything, for tests.
+func NewNop() *Logger {
+	return &Logger{zap: zap.NewNop(), level: zap.NewAtomicLevel()}
+}
 
-		uri := c.Request.URL.Path
+// With returns a logger adding fields to every entry.
+func (l *Logger) With(fields ...Field) *Logger {
+	return &Logger{zap: l.zap.With(fields...), level: l.level}
+}
 
-		method := c.Request.Method
+// LevelHandler reports the level on GET and changes it on PUT with a
+// body like {"level":"debug"}, the change applies to every component.
+func (l *Logger) LevelHandler() http.Handler {
+	return l.level
+}
 
-		c.Next()
+func (l *Logger) Sync() error {
+	return l.zap.Sync()
+}
 
-		duration := time.Since(start)
+func (l *Logger) Debug(ctx context.Context, msg string, fields ...Field) {
+	l.log(ctx, zapcore.DebugLevel, msg, fields)
+}
 
-		status := c.Writer.Status()
+func (l *Logger) Info(ctx context.Context, msg string, fields ...Field) {
+	l.log(ctx, zapcore.InfoLevel, msg, fields)
+}
 
-		size := c.Writer.Size()
+func (l *Logger) Warn(ctx context.Context, msg string, fields ...Field) {
+	l.log(ctx, zapcore.WarnLevel, msg, fields)
+}
 
-		l.logger.Info("Request and Response:",
-			zap.String("url", uri),
-			zap.String("method", method),
-			zap.Duration("duration", duration),
-			zap.Int("status", status),
-			zap.Int("size", size))
+// Error logs msg with err, which may be nil.
+func (l *Logger) Error(ctx context.Context, msg string, err error, fields ...Field) {
+	if err != nil {
+		fields = append(fields, zap.Error(err))
 	}
+	l.log(ctx, zapcore.ErrorLevel, msg, fields)
 }
 
-func (l Logger) Error(msg string, err error) {
-	line, fn := getLineAndFileName()
-	t := fmt.Sprintf("line %d: %s(): %s | error: %v", line, fn, msg, err)
+func (l *Logger) log(ctx context.Context, level zapcore.Level, msg string, fields []Field) {
+	ce := l.zap.Check(level, msg)
+	if ce == nil {
+		return
+	}
 
-	l.logger.Error(t)
+	ce.Write(append(contextFields(ctx), fields...)...)
 }
 
-func (l Logger) Debug(values ...any) {
-	msg := strings.Join(convertToStringSlice(values...), " ")
-	line, fn := getLineAndFileName()
-	t := fmt.Sprintf("line %d: %s(): %s", line, fn, msg)
+func contextFields(ctx context.Context) []Field {
+	var fields []Field
+	if id := RequestID(ctx); id != "" {
+		fields = append(fields, zap.String("request_id", id))
+	}
+	if id := UserID(ctx); id != "" {
+		fields = append(fields, zap.String("user_id", id))
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		fields = append(fields, zap.String("trace_id", sc.TraceID().String()))
+	}
 
-	l.logger.Debug(t)
+	return fields
 }
 
-func (l Logger) Info(values ...any) {
-	msg := strings.Join(convertToStringSlice(values...), " ")
-	line, fn := getLineAndFileName()
-	t := fmt.Sprintf("line %d: %s(): %s", line, fn, msg)
-
-	l.logger.Info(t)
-}
+// Middleware logs every request once it is served, except requests
+// to the skipped paths such as the probes.
+func (l *Logger) Middleware(skip ...string) gin.HandlerFunc {
+	skipped := make(map[string]struct{}, len(skip))
+	for _, path := range skip {
+		skipped[path] = struct{}{}
+	}
 
-func getLineAndFileName() (int, string) {
-	pc, _, line, _ := runtime.Caller(2)
-	fn := runtime.FuncForPC(pc)
-	return line, filepath.Base(fn.Name())
-}
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
 
-func convertToStringSlice(values ...any) []string {
-	var result []string
-	for _, v := range values {
-		result = append(result, fmt.Sprintf("%v", v))
+		if _, ok := skipped[c.Request.URL.Path]; ok {
+			return
+		}
+
+		l.Info(c.Request.Context(), "Request served",
+			zap.String("method", c.Request.Method),
+			zap.String("path", c.Request.URL.Path),
+			zap.Int("status", c.Writer.Status()),
+			zap.Int("size", c.Writer.Size()),
+			zap.Duration("duration", time.Since(start)),
+			zap.String("client_ip", c.ClientIP()))
 	}
-	return result
 }
@@ -0,0 +1,124 @@
+package logger
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func observed(level zapcore.Level) (*Logger, *observer.ObservedLogs) {
+	lvl := zap.NewAtomicLevelAt(level)
+	core, logs := observer.New(lvl)
+
+	return &Logger{zap: zap.New(core), level: lvl}, logs
+}
+
+func TestContextFields(t *testing.T) {
+	l, logs := observed(zapcore.InfoLevel)
+
+	ctx := WithUserID(WithRequestID(context.Background(), "req-1"), "user-1")
+	l.Info(ctx, "Saved", String("code", "abc"))
+	l.Error(context.Background(), "Failed", errors.New("boom"))
+	l.Debug(ctx, "Hidden")
+
+	entries := logs.AllUntimed()
+	require.Len(t, entries, 2)
+
+	assert.Equal(t, "Saved", entries[0].Message)
+	assert.Equal(t, map[string]any{"request_id": "req-1", "user_id": "user-1", "code": "abc"},
+		entries[0].ContextMap())
+
+	assert.Equal(t, zapcore.ErrorLevel, entries[1].Level)
+	assert.Equal(t, map[string]any{"error": "boom"}, entries[1].ContextMap())
+}
+
+func TestFromContext(t *testing.T) {
+	l, logs := observed(zapcore.InfoLevel)
+
+	FromContext(context.Background()).Info(context.Background(), "Dropped")
+	FromContext(NewContext(context.Background(), l)).Info(context.Background(), "Kept")
+
+	require.Equal(t, 1, logs.Len())
+	assert.Equal(t, "Kept", logs.All()[0].Message)
+}
+
+func TestLevelHandler(t *testing.T) {
+	l, logs := observed(zapcore.InfoLevel)
+	handler := l.LevelHandler()
+
+	req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"level":"debug"}`))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.JSONEq(t, `{"level":"debug"}`, w.Body.String())
+
+	l.With(String("component", "test")).Debug(context.Background(), "Shown")
+	require.Equal(t, 1, logs.Len())
+	assert.Equal(t, "test", logs.All()[0].ContextMap()["component"])
+}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	l, logs := observed(zapcore.InfoLevel)
+
+	router := gin.New()
+	router.Use(l.Middleware())
+	router.GET("/:id", func(c *gin.Context) {
+		c.Request = c.Request.WithContext(WithUserID(c.Request.Context(), "user-1"))
+		c.Status(http.StatusTeapot)
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/abc", nil))
+
+	require.Equal(t, 1, logs.Len())
+	fields := logs.All()[0].ContextMap()
+	assert.Equal(t, "/abc", fields["path"])
+	assert.Equal(t, int64(http.StatusTeapot), fields["status"])
+	assert.Equal(t, "user-1", fields["user_id"])
+}
+
+func TestMiddlewareSkip(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	l, logs := observed(zapcore.InfoLevel)
+
+	router := gin.New()
+	router.Use(l.Middleware("/healthz"))
+	router.GET("/:id", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	for _, path := range []string{"/healthz", "/abc"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	require.Equal(t, 1, logs.Len())
+	assert.Equal(t, "/abc", logs.All()[0].ContextMap()["path"])
+}
+
+func TestNew(t *testing.T) {
+	for _, format := range []string{"json", "console"} {
+		l, err := New("warn", format)
+		require.NoError(t, err)
+		assert.False(t, l.zap.Core().Enabled(zapcore.InfoLevel))
+	}
+
+	_, err := New("verbose", "json")
+	assert.Error(t, err)
+
+	_, err = New("info", "xml")
+	assert.Error(t, err)
+}
@@ -0,0 +1,98 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	ierrors "github.com/MomsEngineer/urlshortener/internal/errors"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func scrape(t *testing.T) string {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	body, err := io.ReadAll(w.Body)
+	require.NoError(t, err)
+
+	return string(body)
+}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Middleware())
+	router.GET("/:id", func(c *gin.Context) {
+		c.Status(http.StatusTemporaryRedirect)
+	})
+
+	for _, path := range []string{"/abc", "/def", "/a/b"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	out := scrape(t)
+	assert.Contains(t, out, `shortener_http_requests_total{method="GET",route="/:id",status="307"} 2`)
+	assert.Contains(t, out, `shortener_http_requests_total{method="GET",route="unmatched",status="404"} 1`)
+	assert.Contains(t, out,
+		`shortener_http_request_duration_seconds_count{method="GET",route="/:id",status="307"} 2`)
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	interceptor := UnaryServerInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: "/shortener.v1.Shortener/GetOriginal"}
+
+	_, err := interceptor(context.Background(), nil, info, func(context.Context, any) (any, error) {
+		return nil, nil
+	})
+	require.NoError(t, err)
+	_, err = interceptor(context.Background(), nil, info, func(context.Context, any) (any, error) {
+		return nil, status.Error(codes.NotFound, "no such link")
+	})
+	require.Error(t, err)
+
+	out := scrape(t)
+	assert.Contains(t, out,
+		`shortener_grpc_requests_total{code="OK",method="/shortener.v1.Shortener/GetOriginal"} 1`)
+	assert.Contains(t, out,
+		`shortener_grpc_requests_total{code="NotFound",method="/shortener.v1.Shortener/GetOriginal"} 1`)
+	assert.Contains(t, out,
+		`shortener_grpc_request_duration_seconds_count{code="OK",method="/shortener.v1.Shortener/GetOriginal"} 1`)
+}
+
+func TestObserveStorage(t *testing.T) {
+	start := time.Now()
+	ObserveStorage("test", "GetLink", start, nil)
+	ObserveStorage("test", "GetLink", start, fmt.Errorf("link: %w", ierrors.ErrNotFound))
+	ObserveStorage("test", "GetLink", start, errors.New("connection refused"))
+
+	out := scrape(t)
+	assert.Contains(t, out,
+		`shortener_storage_operation_duration_seconds_count{backend="test",method="GetLink"} 3`)
+	assert.Contains(t, out, `shortener_storage_errors_total{backend="test",method="GetLink"} 1`)
+}
+
+func TestCounters(t *testing.T) {
+	LinksCreated(3)
+	RedirectServed()
+	QueueDropped("click", 2)
+
+	out := scrape(t)
+	assert.Contains(t, out, "shortener_links_created_total 3")
+	assert.Contains(t, out, "shortener_redirects_total 1")
+	assert.Contains(t, out, `shortener_queue_dropped_total{queue="click"} 2`)
+	assert.Contains(t, out, "go_goroutines")
+}
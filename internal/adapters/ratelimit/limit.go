@@ -0,0 +1,105 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit is a token bucket that holds up to Burst tokens and gets Rate
+// tokens per second back. Each request costs one token, batch requests
+// cost one per item. The zero Limit doesn't limit anything.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+var limitUnits = map[string]time.Duration{
+	"s": time.Second,
+	"m": time.Minute,
+	"h": time.Hour,
+}
+
+// ParseLimit parses limits such as "100/m": a burst of 100 requests
+// refilled in a minute. The units are s, m and h, an empty string or
+// "off" disables the limit.
+func ParseLimit(s string) (Limit, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "off" {
+		return Limit{}, nil
+	}
+
+	count, unit, ok := strings.Cut(s, "/")
+	period, known := limitUnits[unit]
+	n, err := strconv.Atoi(count)
+	if !ok || !known || err != nil || n <= 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q, use a form like 100/m", s)
+	}
+
+	return Limit{Rate: float64(n) / period.Seconds(), Burst: n}, nil
+}
+
+func (l Limit) Enabled() bool {
+	return l.Rate > 0 && l.Burst > 0
+}
+
+// Window is the time an empty bucket takes to fill up.
+func (l Limit) Window() time.Duration {
+	return seconds(float64(l.Burst) / l.Rate)
+}
+
+// Result tells whether the request may proceed and how the bucket
+// looks after it.
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration
+	Reset      time.Duration
+}
+
+// bucket is the state kept by the stores between requests.
+type bucket struct {
+	Tokens  float64
+	Updated time.Time
+}
+
+// take refills the bucket for the time passed since its last use and
+// takes n tokens if there are enough. A new bucket starts full. A
+// request never costs more than the burst, so it can pass eventually.
+func (b *bucket) take(l Limit, n int, now time.Time) Result {
+	burst := float64(l.Burst)
+	if b.Updated.IsZero() {
+		b.Tokens = burst
+	} else if elapsed := now.Sub(b.Updated).Seconds(); elapsed > 0 {
+		b.Tokens = math.Min(burst, b.Tokens+elapsed*l.Rate)
+	}
+	if now.After(b.Updated) {
+		b.Updated = now
+	}
+
+	cost := math.Min(math.Max(float64(n), 1), burst)
+	res := Result{Limit: l.Burst}
+	if b.Tokens >= cost {
+		b.Tokens -= cost
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((cost - b.Tokens) / l.Rate)
+	}
+
+	res.Remaining = int(b.Tokens)
+	res.Reset = seconds((burst - b.Tokens) / l.Rate)
+
+	return res
+}
+
+// fullAt is when the bucket is full again and may be forgotten.
+func (b *bucket) fullAt(l Limit) time.Time {
+	return b.Updated.Add(seconds((float64(l.Burst) - b.Tokens) / l.Rate))
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,86 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Limit
+		wantErr bool
+	}{
+		{in: "100/m", want: Limit{Rate: 100.0 / 60, Burst: 100}},
+		{in: "10/s", want: Limit{Rate: 10, Burst: 10}},
+		{in: "3600/h", want: Limit{Rate: 1, Burst: 3600}},
+		{in: "off"},
+		{in: ""},
+		{in: "100", wantErr: true},
+		{in: "100/d", wantErr: true},
+		{in: "0/m", wantErr: true},
+		{in: "-1/m", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseLimit(tt.in)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestBucketTake(t *testing.T) {
+	l := Limit{Rate: 1, Burst: 2}
+	now := time.Now()
+	b := &bucket{}
+
+	res := b.take(l, 1, now)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 1, res.Remaining)
+	assert.Equal(t, time.Second, res.Reset)
+
+	res = b.take(l, 1, now)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+
+	res = b.take(l, 1, now.Add(500*time.Millisecond))
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 500*time.Millisecond, res.RetryAfter)
+
+	res = b.take(l, 1, now.Add(time.Second))
+	assert.True(t, res.Allowed, "a token must be back after a second")
+
+	res = b.take(l, 1, now.Add(time.Hour))
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 1, res.Remaining, "the bucket must not hold more than the burst")
+	assert.Equal(t, now.Add(time.Hour+time.Second), b.fullAt(l))
+}
+
+func TestBucketTakeN(t *testing.T) {
+	l := Limit{Rate: 1, Burst: 3}
+	now := time.Now()
+	b := &bucket{}
+
+	res := b.take(l, 2, now)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 1, res.Remaining)
+
+	res = b.take(l, 2, now)
+	assert.False(t, res.Allowed, "a request must not take more tokens than are left")
+	assert.Equal(t, time.Second, res.RetryAfter)
+	assert.Equal(t, 1, res.Remaining)
+
+	res = b.take(l, 10, now.Add(time.Hour))
+	assert.True(t, res.Allowed, "a request must never cost more than the burst")
+	assert.Equal(t, 0, res.Remaining)
+}
@@ -0,0 +1,114 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/MomsEngineer/urlshortener/internal/adapters/config"
+	"github.com/MomsEngineer/urlshortener/internal/adapters/logger"
+)
+
+// Class groups the routes that share a limit.
+type Class string
+
+const (
+	ClassCreate   Class = "create"
+	ClassRedirect Class = "redirect"
+)
+
+// Store keeps the buckets. Take takes n tokens from the bucket of the
+// key, the limit is the same for every call with the same key.
+type Store interface {
+	Take(ctx context.Context, key string, l Limit, n int, now time.Time) (Result, error)
+	Close() error
+}
+
+type Limiter struct {
+	store  Store
+	limits map[Class]Limit
+	log    *logger.Logger
+	now    func() time.Time
+}
+
+func New(store Store, limits map[Class]Limit) *Limiter {
+	return &Limiter{store: store, limits: limits, log: logger.NewNop(), now: time.Now}
+}
+
+// Create builds the limiter configured by cfg, the postgres store uses
+// the database of the links.
+func Create(cfg *config.Config, log *logger.Logger) (*Limiter, error) {
+	create, err := ParseLimit(cfg.RateLimitCreate)
+	if err != nil {
+		return nil, err
+	}
+
+	redirect, err := ParseLimit(cfg.RateLimitRedirect)
+	if err != nil {
+		return nil, err
+	}
+
+	var store Store
+	switch cfg.RateLimitStore {
+	case "", "memory":
+		store = NewMemoryStore()
+	case "postgres":
+		if cfg.DataBaseDSN == "" {
+			return nil, fmt.Errorf("postgres rate limit store needs a database DSN")
+		}
+		ps, err := NewPostgresStore(cfg.DataBaseDSN)
+		if err != nil {
+			return nil, err
+		}
+		ps.log = log
+		store = ps
+	default:
+		return nil, fmt.Errorf("unknown rate limit store %q", cfg.RateLimitStore)
+	}
+
+	l := New(store, map[Class]Limit{ClassCreate: create, ClassRedirect: redirect})
+	l.log = log
+
+	return l, nil
+}
+
+func (l *Limiter) Limit(class Class) Limit {
+	return l.limits[class]
+}
+
+// Allow takes a token from the bucket of every key, see AllowN.
+func (l *Limiter) Allow(ctx context.Context, class Class, keys ...string) Result {
+	return l.AllowN(ctx, class, 1, keys...)
+}
+
+// AllowN takes n tokens from the bucket of every key and returns the
+// most restrictive result, a rejected request still uses up the tokens
+// of the buckets that had enough. A request is let through if the
+// store fails, so the limiter can't take the service down.
+func (l *Limiter) AllowN(ctx context.Context, class Class, n int, keys ...string) Result {
+	limit := l.limits[class]
+	if !limit.Enabled() {
+		return Result{Allowed: true}
+	}
+
+	now := l.now()
+	res := Result{Allowed: true, Limit: limit.Burst, Remaining: limit.Burst}
+	for _, key := range keys {
+		r, err := l.store.Take(ctx, string(class)+":"+key, limit, n, now)
+		if err != nil {
+			l.log.Error(ctx, "Failed to take rate limit token", err, logger.String("class", string(class)))
+			continue
+		}
+
+		res.Allowed = res.Allowed && r.Allowed
+		res.Remaining = min(res.Remaining, r.Remaining)
+		res.RetryAfter = max(res.RetryAfter, r.RetryAfter)
+		res.Reset = max(res.Reset, r.Reset)
+	}
+
+	return res
+}
+
+func (l *Limiter) Close() error {
+	return l.store.Close()
+}
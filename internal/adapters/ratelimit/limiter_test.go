@@ -0,0 +1,66 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/MomsEngineer/urlshortener/internal/adapters/config"
+	"github.com/MomsEngineer/urlshortener/internal/adapters/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiterAllow(t *testing.T) {
+	now := time.Now()
+	l := New(NewMemoryStore(), map[Class]Limit{ClassCreate: {Rate: 1, Burst: 2}})
+	l.now = func() time.Time { return now }
+
+	assert.True(t, l.Allow(context.TODO(), ClassCreate, "ip:1", "user:a").Allowed)
+	assert.True(t, l.Allow(context.TODO(), ClassCreate, "ip:1", "user:b").Allowed)
+
+	res := l.Allow(context.TODO(), ClassCreate, "ip:1", "user:c")
+	assert.False(t, res.Allowed, "the IP bucket must limit users sharing it")
+	assert.Equal(t, 0, res.Remaining)
+	assert.Equal(t, time.Second, res.RetryAfter)
+
+	assert.True(t, l.Allow(context.TODO(), ClassCreate, "ip:2", "user:c").Allowed)
+
+	res = l.Allow(context.TODO(), ClassRedirect, "ip:1")
+	assert.True(t, res.Allowed, "a class without a limit must not be limited")
+
+	now = now.Add(time.Second)
+	assert.True(t, l.Allow(context.TODO(), ClassCreate, "ip:1").Allowed)
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	ms := NewMemoryStore()
+	l := Limit{Rate: 1, Burst: 1}
+	now := time.Now()
+
+	_, err := ms.Take(context.TODO(), "a", l, 1, now)
+	require.NoError(t, err)
+	require.Len(t, ms.buckets, 1)
+
+	_, err = ms.Take(context.TODO(), "b", l, 1, now.Add(sweepInterval))
+	require.NoError(t, err)
+	assert.Len(t, ms.buckets, 1, "full buckets must be dropped")
+}
+
+func TestCreate(t *testing.T) {
+	l, err := Create(&config.Config{RateLimitCreate: "10/s", RateLimitRedirect: "off"}, logger.NewNop())
+	require.NoError(t, err)
+	defer l.Close()
+
+	assert.Equal(t, Limit{Rate: 10, Burst: 10}, l.Limit(ClassCreate))
+	assert.False(t, l.Limit(ClassRedirect).Enabled())
+
+	_, err = Create(&config.Config{RateLimitCreate: "10"}, logger.NewNop())
+	require.Error(t, err)
+
+	_, err = Create(&config.Config{RateLimitStore: "postgres"}, logger.NewNop())
+	require.Error(t, err, "postgres store needs a DSN")
+
+	_, err = Create(&config.Config{RateLimitStore: "redis"}, logger.NewNop())
+	require.Error(t, err)
+}
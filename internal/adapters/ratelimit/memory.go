@@ -0,0 +1,59 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const sweepInterval = time.Minute
+
+type memoryBucket struct {
+	bucket
+	full time.Time
+}
+
+// MemoryStore keeps the buckets of a single instance. Full buckets are
+// dropped from time to time, a new bucket starts full anyway.
+type MemoryStore struct {
+	buckets   map[string]*memoryBucket
+	lastSweep time.Time
+	mu        sync.Mutex
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]*memoryBucket)}
+}
+
+func (ms *MemoryStore) Take(_ context.Context, key string, l Limit, n int, now time.Time) (Result, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if now.Sub(ms.lastSweep) >= sweepInterval {
+		ms.sweep(now)
+	}
+
+	b, ok := ms.buckets[key]
+	if !ok {
+		b = &memoryBucket{}
+		ms.buckets[key] = b
+	}
+
+	res := b.take(l, n, now)
+	b.full = b.fullAt(l)
+
+	return res, nil
+}
+
+func (ms *MemoryStore) sweep(now time.Time) {
+	for key, b := range ms.buckets {
+		if !now.Before(b.full) {
+			delete(ms.buckets, key)
+		}
+	}
+	ms.lastSweep = now
+}
+
+func (ms *MemoryStore) Close() error {
+	return nil
+}
@@ -0,0 +1,88 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/MomsEngineer/urlshortener/internal/adapters/logger"
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// PostgresStore shares the buckets between instances. A bucket row is
+// locked while a request takes its tokens, rows of full buckets are
+// deleted from time to time. The rate_limits table is created by the
+// storage migrations.
+type PostgresStore struct {
+	sqlDB     *sql.DB
+	table     string
+	log       *logger.Logger
+	lastSweep time.Time
+	mu        sync.Mutex
+}
+
+func NewPostgresStore(dsn string) (*PostgresStore, error) {
+	sqlDB, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PostgresStore{sqlDB: sqlDB, table: "rate_limits", log: logger.NewNop()}, nil
+}
+
+func (ps *PostgresStore) Take(ctx context.Context, key string, l Limit, n int, now time.Time) (Result, error) {
+	ps.sweep(ctx, now)
+
+	tx, err := ps.sqlDB.BeginTx(ctx, nil)
+	if err != nil {
+		return Result{}, err
+	}
+	defer tx.Rollback()
+
+	// A missing row is created first, so concurrent requests for a new
+	// key wait for each other on the row lock.
+	query := "INSERT INTO " + ps.table + " (key, tokens, updated_at, full_at)" +
+		" VALUES ($1, $2, NULL, $3) ON CONFLICT (key) DO NOTHING"
+	if _, err := tx.ExecContext(ctx, query, key, float64(l.Burst), now); err != nil {
+		return Result{}, err
+	}
+
+	var b bucket
+	var updated sql.NullTime
+	query = "SELECT tokens, updated_at FROM " + ps.table + " WHERE key = $1 FOR UPDATE"
+	if err := tx.QueryRowContext(ctx, query, key).Scan(&b.Tokens, &updated); err != nil {
+		return Result{}, err
+	}
+	b.Updated = updated.Time
+
+	res := b.take(l, n, now)
+
+	query = "UPDATE " + ps.table + " SET tokens = $1, updated_at = $2, full_at = $3 WHERE key = $4"
+	if _, err := tx.ExecContext(ctx, query, b.Tokens, b.Updated, b.fullAt(l), key); err != nil {
+		return Result{}, err
+	}
+
+	return res, tx.Commit()
+}
+
+// sweep deletes full buckets at most once a minute per instance,
+// failures are left to the next sweep.
+func (ps *PostgresStore) sweep(ctx context.Context, now time.Time) {
+	ps.mu.Lock()
+	if now.Sub(ps.lastSweep) < sweepInterval {
+		ps.mu.Unlock()
+		return
+	}
+	ps.lastSweep = now
+	ps.mu.Unlock()
+
+	query := "DELETE FROM " + ps.table + " WHERE full_at <= $1"
+	if _, err := ps.sqlDB.ExecContext(ctx, query, now); err != nil {
+		ps.log.Error(ctx, "Failed to delete full rate limit buckets", err)
+	}
+}
+
+func (ps *PostgresStore) Close() error {
+	return ps.sqlDB.Close()
+}
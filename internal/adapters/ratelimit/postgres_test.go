@@ -0,0 +1,52 @@
+package ratelimit
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	dbstorage "github.com/MomsEngineer/urlshortener/internal/adapters/storage/db_storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPostgresStore needs a disposable Postgres database, the storage
+// migrations create the table.
+func TestPostgresStore(t *testing.T) {
+	dsn := os.Getenv("DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("DATABASE_DSN is not set")
+	}
+
+	db, err := dbstorage.NewDB(dsn, dbstorage.WithMigrations("file://../../../migration"))
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	ps, err := NewPostgresStore(dsn)
+	require.NoError(t, err)
+	defer ps.Close()
+
+	_, err = ps.sqlDB.Exec("TRUNCATE rate_limits")
+	require.NoError(t, err)
+
+	l := Limit{Rate: 1, Burst: 2}
+	now := time.Now()
+
+	res, err := ps.Take(context.TODO(), "key", l, 1, now)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 1, res.Remaining)
+
+	res, err = ps.Take(context.TODO(), "key", l, 1, now)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+
+	res, err = ps.Take(context.TODO(), "key", l, 1, now)
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+
+	res, err = ps.Take(context.TODO(), "key", l, 1, now.Add(time.Second))
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+}
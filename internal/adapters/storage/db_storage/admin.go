@@ -0,0 +1,135 @@
+package dbstorage
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MomsEngineer/urlshortener/internal/entities/link"
+	ierror "github.com/MomsEngineer/urlshortener/internal/errors"
+)
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func (db *Database) ListLinks(ctx context.Context, f link.Filter) ([]*link.Link, error) {
+	query := "SELECT user_id, short_link, original_link, is_disabled, expires_at FROM " +
+		db.table + " WHERE is_deleted = FALSE"
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if f.UserID != "" {
+		query += " AND user_id = " + arg(f.UserID)
+	}
+	if f.Query != "" {
+		pattern := arg("%" + likeEscaper.Replace(f.Query) + "%")
+		query += " AND (short_link ILIKE " + pattern + " OR original_link ILIKE " + pattern + ")"
+	}
+
+	query += " ORDER BY short_link"
+	if f.Limit > 0 {
+		query += " LIMIT " + arg(f.Limit)
+	}
+	if f.Offset > 0 {
+		query += " OFFSET " + arg(f.Offset)
+	}
+
+	rows, err := db.sqlDB.QueryContext(ctx, query, args...)
+	if err != nil {
+		db.log.Error(ctx, "Failed to execute query", err)
+		return nil, unavailable(err)
+	}
+	defer rows.Close()
+
+	var res []*link.Link
+	for rows.Next() {
+		l := &link.Link{}
+		var expiresAt sql.NullTime
+		if err := rows.Scan(&l.UserID, &l.ShortURL, &l.OriginalURL, &l.IsDisabled, &expiresAt); err != nil {
+			db.log.Error(ctx, "Failed to scan response from DB", err)
+			return nil, err
+		}
+		l.ExpiresAt = expiresAt.Time
+		res = append(res, l)
+	}
+
+	if err := rows.Err(); err != nil {
+		db.log.Error(ctx, "Error occurred while iterating over rows", err)
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (db *Database) DisableLink(ctx context.Context, short string, disabled bool) error {
+	query := "UPDATE " + db.table +
+		" SET is_disabled = $1 WHERE short_link = $2 AND is_deleted = FALSE"
+	return db.updateLink(ctx, query, disabled, short)
+}
+
+// SetLinkOwner returns ErrDuplicate if the new owner already has a
+// link to the same original URL.
+func (db *Database) SetLinkOwner(ctx context.Context, short, userID string) error {
+	query := "UPDATE " + db.table +
+		" SET user_id = $1 WHERE short_link = $2 AND is_deleted = FALSE"
+	return db.updateLink(ctx, query, userID, short)
+}
+
+// updateLink runs an update of a single live link, ErrNotFound is
+// returned if there is no such link.
+func (db *Database) updateLink(ctx context.Context, query string, args ...any) error {
+	res, err := db.sqlDB.ExecContext(ctx, query, args...)
+	if isViolation(err, userOriginalIndex) {
+		return ierror.ErrDuplicate
+	} else if err != nil {
+		db.log.Error(ctx, "Failed to update link", err)
+		return unavailable(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ierror.ErrNotFound
+	}
+
+	return nil
+}
+
+// BanUser keeps the reason and time of the first ban.
+func (db *Database) BanUser(ctx context.Context, userID, reason string, now time.Time) error {
+	query := "INSERT INTO " + db.bansTable + " (user_id, reason, banned_at) VALUES ($1, $2, $3)" +
+		" ON CONFLICT (user_id) DO NOTHING"
+	if _, err := db.sqlDB.ExecContext(ctx, query, userID, reason, now); err != nil {
+		db.log.Error(ctx, "Failed to ban user", err)
+		return unavailable(err)
+	}
+
+	return nil
+}
+
+func (db *Database) UnbanUser(ctx context.Context, userID string) error {
+	query := "DELETE FROM " + db.bansTable + " WHERE user_id = $1"
+	if _, err := db.sqlDB.ExecContext(ctx, query, userID); err != nil {
+		db.log.Error(ctx, "Failed to unban user", err)
+		return unavailable(err)
+	}
+
+	return nil
+}
+
+func (db *Database) IsBanned(ctx context.Context, userID string) (bool, error) {
+	query := "SELECT EXISTS (SELECT 1 FROM " + db.bansTable + " WHERE user_id = $1)"
+	var banned bool
+	if err := db.sqlDB.QueryRowContext(ctx, query, userID).Scan(&banned); err != nil {
+		db.log.Error(ctx, "Failed to check user ban", err)
+		return false, unavailable(err)
+	}
+
+	return banned, nil
+}
@@ -0,0 +1,121 @@
+package dbstorage
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/MomsEngineer/urlshortener/internal/entities/apikey"
+	ierror "github.com/MomsEngineer/urlshortener/internal/errors"
+)
+
+const apiKeyColumns = `id, user_id, name, prefix, key_hash, scopes, created_at, revoked_at`
+
+func (db *Database) SaveAPIKey(ctx context.Context, k *apikey.APIKey) error {
+	query := "INSERT INTO " + db.apiKeysTable + " (" + apiKeyColumns +
+		") VALUES ($1, $2, $3, $4, $5, $6, $7, $8)"
+	_, err := db.sqlDB.ExecContext(ctx, query, k.ID, k.UserID, k.Name, k.Prefix, k.Hash,
+		joinScopes(k.Scopes), k.CreatedAt, nullTime(k.RevokedAt))
+	if err != nil {
+		db.log.Error(ctx, "Failed to insert API key", err)
+		return unavailable(err)
+	}
+
+	return nil
+}
+
+func (db *Database) GetAPIKey(ctx context.Context, hash string) (*apikey.APIKey, error) {
+	query := "SELECT " + apiKeyColumns + " FROM " + db.apiKeysTable + " WHERE key_hash = $1"
+	k, err := scanAPIKey(db.sqlDB.QueryRowContext(ctx, query, hash))
+	if err == sql.ErrNoRows {
+		return nil, ierror.ErrNotFound
+	} else if err != nil {
+		db.log.Error(ctx, "Failed to get API key", err)
+		return nil, unavailable(err)
+	}
+
+	return k, nil
+}
+
+func (db *Database) GetAPIKeysByUser(ctx context.Context, userID string) ([]*apikey.APIKey, error) {
+	query := "SELECT " + apiKeyColumns + " FROM " + db.apiKeysTable +
+		" WHERE user_id = $1 ORDER BY created_at"
+	rows, err := db.sqlDB.QueryContext(ctx, query, userID)
+	if err != nil {
+		db.log.Error(ctx, "Failed to execute query", err)
+		return nil, unavailable(err)
+	}
+	defer rows.Close()
+
+	var res []*apikey.APIKey
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			db.log.Error(ctx, "Failed to scan response from DB", err)
+			return nil, err
+		}
+		res = append(res, k)
+	}
+
+	if err := rows.Err(); err != nil {
+		db.log.Error(ctx, "Error occurred while iterating over rows", err)
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// RevokeAPIKey keeps the first revocation time of an already
+// revoked key.
+func (db *Database) RevokeAPIKey(ctx context.Context, userID, id string, now time.Time) error {
+	query := "UPDATE " + db.apiKeysTable +
+		" SET revoked_at = COALESCE(revoked_at, $1) WHERE id = $2 AND user_id = $3"
+	res, err := db.sqlDB.ExecContext(ctx, query, now, id, userID)
+	if err != nil {
+		db.log.Error(ctx, "Failed to revoke API key", err)
+		return unavailable(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ierror.ErrNotFound
+	}
+
+	return nil
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanAPIKey(row scanner) (*apikey.APIKey, error) {
+	k := &apikey.APIKey{}
+	var scopes string
+	var revokedAt sql.NullTime
+	err := row.Scan(&k.ID, &k.UserID, &k.Name, &k.Prefix, &k.Hash, &scopes, &k.CreatedAt, &revokedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range strings.Split(scopes, ",") {
+		if s != "" {
+			k.Scopes = append(k.Scopes, apikey.Scope(s))
+		}
+	}
+	k.RevokedAt = revokedAt.Time
+
+	return k, nil
+}
+
+func joinScopes(scopes []apikey.Scope) string {
+	res := make([]string, len(scopes))
+	for i, s := range scopes {
+		res[i] = string(s)
+	}
+
+	return strings.Join(res, ",")
+}
@@ -3,39 +3,101 @@ package dbstorage
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
-	"strings"
+	"net"
+	"time"
 
 	"github.com/MomsEngineer/urlshortener/internal/adapters/logger"
+	"github.com/MomsEngineer/urlshortener/internal/entities/click"
 	"github.com/MomsEngineer/urlshortener/internal/entities/link"
 	ierror "github.com/MomsEngineer/urlshortener/internal/errors"
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
-	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/stdlib"
 )
 
-var log = logger.Create(logger.InfoLevel)
+const (
+	shortLinkIndex    = "links_short_link_idx"
+	userOriginalIndex = "links_user_original_link_idx"
+	userLoginIndex    = "users_login_idx"
+
+	// migrationsTable is where golang-migrate keeps the schema version.
+	migrationsTable = "schema_migrations"
+)
 
 type Database struct {
-	sqlDB *sql.DB
-	table string
+	sqlDB        *sql.DB
+	table        string
+	clicksTable  string
+	apiKeysTable string
+	usersTable   string
+	bansTable    string
+	usageTable   string
+	secretsTable string
+	scope        link.UniqueScope
+	migrations   string
+	version      uint
+	log          *logger.Logger
+}
+
+type Option func(*Database)
+
+func WithUniqueScope(scope link.UniqueScope) Option {
+	return func(db *Database) {
+		db.scope = scope
+	}
 }
 
-func NewDB(dsn string) (*Database, error) {
-	table := "links"
+func WithLogger(log *logger.Logger) Option {
+	return func(db *Database) {
+		db.log = log
+	}
+}
 
-	sqlDB, err := sql.Open("pgx", dsn)
+// WithMigrations sets the migrations source URL,
+// "file://migration" by default.
+func WithMigrations(source string) Option {
+	return func(db *Database) {
+		db.migrations = source
+	}
+}
+
+func NewDB(dsn string, opts ...Option) (*Database, error) {
+	db := &Database{
+		table:        "links",
+		clicksTable:  "clicks",
+		apiKeysTable: "api_keys",
+		usersTable:   "users",
+		bansTable:    "banned_users",
+		usageTable:   "daily_usage",
+		secretsTable: "secrets",
+		migrations:   "file://migration",
+		log:          logger.NewNop(),
+	}
+	for _, opt := range opts {
+		opt(db)
+	}
+
+	connCfg, err := pgx.ParseConfig(dsn)
 	if err != nil {
 		return nil, err
 	}
+	connCfg.Tracer = queryTracer{}
+
+	sqlDB := stdlib.OpenDB(*connCfg)
+	db.sqlDB = sqlDB
 
 	driver, err := postgres.WithInstance(sqlDB, &postgres.Config{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create migrate driver, %w", err)
 	}
 
-	m, err := migrate.NewWithDatabaseInstance("file://migration", table, driver)
+	m, err := migrate.NewWithDatabaseInstance(db.migrations, db.table, driver)
 	if err != nil {
 		return nil, fmt.Errorf("failed to migrate: %w", err)
 	}
@@ -44,54 +106,120 @@ func NewDB(dsn string) (*Database, error) {
 		return nil, fmt.Errorf("failed to do migrate %w", err)
 	}
 
-	return &Database{sqlDB: sqlDB, table: table}, nil
+	version, _, err := m.Version()
+	if err != nil && err != migrate.ErrNilVersion {
+		return nil, fmt.Errorf("failed to read the schema version: %w", err)
+	}
+	db.version = version
+
+	return db, nil
 }
 
-func (db *Database) getShortLinkByOriginal(ctx context.Context, original string) (string, error) {
-	query := `SELECT short_link FROM ` + db.table + ` WHERE original_link = $1`
-	stmt, err := db.sqlDB.PrepareContext(ctx, query)
+// getShortLinkByOriginal returns the short link of the live link
+// that l would duplicate within the uniqueness scope.
+func (db *Database) getShortLinkByOriginal(ctx context.Context, tx *sql.Tx, l *link.Link) (string, error) {
+	query := `SELECT short_link FROM ` + db.table +
+		` WHERE original_link = $1 AND is_deleted = FALSE`
+	args := []any{l.OriginalURL}
+	if db.scope == link.UniquePerUser {
+		query += ` AND user_id = $2`
+		args = append(args, l.UserID)
+	}
+
+	stmt, err := tx.PrepareContext(ctx, query+` LIMIT 1`)
 	if err != nil {
-		log.Error("Failed to prepare statement", err)
+		db.log.Error(ctx, "Failed to prepare statement", err)
 		return "", err
 	}
 	defer stmt.Close()
 
 	var short string
-	row := stmt.QueryRowContext(ctx, original)
+	row := stmt.QueryRowContext(ctx, args...)
 	err = row.Scan(&short)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			log.Debug("Not found original link", original)
+			db.log.Debug(ctx, "Not found original link", logger.String("original", l.OriginalURL))
 			return "", err
 		}
-		log.Error("Failed to scan response from DB", err)
+		db.log.Error(ctx, "Failed to scan response from DB", err)
 		return "", err
 	}
 
 	return short, nil
 }
 
-func (db *Database) SaveLinksBatch(ctx context.Context, ls []*link.Link) error {
-	tx, err := db.sqlDB.BeginTx(ctx, nil)
-	if err != nil {
-		log.Error("Failed to create transaction", err)
+// deleteExpiredDuplicate deletes the expired link that l would
+// duplicate, as the reaper would, so its original URL can be shortened
+// again before the reaper runs.
+func (db *Database) deleteExpiredDuplicate(ctx context.Context, tx *sql.Tx, l *link.Link, now time.Time) error {
+	query := "UPDATE " + db.table + " SET is_deleted = TRUE" +
+		" WHERE original_link = $1 AND is_deleted = FALSE AND expires_at <= $2"
+	args := []any{l.OriginalURL, now}
+	if db.scope == link.UniquePerUser {
+		query += " AND user_id = $3"
+		args = append(args, l.UserID)
+	}
+
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		db.log.Error(ctx, "Failed to delete expired duplicate", err)
+		return err
+	}
+
+	return nil
+}
+
+// saveLink inserts the link unless its original URL is already
+// shortened, then l gets the existing short link and ErrDuplicate is
+// returned. The advisory lock makes concurrent saves of the same
+// original URL wait for each other until the transaction ends.
+func (db *Database) saveLink(ctx context.Context, tx *sql.Tx, l *link.Link) error {
+	key := db.scope.Key(l.UserID, l.OriginalURL)
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", key); err != nil {
+		db.log.Error(ctx, "Failed to lock original link", err)
+		return err
+	}
+
+	if err := db.deleteExpiredDuplicate(ctx, tx, l, time.Now()); err != nil {
+		return err
+	}
+
+	oldShort, err := db.getShortLinkByOriginal(ctx, tx, l)
+	if err == nil {
+		db.log.Debug(ctx, "Duplicate link", logger.String("original", l.OriginalURL))
+		l.ShortURL = oldShort
+		return ierror.ErrDuplicate
+	} else if !errors.Is(err, sql.ErrNoRows) {
 		return err
 	}
-	defer tx.Rollback()
 
 	query := "INSERT INTO " + db.table +
-		" (user_id, short_link, original_link) VALUES($1, $2, $3)"
-	stmt, err := tx.PrepareContext(ctx, query)
+		" (user_id, short_link, original_link, expires_at) VALUES ($1, $2, $3, $4)"
+	_, err = tx.ExecContext(ctx, query, l.UserID, l.ShortURL, l.OriginalURL, nullTime(l.ExpiresAt))
 	if err != nil {
-		log.Error("Failed to prepare statement", err)
+		if isShortLinkViolation(err) {
+			db.log.Debug(ctx, "Short link is taken", logger.String("short", l.ShortURL))
+			return ierror.ErrAliasTaken
+		}
+		db.log.Error(ctx, "Failed to insert record", err)
 		return err
 	}
-	defer stmt.Close()
+
+	return nil
+}
+
+// SaveLinksBatch saves either all links or none of them. Links with
+// an already shortened original URL get the existing short link.
+func (db *Database) SaveLinksBatch(ctx context.Context, ls []*link.Link) error {
+	tx, err := db.sqlDB.BeginTx(ctx, nil)
+	if err != nil {
+		db.log.Error(ctx, "Failed to create transaction", err)
+		return unavailable(err)
+	}
+	defer tx.Rollback()
 
 	for _, l := range ls {
-		_, err := stmt.ExecContext(ctx, l.UserID, l.ShortURL, l.OriginalURL)
-		if err != nil {
-			log.Error("Failed to execute statement", err)
+		err := db.saveLink(ctx, tx, l)
+		if err != nil && !errors.Is(err, ierror.ErrDuplicate) {
 			return err
 		}
 	}
@@ -99,71 +227,60 @@ func (db *Database) SaveLinksBatch(ctx context.Context, ls []*link.Link) error {
 }
 
 func (db *Database) SaveLink(ctx context.Context, l *link.Link) error {
-	query := "INSERT INTO " + db.table +
-		" (user_id, short_link, original_link) VALUES ($1, $2, $3)"
-	stmt, err := db.sqlDB.PrepareContext(ctx, query)
+	tx, err := db.sqlDB.BeginTx(ctx, nil)
 	if err != nil {
-		log.Error("Failed to prepare statement", err)
-		return err
+		db.log.Error(ctx, "Failed to create transaction", err)
+		return unavailable(err)
 	}
-	defer stmt.Close()
-
-	_, err = stmt.ExecContext(ctx, l.UserID, l.ShortURL, l.OriginalURL)
-	if err != nil {
-		if strings.Contains(err.Error(), "(SQLSTATE 23505)") {
-			log.Error("Error: Duplicate link "+l.OriginalURL, err)
+	defer tx.Rollback()
 
-			oldShort, err := db.getShortLinkByOriginal(ctx, l.OriginalURL)
-			if err != nil {
-				log.Error("Faild to get link "+l.OriginalURL, err)
-				return err
-			}
-			l.ShortURL = oldShort
-			return ierror.ErrDuplicate
-		}
-		log.Error("Failed to insert record", err)
+	if err := db.saveLink(ctx, tx, l); err != nil {
 		return err
 	}
 
-	return nil
+	return tx.Commit()
 }
 
 func (db *Database) GetLink(ctx context.Context, l *link.Link) error {
-	query := `SELECT original_link FROM ` + db.table + ` WHERE short_link = $1`
+	query := `SELECT user_id, original_link, is_deleted, is_disabled, expires_at FROM ` + db.table +
+		` WHERE short_link = $1`
 	stmt, err := db.sqlDB.PrepareContext(ctx, query)
 	if err != nil {
-		log.Error("Failed to prepare statement", err)
-		return err
+		db.log.Error(ctx, "Failed to prepare statement", err)
+		return unavailable(err)
 	}
 	defer stmt.Close()
 
 	row := stmt.QueryRowContext(ctx, l.ShortURL)
 
-	err = row.Scan(&l.OriginalURL)
+	var expiresAt sql.NullTime
+	err = row.Scan(&l.UserID, &l.OriginalURL, &l.IsDeleted, &l.IsDisabled, &expiresAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			log.Debug("Not found original link for short link", l.ShortURL)
-			return nil
+			db.log.Debug(ctx, "Not found short link", logger.String("short", l.ShortURL))
+			return ierror.ErrNotFound
 		}
-		log.Error("Failed to scan response from DB", err)
+		db.log.Error(ctx, "Failed to scan response from DB", err)
 		return err
 	}
+	l.ExpiresAt = expiresAt.Time
 
 	return nil
 }
 
 func (db *Database) GetLinksByUser(ctx context.Context, userID string) (map[string]string, error) {
-	query := `SELECT short_link, original_link FROM ` + db.table + ` WHERE user_id = $1`
+	query := `SELECT short_link, original_link FROM ` + db.table +
+		` WHERE user_id = $1 AND is_deleted = FALSE`
 	stmt, err := db.sqlDB.PrepareContext(ctx, query)
 	if err != nil {
-		log.Error("Failed to prepare statement", err)
-		return nil, err
+		db.log.Error(ctx, "Failed to prepare statement", err)
+		return nil, unavailable(err)
 	}
 	defer stmt.Close()
 
 	row, err := stmt.QueryContext(ctx, userID)
 	if err != nil {
-		log.Error("Failed to execute query", err)
+		db.log.Error(ctx, "Failed to execute query", err)
 		return nil, err
 	}
 	defer row.Close()
@@ -171,11 +288,10 @@ func (db *Database) GetLinksByUser(ctx context.Context, userID string) (map[stri
 	res := make(map[string]string)
 
 	for row.Next() {
-		log.Debug(" row.Next")
 		var shortLink, originalLink string
 		err = row.Scan(&shortLink, &originalLink)
 		if err != nil {
-			log.Error("Failed to scan response from DB", err)
+			db.log.Error(ctx, "Failed to scan response from DB", err)
 			return nil, err
 		}
 
@@ -183,17 +299,181 @@ func (db *Database) GetLinksByUser(ctx context.Context, userID string) (map[stri
 	}
 
 	if err := row.Err(); err != nil {
-		log.Error("Error occurred while iterating over rows", err)
+		db.log.Error(ctx, "Error occurred while iterating over rows", err)
 		return nil, err
 	}
 
 	return res, nil
 }
 
+func (db *Database) CountLinks(ctx context.Context) (int, int, error) {
+	query := "SELECT COUNT(*), COUNT(DISTINCT user_id) FROM " + db.table +
+		" WHERE is_deleted = FALSE"
+	var urls, users int
+	if err := db.sqlDB.QueryRowContext(ctx, query).Scan(&urls, &users); err != nil {
+		db.log.Error(ctx, "Failed to count links", err)
+		return 0, 0, unavailable(err)
+	}
+
+	return urls, users, nil
+}
+
+func (db *Database) DeleteLinks(ctx context.Context, ls []*link.Link) error {
+	tx, err := db.sqlDB.BeginTx(ctx, nil)
+	if err != nil {
+		db.log.Error(ctx, "Failed to create transaction", err)
+		return unavailable(err)
+	}
+	defer tx.Rollback()
+
+	query := "UPDATE " + db.table +
+		" SET is_deleted = TRUE WHERE short_link = $1 AND user_id = $2"
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		db.log.Error(ctx, "Failed to prepare statement", err)
+		return err
+	}
+	defer stmt.Close()
+
+	for _, l := range ls {
+		_, err := stmt.ExecContext(ctx, l.ShortURL, l.UserID)
+		if err != nil {
+			db.log.Error(ctx, "Failed to execute statement", err)
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (db *Database) DeleteExpiredLinks(ctx context.Context, now time.Time) (int64, error) {
+	query := "UPDATE " + db.table +
+		" SET is_deleted = TRUE WHERE expires_at <= $1 AND is_deleted = FALSE"
+	res, err := db.sqlDB.ExecContext(ctx, query, now)
+	if err != nil {
+		db.log.Error(ctx, "Failed to delete expired links", err)
+		return 0, unavailable(err)
+	}
+
+	return res.RowsAffected()
+}
+
+func (db *Database) SaveClicks(ctx context.Context, clicks []*click.Click) error {
+	tx, err := db.sqlDB.BeginTx(ctx, nil)
+	if err != nil {
+		db.log.Error(ctx, "Failed to create transaction", err)
+		return unavailable(err)
+	}
+	defer tx.Rollback()
+
+	query := "INSERT INTO " + db.clicksTable +
+		" (short_link, clicked_at, referrer, user_agent, ip_hash) VALUES($1, $2, $3, $4, $5)"
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		db.log.Error(ctx, "Failed to prepare statement", err)
+		return err
+	}
+	defer stmt.Close()
+
+	for _, c := range clicks {
+		_, err := stmt.ExecContext(ctx, c.ShortURL, c.Timestamp, c.Referrer, c.UserAgent, c.IPHash)
+		if err != nil {
+			db.log.Error(ctx, "Failed to execute statement", err)
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetClickStats aggregates the clicks in the database, only the daily
+// counts are sent back.
+func (db *Database) GetClickStats(ctx context.Context, short string) (*click.Stats, error) {
+	stats := &click.Stats{Daily: []click.DailyClicks{}}
+
+	query := "SELECT COUNT(*), COUNT(DISTINCT ip_hash) FROM " + db.clicksTable + " WHERE short_link = $1"
+	if err := db.sqlDB.QueryRowContext(ctx, query, short).Scan(&stats.Total, &stats.Unique); err != nil {
+		db.log.Error(ctx, "Failed to count clicks", err)
+		return nil, unavailable(err)
+	}
+
+	query = "SELECT to_char(clicked_at AT TIME ZONE 'UTC', 'YYYY-MM-DD') AS day, COUNT(*) FROM " +
+		db.clicksTable + " WHERE short_link = $1 GROUP BY day ORDER BY day"
+	rows, err := db.sqlDB.QueryContext(ctx, query, short)
+	if err != nil {
+		db.log.Error(ctx, "Failed to execute query", err)
+		return nil, unavailable(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d click.DailyClicks
+		if err := rows.Scan(&d.Date, &d.Clicks); err != nil {
+			db.log.Error(ctx, "Failed to scan response from DB", err)
+			return nil, err
+		}
+
+		stats.Daily = append(stats.Daily, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		db.log.Error(ctx, "Error occurred while iterating over rows", err)
+		return nil, err
+	}
+
+	return stats, nil
+}
+
 func (db *Database) Ping(ctx context.Context) error {
-	return db.sqlDB.PingContext(ctx)
+	return unavailable(db.sqlDB.PingContext(ctx))
+}
+
+// CheckMigrations fails if the schema is older than the one applied on
+// startup or a migration was left half done. A newer schema, migrated
+// by a newer instance, is fine.
+func (db *Database) CheckMigrations(ctx context.Context) error {
+	var version int64
+	var dirty bool
+	err := db.sqlDB.QueryRowContext(ctx,
+		`SELECT version, dirty FROM `+migrationsTable+` LIMIT 1`).Scan(&version, &dirty)
+	if err != nil {
+		return unavailable(err)
+	}
+
+	if dirty {
+		return fmt.Errorf("migration %d is dirty", version)
+	}
+	if version < int64(db.version) {
+		return fmt.Errorf("schema version is %d, %d is required", version, db.version)
+	}
+
+	return nil
 }
 
 func (db *Database) Close() error {
 	return db.sqlDB.Close()
 }
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+// unavailable marks errors of an unreachable or broken connection
+// with ErrStorageUnavailable, other errors are returned as is.
+func unavailable(err error) error {
+	var connErr *pgconn.ConnectError
+	var netErr net.Error
+	if errors.As(err, &connErr) || errors.As(err, &netErr) ||
+		errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) {
+		return fmt.Errorf("%w: %v", ierror.ErrStorageUnavailable, err)
+	}
+
+	return err
+}
+
+func isShortLinkViolation(err error) bool {
+	return isViolation(err, shortLinkIndex)
+}
+
+func isViolation(err error, constraint string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.ConstraintName == constraint
+}
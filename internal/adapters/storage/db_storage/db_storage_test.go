@@ -0,0 +1,134 @@
+package dbstorage_test
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	dbstorage "github.com/MomsEngineer/urlshortener/internal/adapters/storage/db_storage"
+	"github.com/MomsEngineer/urlshortener/internal/adapters/storage/storetest"
+	"github.com/MomsEngineer/urlshortener/internal/usecases/storage"
+	embeddedpostgres "github.com/fergusstrange/embedded-postgres"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	// testDSN points at the server the conformance suite runs against,
+	// either TEST_DATABASE_DSN or the embedded server started by TestMain.
+	testDSN string
+	// embeddedErr explains why the embedded server could not be started.
+	embeddedErr error
+)
+
+// TestMain starts an embedded Postgres when TEST_DATABASE_DSN is not set,
+// so the suite needs neither a container nor a shared database.
+func TestMain(m *testing.M) {
+	testDSN = os.Getenv("TEST_DATABASE_DSN")
+	if testDSN != "" {
+		os.Exit(m.Run())
+	}
+
+	pg, dsn, err := startEmbedded()
+	if err != nil {
+		embeddedErr = err
+		os.Exit(m.Run())
+	}
+	testDSN = dsn
+
+	code := m.Run()
+	if err := pg.Stop(); err != nil {
+		fmt.Fprintln(os.Stderr, "failed to stop embedded postgres:", err)
+	}
+	os.Exit(code)
+}
+
+func startEmbedded() (*embeddedpostgres.EmbeddedPostgres, string, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, "", err
+	}
+	port := uint32(l.Addr().(*net.TCPAddr).Port)
+	l.Close()
+
+	dir, err := os.MkdirTemp("", "urlshortener-pg")
+	if err != nil {
+		return nil, "", err
+	}
+
+	cfg := embeddedpostgres.DefaultConfig().
+		Port(port).
+		Database("shortener").
+		RuntimePath(dir).
+		Logger(io.Discard)
+	pg := embeddedpostgres.NewDatabase(cfg)
+	if err := pg.Start(); err != nil {
+		os.RemoveAll(dir)
+		return nil, "", err
+	}
+
+	return pg, cfg.GetConnectionURL() + "?sslmode=disable", nil
+}
+
+// TestDatabaseConformance runs every subtest in its own schema, which is
+// dropped when the subtest ends, so nothing outside it is touched.
+func TestDatabaseConformance(t *testing.T) {
+	if testDSN == "" {
+		t.Skipf("embedded postgres is unavailable and TEST_DATABASE_DSN is not set: %v", embeddedErr)
+	}
+
+	admin, err := sql.Open("pgx", testDSN)
+	require.NoError(t, err)
+	t.Cleanup(func() { admin.Close() })
+
+	storetest.Run(t, func(t *testing.T) storage.StoreInterface {
+		schema := newSchema(t, admin)
+
+		store, err := dbstorage.NewDB(withSearchPath(t, testDSN, schema),
+			dbstorage.WithMigrations("file://../../../../migration"))
+		require.NoError(t, err)
+
+		return store
+	})
+}
+
+func newSchema(t *testing.T, admin *sql.DB) string {
+	t.Helper()
+
+	b := make([]byte, 8)
+	_, err := rand.Read(b)
+	require.NoError(t, err)
+	schema := "test_" + hex.EncodeToString(b)
+
+	_, err = admin.Exec("CREATE SCHEMA " + schema)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		if _, err := admin.Exec("DROP SCHEMA " + schema + " CASCADE"); err != nil {
+			t.Errorf("failed to drop schema %s: %v", schema, err)
+		}
+	})
+
+	return schema
+}
+
+func withSearchPath(t *testing.T, dsn, schema string) string {
+	t.Helper()
+
+	if !strings.Contains(dsn, "://") {
+		return dsn + " search_path=" + schema
+	}
+
+	u, err := url.Parse(dsn)
+	require.NoError(t, err)
+	q := u.Query()
+	q.Set("search_path", schema)
+	u.RawQuery = q.Encode()
+
+	return u.String()
+}
@@ -0,0 +1,24 @@
+package dbstorage
+
+import "context"
+
+// GetOrCreateSecret saves the secret under name unless one is saved
+// already and returns the saved one. Instances starting together agree
+// on the secret of the first one.
+func (db *Database) GetOrCreateSecret(ctx context.Context, name string, secret []byte) ([]byte, error) {
+	query := "INSERT INTO " + db.secretsTable + " (name, value) VALUES ($1, $2)" +
+		" ON CONFLICT (name) DO NOTHING"
+	if _, err := db.sqlDB.ExecContext(ctx, query, name, secret); err != nil {
+		db.log.Error(ctx, "Failed to save secret", err)
+		return nil, unavailable(err)
+	}
+
+	query = "SELECT value FROM " + db.secretsTable + " WHERE name = $1"
+	var saved []byte
+	if err := db.sqlDB.QueryRowContext(ctx, query, name).Scan(&saved); err != nil {
+		db.log.Error(ctx, "Failed to get secret", err)
+		return nil, unavailable(err)
+	}
+
+	return saved, nil
+}
@@ -0,0 +1,13 @@
+package dbstorage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOperation(t *testing.T) {
+	assert.Equal(t, "SELECT", operation("select short_link FROM links"))
+	assert.Equal(t, "INSERT", operation("\n\tINSERT INTO links VALUES ($1)"))
+	assert.Equal(t, "postgresql", operation("  "))
+}
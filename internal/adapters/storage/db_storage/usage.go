@@ -0,0 +1,71 @@
+package dbstorage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	ierror "github.com/MomsEngineer/urlshortener/internal/errors"
+)
+
+func (db *Database) CountUserLinks(ctx context.Context, userID string) (int, error) {
+	query := "SELECT COUNT(*) FROM " + db.table + " WHERE user_id = $1 AND is_deleted = FALSE"
+	var n int
+	if err := db.sqlDB.QueryRowContext(ctx, query, userID).Scan(&n); err != nil {
+		db.log.Error(ctx, "Failed to count user links", err)
+		return 0, unavailable(err)
+	}
+
+	return n, nil
+}
+
+// AddDailyUsage returns ErrQuotaExceeded and keeps the counter if it
+// would grow past limit, a limit of 0 means no limit. The check and
+// the update are a single statement, so concurrent requests cannot
+// both take the last links of the quota.
+func (db *Database) AddDailyUsage(ctx context.Context, userID string, day time.Time, n, limit int) (int, error) {
+	if limit > 0 && n > limit {
+		return db.quotaExceeded(ctx, userID, day)
+	}
+
+	query := "INSERT INTO " + db.usageTable + " AS u (user_id, day, links)" +
+		" VALUES ($1, $2::date, GREATEST($3, 0))" +
+		" ON CONFLICT (user_id, day) DO UPDATE SET links = GREATEST(u.links + $3, 0)" +
+		" WHERE $4 = 0 OR $3 <= 0 OR u.links + $3 <= $4" +
+		" RETURNING links"
+	var used int
+	err := db.sqlDB.QueryRowContext(ctx, query, userID, day.UTC().Format(time.DateOnly), n, limit).Scan(&used)
+	if errors.Is(err, sql.ErrNoRows) {
+		return db.quotaExceeded(ctx, userID, day)
+	} else if err != nil {
+		db.log.Error(ctx, "Failed to add daily usage", err)
+		return 0, unavailable(err)
+	}
+
+	return used, nil
+}
+
+func (db *Database) GetDailyUsage(ctx context.Context, userID string, day time.Time) (int, error) {
+	query := "SELECT links FROM " + db.usageTable + " WHERE user_id = $1 AND day = $2::date"
+	var used int
+	err := db.sqlDB.QueryRowContext(ctx, query, userID, day.UTC().Format(time.DateOnly)).Scan(&used)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	} else if err != nil {
+		db.log.Error(ctx, "Failed to get daily usage", err)
+		return 0, unavailable(err)
+	}
+
+	return used, nil
+}
+
+// quotaExceeded reports the unchanged counter with ErrQuotaExceeded.
+func (db *Database) quotaExceeded(ctx context.Context, userID string, day time.Time) (int, error) {
+	used, err := db.GetDailyUsage(ctx, userID, day)
+	if err != nil {
+		return 0, err
+	}
+
+	return used, ierror.ErrQuotaExceeded
+}
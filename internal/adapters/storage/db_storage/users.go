@@ -0,0 +1,103 @@
+package dbstorage
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/MomsEngineer/urlshortener/internal/entities/user"
+	ierror "github.com/MomsEngineer/urlshortener/internal/errors"
+)
+
+const userColumns = `id, login, password_hash, role, created_at`
+
+// SaveUser inserts the user and moves the links and API keys of
+// fromUserID to it in one transaction.
+func (db *Database) SaveUser(ctx context.Context, u *user.User, fromUserID string) error {
+	tx, err := db.sqlDB.BeginTx(ctx, nil)
+	if err != nil {
+		db.log.Error(ctx, "Failed to create transaction", err)
+		return unavailable(err)
+	}
+	defer tx.Rollback()
+
+	query := "INSERT INTO " + db.usersTable + " (" + userColumns + ") VALUES ($1, $2, $3, $4, $5)"
+	_, err = tx.ExecContext(ctx, query, u.ID, u.Login, u.PasswordHash, string(u.Role),
+		u.CreatedAt)
+	if isViolation(err, userLoginIndex) {
+		return ierror.ErrDuplicate
+	} else if err != nil {
+		db.log.Error(ctx, "Failed to insert user", err)
+		return unavailable(err)
+	}
+
+	if fromUserID != "" {
+		query = "UPDATE " + db.table +
+			" SET user_id = $1 WHERE user_id = $2 AND is_deleted = FALSE"
+		if _, err := tx.ExecContext(ctx, query, u.ID, fromUserID); err != nil {
+			db.log.Error(ctx, "Failed to reassign links", err)
+			return unavailable(err)
+		}
+
+		query = "UPDATE " + db.apiKeysTable + " SET user_id = $1 WHERE user_id = $2"
+		if _, err := tx.ExecContext(ctx, query, u.ID, fromUserID); err != nil {
+			db.log.Error(ctx, "Failed to reassign API keys", err)
+			return unavailable(err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		db.log.Error(ctx, "Failed to commit user", err)
+		return unavailable(err)
+	}
+
+	return nil
+}
+
+func (db *Database) GetUserByLogin(ctx context.Context, login string) (*user.User, error) {
+	query := "SELECT " + userColumns + " FROM " + db.usersTable + " WHERE login = $1"
+	u := &user.User{}
+	err := db.sqlDB.QueryRowContext(ctx, query, login).
+		Scan(&u.ID, &u.Login, &u.PasswordHash, &u.Role, &u.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ierror.ErrNotFound
+	} else if err != nil {
+		db.log.Error(ctx, "Failed to get user", err)
+		return nil, unavailable(err)
+	}
+
+	return u, nil
+}
+
+func (db *Database) GetUserByID(ctx context.Context, id string) (*user.User, error) {
+	query := "SELECT " + userColumns + " FROM " + db.usersTable + " WHERE id = $1"
+	u := &user.User{}
+	err := db.sqlDB.QueryRowContext(ctx, query, id).
+		Scan(&u.ID, &u.Login, &u.PasswordHash, &u.Role, &u.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ierror.ErrNotFound
+	} else if err != nil {
+		db.log.Error(ctx, "Failed to get user", err)
+		return nil, unavailable(err)
+	}
+
+	return u, nil
+}
+
+func (db *Database) SetUserRole(ctx context.Context, userID string, role user.Role) error {
+	query := "UPDATE " + db.usersTable + " SET role = $1 WHERE id = $2"
+	res, err := db.sqlDB.ExecContext(ctx, query, string(role), userID)
+	if err != nil {
+		db.log.Error(ctx, "Failed to set user role", err)
+		return unavailable(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ierror.ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,143 @@
+package filestorage
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/MomsEngineer/urlshortener/internal/entities/link"
+	ierror "github.com/MomsEngineer/urlshortener/internal/errors"
+)
+
+// banEntry is a line of the bans file, a lifted ban is written as a
+// new entry for the same user.
+type banEntry struct {
+	UserID   string    `json:"user_id"`
+	Reason   string    `json:"reason,omitempty"`
+	BannedAt time.Time `json:"banned_at"`
+	Lifted   bool      `json:"lifted,omitempty"`
+}
+
+func (fs *FileStorage) loadBans() error {
+	fs.bans = make(map[string]*banEntry)
+
+	return readSidecar(fs.bansPath, fs.applyBan)
+}
+
+func (fs *FileStorage) applyBan(e *banEntry) {
+	if e.Lifted {
+		delete(fs.bans, e.UserID)
+		return
+	}
+
+	fs.bans[e.UserID] = e
+}
+
+func (fs *FileStorage) ListLinks(ctx context.Context, f link.Filter) ([]*link.Link, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	var res []*link.Link
+	for _, e := range fs.idx.records {
+		if l := e.link(); f.Matches(l) {
+			res = append(res, l)
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].ShortURL < res[j].ShortURL
+	})
+
+	return f.Page(res), nil
+}
+
+func (fs *FileStorage) DisableLink(ctx context.Context, short string, disabled bool) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	e := fs.idx.get(short)
+	if e == nil || e.IsDeleted {
+		return ierror.ErrNotFound
+	}
+
+	if e.IsDisabled == disabled {
+		return nil
+	}
+
+	changed := *e
+	changed.IsDisabled = disabled
+	if err := fs.append(&changed); err != nil {
+		fs.log.Error(ctx, "Failed to save disabled link", err)
+		return err
+	}
+
+	return fs.syncWrite(ctx)
+}
+
+// SetLinkOwner returns ErrDuplicate if the new owner already has a
+// link to the same original URL within the uniqueness scope.
+func (fs *FileStorage) SetLinkOwner(ctx context.Context, short, userID string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	e := fs.idx.get(short)
+	if e == nil || e.IsDeleted {
+		return ierror.ErrNotFound
+	}
+
+	if existing := fs.idx.getByOriginal(userID, e.OriginalURL); existing != nil && existing != e {
+		return ierror.ErrDuplicate
+	}
+
+	changed := *e
+	changed.UserID = userID
+	if err := fs.append(&changed); err != nil {
+		fs.log.Error(ctx, "Failed to save link owner", err)
+		return err
+	}
+
+	return fs.syncWrite(ctx)
+}
+
+// BanUser keeps the reason and time of the first ban.
+func (fs *FileStorage) BanUser(ctx context.Context, userID, reason string, now time.Time) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if _, ok := fs.bans[userID]; ok {
+		return nil
+	}
+
+	e := &banEntry{UserID: userID, Reason: reason, BannedAt: now}
+	if err := fs.appendSidecar(ctx, &fs.bansW, fs.bansPath, e); err != nil {
+		return err
+	}
+
+	fs.applyBan(e)
+	return nil
+}
+
+func (fs *FileStorage) UnbanUser(ctx context.Context, userID string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if _, ok := fs.bans[userID]; !ok {
+		return nil
+	}
+
+	e := &banEntry{UserID: userID, BannedAt: time.Now(), Lifted: true}
+	if err := fs.appendSidecar(ctx, &fs.bansW, fs.bansPath, e); err != nil {
+		return err
+	}
+
+	fs.applyBan(e)
+	return nil
+}
+
+func (fs *FileStorage) IsBanned(ctx context.Context, userID string) (bool, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	_, ok := fs.bans[userID]
+	return ok, nil
+}
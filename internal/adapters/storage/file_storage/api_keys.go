@@ -0,0 +1,138 @@
+package filestorage
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/MomsEngineer/urlshortener/internal/entities/apikey"
+	ierror "github.com/MomsEngineer/urlshortener/internal/errors"
+)
+
+// apiKeyEntry is a line of the keys file, a later entry with the
+// same hash supersedes the earlier one.
+type apiKeyEntry struct {
+	ID        string         `json:"id"`
+	UserID    string         `json:"user_id"`
+	Name      string         `json:"name,omitempty"`
+	Prefix    string         `json:"prefix"`
+	Hash      string         `json:"hash"`
+	Scopes    []apikey.Scope `json:"scopes"`
+	CreatedAt time.Time      `json:"created_at"`
+	RevokedAt *time.Time     `json:"revoked_at,omitempty"`
+}
+
+func newAPIKeyEntry(k *apikey.APIKey) *apiKeyEntry {
+	e := &apiKeyEntry{
+		ID:        k.ID,
+		UserID:    k.UserID,
+		Name:      k.Name,
+		Prefix:    k.Prefix,
+		Hash:      k.Hash,
+		Scopes:    k.Scopes,
+		CreatedAt: k.CreatedAt,
+	}
+
+	if k.IsRevoked() {
+		revokedAt := k.RevokedAt
+		e.RevokedAt = &revokedAt
+	}
+
+	return e
+}
+
+func (e *apiKeyEntry) apiKey() *apikey.APIKey {
+	k := &apikey.APIKey{
+		ID:        e.ID,
+		UserID:    e.UserID,
+		Name:      e.Name,
+		Prefix:    e.Prefix,
+		Hash:      e.Hash,
+		Scopes:    e.Scopes,
+		CreatedAt: e.CreatedAt,
+	}
+
+	if e.RevokedAt != nil {
+		k.RevokedAt = *e.RevokedAt
+	}
+
+	return k
+}
+
+func (fs *FileStorage) loadAPIKeys() error {
+	fs.apiKeys = make(map[string]*apiKeyEntry)
+
+	return readSidecar(fs.apiKeysPath, func(e *apiKeyEntry) {
+		fs.apiKeys[e.Hash] = e
+	})
+}
+
+// appendAPIKey writes the entry and applies it, the caller must hold
+// the write lock.
+func (fs *FileStorage) appendAPIKey(ctx context.Context, e *apiKeyEntry) error {
+	if err := fs.appendSidecar(ctx, &fs.apiKeysW, fs.apiKeysPath, e); err != nil {
+		return err
+	}
+
+	fs.apiKeys[e.Hash] = e
+	return nil
+}
+
+func (fs *FileStorage) SaveAPIKey(ctx context.Context, k *apikey.APIKey) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	return fs.appendAPIKey(ctx, newAPIKeyEntry(k))
+}
+
+func (fs *FileStorage) GetAPIKey(ctx context.Context, hash string) (*apikey.APIKey, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	e, ok := fs.apiKeys[hash]
+	if !ok {
+		return nil, ierror.ErrNotFound
+	}
+
+	return e.apiKey(), nil
+}
+
+func (fs *FileStorage) GetAPIKeysByUser(ctx context.Context, userID string) ([]*apikey.APIKey, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	var res []*apikey.APIKey
+	for _, e := range fs.apiKeys {
+		if e.UserID == userID {
+			res = append(res, e.apiKey())
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].CreatedAt.Before(res[j].CreatedAt)
+	})
+
+	return res, nil
+}
+
+func (fs *FileStorage) RevokeAPIKey(ctx context.Context, userID, id string, now time.Time) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	for _, e := range fs.apiKeys {
+		if e.ID != id || e.UserID != userID {
+			continue
+		}
+
+		if e.RevokedAt != nil {
+			return nil
+		}
+
+		revoked := *e
+		revoked.RevokedAt = &now
+
+		return fs.appendAPIKey(ctx, &revoked)
+	}
+
+	return ierror.ErrNotFound
+}
@@ -0,0 +1,90 @@
+package filestorage
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/MomsEngineer/urlshortener/internal/adapters/logger"
+)
+
+// Compact rewrites the file of a storage that is not in use, see
+// FileStorage.Compact.
+func Compact(path string, opts ...Option) error {
+	fs, err := NewFileStorage(path, opts...)
+	if err != nil {
+		return err
+	}
+
+	if err := fs.Compact(); err != nil {
+		fs.Close()
+		return err
+	}
+
+	return fs.Close()
+}
+
+// Compact rewrites the file with only the current state of every link.
+// Deleted links keep their deletion mark, so their codes still answer
+// as gone and are not reused. The usage file keeps only the counters
+// of today. Requests wait while the files are rewritten.
+func (fs *FileStorage) Compact() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	return fs.compact(context.Background())
+}
+
+func (fs *FileStorage) compact(ctx context.Context) error {
+	tmpPath := fs.path + ".compact"
+	file, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC|os.O_APPEND, 0666)
+	if err != nil {
+		fs.log.Error(ctx, "Failed to create compacted file", err)
+		return err
+	}
+
+	entries := fs.idx.entries()
+	encoder := json.NewEncoder(file)
+	for _, e := range entries {
+		if err := encoder.Encode(e); err != nil {
+			fs.log.Error(ctx, "Failed to write compacted entry", err)
+			file.Close()
+			os.Remove(tmpPath)
+			return err
+		}
+	}
+
+	if err := file.Sync(); err != nil {
+		fs.log.Error(ctx, "Failed to sync compacted file", err)
+		file.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := os.Rename(tmpPath, fs.path); err != nil {
+		fs.log.Error(ctx, "Failed to replace file with compacted one", err)
+		file.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+
+	// The compacted file stays open as the writer, so there is no
+	// reopening that could fail and leave the writer on the replaced
+	// file.
+	fs.w.file.Close()
+	fs.w = &writer{file: file, encoder: encoder}
+
+	lines := fs.idx.lines
+	fs.idx = newIndex(fs.idx.scope)
+	for _, e := range entries {
+		fs.idx.apply(e)
+	}
+
+	fs.log.Info(ctx, "Compacted file storage", logger.Int("from", lines), logger.Int("to", fs.idx.lines))
+
+	if err := fs.rollUsage(ctx, time.Now().UTC().Format(time.DateOnly)); err != nil {
+		return err
+	}
+	return fs.compactUsage(ctx)
+}
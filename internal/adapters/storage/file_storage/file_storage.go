@@ -1,25 +1,41 @@
 package filestorage
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/MomsEngineer/urlshortener/internal/adapters/logger"
+	"github.com/MomsEngineer/urlshortener/internal/entities/click"
 	"github.com/MomsEngineer/urlshortener/internal/entities/link"
+	ierror "github.com/MomsEngineer/urlshortener/internal/errors"
 )
 
-var log = logger.Create(logger.InfoLevel)
-
 type entry struct {
-	UserID      string `json:"user_id"`
-	UUID        string `json:"uuid"`
-	ShortURL    string `json:"short_url"`
-	OriginalURL string `json:"original_url"`
+	UserID      string     `json:"user_id"`
+	UUID        string     `json:"uuid"`
+	ShortURL    string     `json:"short_url"`
+	OriginalURL string     `json:"original_url"`
+	IsDeleted   bool       `json:"is_deleted,omitempty"`
+	IsDisabled  bool       `json:"is_disabled,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+type clickEntry struct {
+	ShortURL  string    `json:"short_url"`
+	Timestamp time.Time `json:"timestamp"`
+	Referrer  string    `json:"referrer,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	IPHash    string    `json:"ip_hash,omitempty"`
 }
 
 type reader struct {
@@ -32,168 +48,651 @@ type writer struct {
 	encoder *json.Encoder
 }
 
+// FileStorage keeps links in an append-only JSON lines file. The file
+// is read once on startup into an in-memory index that serves all
+// lookups, every change is appended to the file as a new entry.
 type FileStorage struct {
-	r       *reader
-	w       *writer
-	path    string
-	counter uint64
+	w           *writer
+	clicks      *writer
+	apiKeysW    *writer
+	usersW      *writer
+	bansW       *writer
+	usageW      *writer
+	secretsW    *writer
+	path        string
+	clicksPath  string
+	apiKeysPath string
+	usersPath   string
+	bansPath    string
+	usagePath   string
+	secretsPath string
+	counter     uint64
+	idx         *index
+	apiKeys     map[string]*apiKeyEntry
+	users       map[string]*userEntry
+	bans        map[string]*banEntry
+	usage       map[string]int
+	usageDay    string
+	usageLines  int
+	secrets     map[string][]byte
+	scope       link.UniqueScope
+	sync        syncPolicy
+	log         *logger.Logger
+	done        chan struct{}
+	closeOnce   sync.Once
+	closeErr    error
+	wg          sync.WaitGroup
+	mu          sync.RWMutex
 }
 
-func NewFileStorage(path string) (*FileStorage, error) {
-	fs := &FileStorage{path: path}
+type Option func(*FileStorage)
 
-	r, err := newReader(path)
-	if err != nil {
-		log.Error("Failed to create reader", err)
+type syncPolicy struct {
+	everyWrite bool
+	interval   time.Duration
+}
+
+func WithUniqueScope(scope link.UniqueScope) Option {
+	return func(fs *FileStorage) {
+		fs.scope = scope
+	}
+}
+
+func WithLogger(log *logger.Logger) Option {
+	return func(fs *FileStorage) {
+		fs.log = log
+	}
+}
+
+// WithSyncEveryWrite flushes the file to disk after every change.
+func WithSyncEveryWrite() Option {
+	return func(fs *FileStorage) {
+		fs.sync = syncPolicy{everyWrite: true}
+	}
+}
+
+// WithSyncInterval flushes the file to disk periodically, changes made
+// since the last flush may be lost on a crash.
+func WithSyncInterval(d time.Duration) Option {
+	return func(fs *FileStorage) {
+		fs.sync = syncPolicy{interval: d}
+	}
+}
+
+// SyncOption parses the sync mode: "none" leaves flushing to the OS,
+// "always" flushes after every change and a duration such as "1s"
+// flushes periodically.
+func SyncOption(mode string) (Option, error) {
+	switch mode {
+	case "", "none":
+		return func(*FileStorage) {}, nil
+	case "always":
+		return WithSyncEveryWrite(), nil
+	}
+
+	d, err := time.ParseDuration(mode)
+	if err != nil || d <= 0 {
+		return nil, fmt.Errorf("invalid file sync mode %q", mode)
+	}
+
+	return WithSyncInterval(d), nil
+}
+
+func NewFileStorage(path string, opts ...Option) (*FileStorage, error) {
+	fs := &FileStorage{
+		path:        path,
+		clicksPath:  sidecarPath(path, "clicks"),
+		apiKeysPath: sidecarPath(path, "keys"),
+		usersPath:   sidecarPath(path, "users"),
+		bansPath:    sidecarPath(path, "bans"),
+		usagePath:   sidecarPath(path, "usage"),
+		secretsPath: sidecarPath(path, "secrets"),
+		log:         logger.NewNop(),
+		done:        make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(fs)
+	}
+	fs.idx = newIndex(fs.scope)
+
+	ctx := context.Background()
+	if err := fs.load(ctx); err != nil {
+		fs.log.Error(ctx, "Failed to load file", err)
+		return nil, err
+	}
+
+	if err := fs.loadAPIKeys(); err != nil {
+		fs.log.Error(ctx, "Failed to load API keys file", err)
+		return nil, err
+	}
+
+	if err := fs.loadUsers(); err != nil {
+		fs.log.Error(ctx, "Failed to load users file", err)
+		return nil, err
+	}
+
+	if err := fs.loadBans(); err != nil {
+		fs.log.Error(ctx, "Failed to load bans file", err)
+		return nil, err
+	}
+
+	if err := fs.loadUsage(); err != nil {
+		fs.log.Error(ctx, "Failed to load usage file", err)
+		return nil, err
+	}
+
+	if err := fs.loadSecrets(); err != nil {
+		fs.log.Error(ctx, "Failed to load secrets file", err)
 		return nil, err
 	}
-	fs.r = r
 
 	w, err := newWriter(path)
 	if err != nil {
-		fs.Close()
-		log.Error("Failed to create writer", err)
+		fs.log.Error(ctx, "Failed to create writer", err)
 		return nil, err
 	}
 	fs.w = w
 
-	var lastEntry entry
+	if fs.sync.interval > 0 {
+		fs.wg.Add(1)
+		go fs.syncLoop()
+	}
+
+	return fs, nil
+}
+
+func (fs *FileStorage) load(ctx context.Context) error {
+	r, err := newReader(fs.path)
+	if err != nil {
+		return err
+	}
+	defer r.file.Close()
+
 	for {
-		entry, err := fs.r.readEntry()
+		e, err := r.readEntry()
 		if err == io.EOF {
 			break
 		} else if err != nil {
-			log.Error("Failed to read entry", err)
-			return nil, err
+			fs.log.Error(ctx, "Failed to read entry", err)
+			return err
 		}
-		lastEntry = *entry
-	}
 
-	if lastEntry.UUID != "" {
-		counter, err := strconv.ParseUint(lastEntry.UUID, 10, 64)
-		if err != nil {
-			log.Error("Failed to parse counter from UUID", err)
-			return nil, err
+		if err := fs.updateCounter(ctx, e); err != nil {
+			return err
 		}
+		fs.idx.apply(e)
+	}
+
+	return nil
+}
+
+func (fs *FileStorage) updateCounter(ctx context.Context, e *entry) error {
+	counter, err := strconv.ParseUint(e.UUID, 10, 64)
+	if err != nil {
+		fs.log.Error(ctx, "Failed to parse counter from UUID", err)
+		return err
+	}
+
+	if counter > fs.counter {
 		fs.counter = counter
 	}
 
-	return fs, nil
+	return nil
 }
 
-func (fs *FileStorage) SaveLinksBatch(_ context.Context, ls []*link.Link) error {
+// SaveLinksBatch saves either all links or none of them: every link is
+// checked before the new entries are written with one write. Links with
+// an already shortened original URL get the existing short URL.
+func (fs *FileStorage) SaveLinksBatch(ctx context.Context, ls []*link.Link) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	now := time.Now()
+	var es []*entry
+	shorts := make(map[string]struct{}, len(ls))
+	keys := make(map[string]string, len(ls))
 	for _, l := range ls {
-		e := &entry{
-			UserID:      l.UserID,
-			UUID:        strconv.FormatUint(uint64(fs.counter+1), 10),
-			ShortURL:    l.ShortURL,
-			OriginalURL: l.OriginalURL,
+		key := fs.scope.Key(l.UserID, l.OriginalURL)
+		if short, ok := keys[key]; ok {
+			l.ShortURL = short
+			continue
 		}
 
-		if err := fs.w.writeEntry(e); err != nil {
-			log.Error("Failed to save link", err)
-			return err
+		live, expired := fs.duplicateOf(l, now)
+		if live != nil {
+			l.ShortURL = live.ShortURL
+			continue
 		}
 
-		fs.counter++
+		if _, ok := shorts[l.ShortURL]; ok || fs.idx.get(l.ShortURL) != nil {
+			return ierror.ErrAliasTaken
+		}
+
+		if expired != nil {
+			es = append(es, deletionMark(expired))
+		}
+		shorts[l.ShortURL] = struct{}{}
+		keys[key] = l.ShortURL
+		es = append(es, newEntry(l))
 	}
 
-	return nil
+	if err := fs.appendAll(es); err != nil {
+		fs.log.Error(ctx, "Failed to save links", err)
+		return err
+	}
+
+	return fs.syncWrite(ctx)
 }
 
-func (fs *FileStorage) SaveLink(_ context.Context, l *link.Link) error {
-	e := &entry{
-		UserID:      l.UserID,
-		UUID:        strconv.FormatUint(uint64(fs.counter+1), 10),
-		ShortURL:    l.ShortURL,
-		OriginalURL: l.OriginalURL,
+// SaveLink returns ErrDuplicate with the existing short URL
+// if the original URL is already shortened.
+func (fs *FileStorage) SaveLink(ctx context.Context, l *link.Link) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	live, expired := fs.duplicateOf(l, time.Now())
+	if live != nil {
+		l.ShortURL = live.ShortURL
+		return ierror.ErrDuplicate
 	}
 
-	if err := fs.w.writeEntry(e); err != nil {
-		log.Error("Failed to save link", err)
+	if fs.idx.get(l.ShortURL) != nil {
+		return ierror.ErrAliasTaken
+	}
+
+	es := []*entry{newEntry(l)}
+	if expired != nil {
+		es = []*entry{deletionMark(expired), es[0]}
+	}
+	if err := fs.appendAll(es); err != nil {
+		fs.log.Error(ctx, "Failed to save link", err)
 		return err
 	}
 
-	fs.counter++
+	return fs.syncWrite(ctx)
+}
+
+// duplicateOf returns the live entry that l would duplicate, or the
+// expired one that must be marked deleted, as the reaper would, before
+// its original URL can be shortened again. The caller must hold a lock.
+func (fs *FileStorage) duplicateOf(l *link.Link, now time.Time) (live, expired *entry) {
+	e := fs.idx.getByOriginal(l.UserID, l.OriginalURL)
+	if e == nil || e.ExpiresAt == nil || now.Before(*e.ExpiresAt) {
+		return e, nil
+	}
+
+	return nil, e
+}
+
+func deletionMark(e *entry) *entry {
+	mark := *e
+	mark.IsDeleted = true
+	return &mark
+}
+
+func (fs *FileStorage) GetLink(ctx context.Context, l *link.Link) error {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	e := fs.idx.get(l.ShortURL)
+	if e == nil {
+		return ierror.ErrNotFound
+	}
+
+	l.UserID = e.UserID
+	l.OriginalURL = e.OriginalURL
+	l.IsDeleted = e.IsDeleted
+	l.IsDisabled = e.IsDisabled
+	if e.ExpiresAt != nil {
+		l.ExpiresAt = *e.ExpiresAt
+	}
 
 	return nil
 }
 
-func (fs *FileStorage) GetLink(_ context.Context, l *link.Link) error {
-	_, err := fs.r.file.Seek(0, 0)
-	if err != nil {
-		log.Error("Failed to seek to the beginning of the file", err)
+func (fs *FileStorage) GetLinksByUser(ctx context.Context, userID string) (map[string]string, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	res := make(map[string]string)
+	for short := range fs.idx.byUser[userID] {
+		res[short] = fs.idx.get(short).OriginalURL
+	}
+
+	return res, nil
+}
+
+// CountLinks reads the counts kept by the index.
+func (fs *FileStorage) CountLinks(ctx context.Context) (int, int, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	return fs.idx.live, len(fs.idx.byUser), nil
+}
+
+// DeleteLinks appends a deletion mark for every link owned by the
+// requesting user, the original entries stay until compaction. Every
+// request is checked on its own, a batch may ask to delete the same
+// code for several users.
+func (fs *FileStorage) DeleteLinks(ctx context.Context, ls []*link.Link) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	var marks []*entry
+	marked := make(map[string]struct{}, len(ls))
+	for _, l := range ls {
+		if _, ok := marked[l.ShortURL]; ok {
+			continue
+		}
+
+		e := fs.idx.get(l.ShortURL)
+		if e != nil && !e.IsDeleted && e.UserID == l.UserID {
+			marks = append(marks, e)
+			marked[l.ShortURL] = struct{}{}
+		}
+	}
+
+	return fs.markDeleted(ctx, marks)
+}
+
+func (fs *FileStorage) DeleteExpiredLinks(ctx context.Context, now time.Time) (int64, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	var marks []*entry
+	for _, e := range fs.idx.records {
+		if !e.IsDeleted && e.ExpiresAt != nil && !now.Before(*e.ExpiresAt) {
+			marks = append(marks, e)
+		}
+	}
+
+	if err := fs.markDeleted(ctx, marks); err != nil {
+		return 0, err
+	}
+
+	return int64(len(marks)), nil
+}
+
+func (fs *FileStorage) markDeleted(ctx context.Context, es []*entry) error {
+	if len(es) == 0 {
+		return nil
+	}
+
+	for _, e := range es {
+		if err := fs.append(deletionMark(e)); err != nil {
+			fs.log.Error(ctx, "Failed to save deletion mark", err)
+			return err
+		}
+	}
+
+	if err := fs.syncWrite(ctx); err != nil {
 		return err
 	}
 
-	fs.r.decoder = json.NewDecoder(fs.r.file)
+	if fs.idx.needsCompaction() {
+		return fs.compact(ctx)
+	}
+
+	return nil
+}
+
+// append writes the entry to the file and applies it to the index,
+// the caller must hold the write lock.
+func (fs *FileStorage) append(e *entry) error {
+	return fs.appendAll([]*entry{e})
+}
+
+// appendAll writes the entries with a single write and applies them to
+// the index only once the write succeeded, the caller must hold the
+// write lock.
+func (fs *FileStorage) appendAll(es []*entry) error {
+	if len(es) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for i, e := range es {
+		e.UUID = strconv.FormatUint(fs.counter+uint64(i)+1, 10)
+		if err := encoder.Encode(e); err != nil {
+			return err
+		}
+	}
+
+	if _, err := fs.w.file.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("%w: %v", ierror.ErrStorageUnavailable, err)
+	}
+
+	for _, e := range es {
+		fs.counter++
+		fs.idx.apply(e)
+	}
+
+	return nil
+}
+
+func (fs *FileStorage) syncWrite(ctx context.Context) error {
+	if !fs.sync.everyWrite {
+		return nil
+	}
+
+	if err := fs.w.file.Sync(); err != nil {
+		fs.log.Error(ctx, "Failed to sync file", err)
+		return fmt.Errorf("%w: %v", ierror.ErrStorageUnavailable, err)
+	}
+
+	return nil
+}
+
+func (fs *FileStorage) syncLoop() {
+	defer fs.wg.Done()
+
+	ticker := time.NewTicker(fs.sync.interval)
+	defer ticker.Stop()
 
 	for {
-		entry, err := fs.r.readEntry()
-		if err == io.EOF {
-			break
-		} else if err != nil {
-			log.Error("Failed to read entry", err)
+		select {
+		case <-ticker.C:
+			fs.mu.Lock()
+			if err := fs.w.file.Sync(); err != nil {
+				fs.log.Error(context.Background(), "Failed to sync file", err)
+			}
+			fs.mu.Unlock()
+		case <-fs.done:
+			return
+		}
+	}
+}
+
+// SaveClicks appends clicks to a separate file next to the links file,
+// the file is created with the first click.
+func (fs *FileStorage) SaveClicks(ctx context.Context, clicks []*click.Click) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.clicks == nil {
+		w, err := newWriter(fs.clicksPath)
+		if err != nil {
+			fs.log.Error(ctx, "Failed to create clicks writer", err)
 			return err
 		}
+		fs.clicks = w
+	}
+
+	for _, c := range clicks {
+		e := &clickEntry{
+			ShortURL:  c.ShortURL,
+			Timestamp: c.Timestamp,
+			Referrer:  c.Referrer,
+			UserAgent: c.UserAgent,
+			IPHash:    c.IPHash,
+		}
 
-		if entry.ShortURL == l.ShortURL {
-			l.OriginalURL = entry.OriginalURL
-			return nil
+		if err := fs.clicks.encoder.Encode(e); err != nil {
+			fs.log.Error(ctx, "Failed to save click", err)
+			return err
 		}
 	}
 
-	return errors.New("not found")
+	return nil
 }
 
-func (fs *FileStorage) GetLinksByUser(ctx context.Context, userID string) (map[string]string, error) {
-	res := make(map[string]string)
-
-	_, err := fs.r.file.Seek(0, 0)
-	if err != nil {
-		log.Error("Failed to seek to the beginning of the file", err)
+// GetClickStats reads the clicks file and aggregates the clicks of
+// the link as it goes.
+func (fs *FileStorage) GetClickStats(ctx context.Context, short string) (*click.Stats, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	file, err := os.Open(fs.clicksPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return click.NewStats(nil), nil
+	} else if err != nil {
+		fs.log.Error(ctx, "Failed to open clicks file", err)
 		return nil, err
 	}
+	defer file.Close()
 
-	fs.r.decoder = json.NewDecoder(fs.r.file)
-
+	var clicks []*click.Click
+	decoder := json.NewDecoder(file)
 	for {
-		entry, err := fs.r.readEntry()
+		e := &clickEntry{}
+		err := decoder.Decode(e)
 		if err == io.EOF {
 			break
 		} else if err != nil {
-			log.Error("Failed to read entry", err)
+			fs.log.Error(ctx, "Failed to read click", err)
 			return nil, err
 		}
 
-		if entry.UserID == userID {
-			res[entry.ShortURL] = entry.OriginalURL
+		if e.ShortURL == short {
+			clicks = append(clicks, &click.Click{
+				ShortURL:  e.ShortURL,
+				Timestamp: e.Timestamp,
+				IPHash:    e.IPHash,
+			})
 		}
 	}
 
-	return res, nil
+	return click.NewStats(clicks), nil
 }
 
-func (fs *FileStorage) Ping(_ context.Context) error {
-	if fs.r == nil || fs.w == nil {
-		log.Error("Reader or writer is not initialized", nil)
-		return fmt.Errorf("reader or writer is not initialized")
+func (fs *FileStorage) Ping(ctx context.Context) error {
+	if fs.w == nil {
+		fs.log.Error(ctx, "Writer is not initialized", nil)
+		return fmt.Errorf("%w: writer is not initialized", ierror.ErrStorageUnavailable)
 	}
 
 	return nil
 }
 
+// CheckWritable creates, writes and removes a file next to the
+// storage file, so a full or read-only disk is found before a write
+// of a user fails.
+func (fs *FileStorage) CheckWritable(_ context.Context) error {
+	f, err := os.CreateTemp(filepath.Dir(fs.path), ".healthcheck-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, errW := f.Write([]byte("ok\n"))
+	errC := f.Close()
+
+	return errors.Join(errW, errC)
+}
+
+// Close flushes and closes the files, later calls return the result of
+// the first one.
 func (fs *FileStorage) Close() error {
-	errR := fs.r.file.Close()
+	fs.closeOnce.Do(func() {
+		fs.closeErr = fs.close()
+	})
+
+	return fs.closeErr
+}
+
+func (fs *FileStorage) close() error {
+	close(fs.done)
+	fs.wg.Wait()
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	errS := fs.w.file.Sync()
 	errW := fs.w.file.Close()
 
-	if errR != nil || errW != nil {
-		return fmt.Errorf("failed to close reader: %v, failed to close writer: %v",
-			errR, errW)
+	var errC, errK, errU, errB, errQ, errT error
+	if fs.clicks != nil {
+		errC = fs.clicks.file.Close()
+	}
+	if fs.apiKeysW != nil {
+		errK = fs.apiKeysW.file.Close()
+	}
+	if fs.usersW != nil {
+		errU = fs.usersW.file.Close()
+	}
+	if fs.bansW != nil {
+		errB = fs.bansW.file.Close()
+	}
+	if fs.usageW != nil {
+		errQ = fs.usageW.file.Close()
+	}
+	if fs.secretsW != nil {
+		errT = fs.secretsW.file.Close()
+	}
+
+	if errS != nil || errW != nil || errC != nil || errK != nil || errU != nil || errB != nil ||
+		errQ != nil || errT != nil {
+		return fmt.Errorf("failed to sync writer: %v, failed to close writer: %v, "+
+			"failed to close clicks writer: %v, failed to close API keys writer: %v, "+
+			"failed to close users writer: %v, failed to close bans writer: %v, "+
+			"failed to close usage writer: %v, failed to close secrets writer: %v",
+			errS, errW, errC, errK, errU, errB, errQ, errT)
 	}
 	return nil
 }
 
+// sidecarPath derives the name of a file kept next to the links file,
+// e.g. short-url-db.json becomes short-url-db.clicks.json.
+func sidecarPath(path, kind string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + kind + ext
+}
+
+func newEntry(l *link.Link) *entry {
+	e := &entry{
+		UserID:      l.UserID,
+		ShortURL:    l.ShortURL,
+		OriginalURL: l.OriginalURL,
+		IsDeleted:   l.IsDeleted,
+		IsDisabled:  l.IsDisabled,
+	}
+
+	if !l.ExpiresAt.IsZero() {
+		expiresAt := l.ExpiresAt
+		e.ExpiresAt = &expiresAt
+	}
+
+	return e
+}
+
+func (e *entry) link() *link.Link {
+	l := &link.Link{
+		UserID:      e.UserID,
+		ShortURL:    e.ShortURL,
+		OriginalURL: e.OriginalURL,
+		IsDeleted:   e.IsDeleted,
+		IsDisabled:  e.IsDisabled,
+	}
+
+	if e.ExpiresAt != nil {
+		l.ExpiresAt = *e.ExpiresAt
+	}
+
+	return l
+}
+
 func newReader(fileName string) (*reader, error) {
 	file, err := os.OpenFile(fileName, os.O_RDONLY|os.O_CREATE, 0666)
 	if err != nil {
@@ -227,7 +726,3 @@ func newWriter(fileName string) (*writer, error) {
 		encoder: json.NewEncoder(file),
 	}, nil
 }
-
-func (w *writer) writeEntry(e *entry) error {
-	return w.encoder.Encode(e)
-}
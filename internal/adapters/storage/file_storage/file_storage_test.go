@@ -1,13 +1,25 @@
 package filestorage_test
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	fs "github.com/MomsEngineer/urlshortener/internal/adapters/storage/file_storage"
+	"github.com/MomsEngineer/urlshortener/internal/adapters/storage/storetest"
+	"github.com/MomsEngineer/urlshortener/internal/entities/apikey"
+	"github.com/MomsEngineer/urlshortener/internal/entities/click"
 	"github.com/MomsEngineer/urlshortener/internal/entities/link"
+	"github.com/MomsEngineer/urlshortener/internal/entities/user"
+	ierror "github.com/MomsEngineer/urlshortener/internal/errors"
+	"github.com/MomsEngineer/urlshortener/internal/usecases/storage"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -74,3 +86,631 @@ func TestFileStorage(t *testing.T) {
 		})
 	}
 }
+
+func TestFileStorageDeleteLinks(t *testing.T) {
+	path := "test_delete.json"
+	store, err := fs.NewFileStorage(path)
+	require.NoError(t, err)
+
+	defer func() {
+		if store != nil {
+			store.Close()
+		}
+		os.Remove(path)
+	}()
+
+	for _, l := range []*link.Link{
+		{UserID: "owner", ShortURL: "example", OriginalURL: "https://example.com"},
+		{UserID: "owner", ShortURL: "test", OriginalURL: "https://test.com"},
+	} {
+		require.NoError(t, store.SaveLink(context.TODO(), l))
+	}
+
+	err = store.DeleteLinks(context.TODO(), []*link.Link{
+		{UserID: "owner", ShortURL: "example"},
+		{UserID: "stranger", ShortURL: "test"},
+	})
+	require.NoError(t, err)
+
+	l, err := link.NewLink("owner", "example", "")
+	require.NoError(t, err)
+	require.NoError(t, store.GetLink(context.TODO(), l))
+	assert.True(t, l.IsDeleted, "link deleted by its owner must be marked")
+
+	l, err = link.NewLink("owner", "test", "")
+	require.NoError(t, err)
+	require.NoError(t, store.GetLink(context.TODO(), l))
+	assert.False(t, l.IsDeleted, "link deleted by another user must be kept")
+
+	links, err := store.GetLinksByUser(context.TODO(), "owner")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"test": "https://test.com"}, links)
+
+	// The owner's request is not lost among requests of other users
+	// for the same code.
+	err = store.DeleteLinks(context.TODO(), []*link.Link{
+		{UserID: "owner", ShortURL: "test"},
+		{UserID: "stranger", ShortURL: "test"},
+		{UserID: "owner", ShortURL: "test"},
+	})
+	require.NoError(t, err)
+
+	l, err = link.NewLink("owner", "test", "")
+	require.NoError(t, err)
+	require.NoError(t, store.GetLink(context.TODO(), l))
+	assert.True(t, l.IsDeleted)
+}
+
+func TestFileStorageClicks(t *testing.T) {
+	path := "test_clicks.json"
+	store, err := fs.NewFileStorage(path)
+	require.NoError(t, err)
+
+	defer func() {
+		if store != nil {
+			store.Close()
+		}
+		os.Remove(path)
+		os.Remove("test_clicks.clicks.json")
+	}()
+
+	stats, err := store.GetClickStats(context.TODO(), "example")
+	require.NoError(t, err)
+	assert.Equal(t, 0, stats.Total)
+
+	err = store.SaveClicks(context.TODO(), []*click.Click{
+		click.NewClick("example", "https://referrer.com", "agent", "first"),
+		click.NewClick("test", "", "agent", "second"),
+		click.NewClick("example", "", "agent", "third"),
+	})
+	require.NoError(t, err)
+
+	stats, err = store.GetClickStats(context.TODO(), "example")
+	require.NoError(t, err)
+	assert.Equal(t, 2, stats.Total)
+	assert.Equal(t, 2, stats.Unique)
+}
+
+func TestFileStorageDeleteExpiredLinks(t *testing.T) {
+	path := "test_expired.json"
+	store, err := fs.NewFileStorage(path)
+	require.NoError(t, err)
+
+	defer func() {
+		if store != nil {
+			store.Close()
+		}
+		os.Remove(path)
+	}()
+
+	now := time.Now()
+	for _, l := range []*link.Link{
+		{UserID: "owner", ShortURL: "expired", OriginalURL: "https://example.com",
+			ExpiresAt: now.Add(-time.Minute)},
+		{UserID: "owner", ShortURL: "active", OriginalURL: "https://test.com",
+			ExpiresAt: now.Add(time.Hour)},
+		{UserID: "owner", ShortURL: "forever", OriginalURL: "https://forever.com"},
+	} {
+		require.NoError(t, store.SaveLink(context.TODO(), l))
+	}
+
+	n, err := store.DeleteExpiredLinks(context.TODO(), now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	n, err = store.DeleteExpiredLinks(context.TODO(), now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), n, "expired links must be marked only once")
+
+	l, err := link.NewLink("owner", "active", "")
+	require.NoError(t, err)
+	require.NoError(t, store.GetLink(context.TODO(), l))
+	assert.WithinDuration(t, now.Add(time.Hour), l.ExpiresAt, time.Second)
+
+	links, err := store.GetLinksByUser(context.TODO(), "owner")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"active":  "https://test.com",
+		"forever": "https://forever.com",
+	}, links)
+}
+
+func TestFileStorageSaveTakenShortLink(t *testing.T) {
+	path := "test_taken.json"
+	store, err := fs.NewFileStorage(path)
+	require.NoError(t, err)
+
+	defer func() {
+		if store != nil {
+			store.Close()
+		}
+		os.Remove(path)
+	}()
+
+	l := &link.Link{UserID: "userID", ShortURL: "spring-sale", OriginalURL: "https://example.com"}
+	require.NoError(t, store.SaveLink(context.TODO(), l))
+
+	l = &link.Link{UserID: "userID", ShortURL: "spring-sale", OriginalURL: "https://test.com"}
+	require.ErrorIs(t, store.SaveLink(context.TODO(), l), ierror.ErrAliasTaken)
+
+	batch := []*link.Link{
+		{UserID: "userID", ShortURL: "fresh", OriginalURL: "https://fresh.com"},
+		{UserID: "userID", ShortURL: "fresh", OriginalURL: "https://test.com"},
+	}
+	require.ErrorIs(t, store.SaveLinksBatch(context.TODO(), batch), ierror.ErrAliasTaken)
+
+	links, err := store.GetLinksByUser(context.TODO(), "userID")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"spring-sale": "https://example.com"}, links)
+}
+
+func TestFileStorageRejectedBatchWritesNothing(t *testing.T) {
+	path := "test_rejected_batch.json"
+	store, err := fs.NewFileStorage(path)
+	require.NoError(t, err)
+
+	defer func() {
+		if store != nil {
+			store.Close()
+		}
+		os.Remove(path)
+	}()
+
+	for _, l := range []*link.Link{
+		{UserID: "userID", ShortURL: "expired", OriginalURL: "https://example.com",
+			ExpiresAt: time.Now().Add(-time.Minute)},
+		{UserID: "userID", ShortURL: "taken", OriginalURL: "https://taken.com"},
+	} {
+		require.NoError(t, store.SaveLink(context.TODO(), l))
+	}
+	before, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	// The expired duplicate comes before the taken code.
+	batch := []*link.Link{
+		{UserID: "userID", ShortURL: "again", OriginalURL: "https://example.com"},
+		{UserID: "userID", ShortURL: "taken", OriginalURL: "https://test.com"},
+	}
+	require.ErrorIs(t, store.SaveLinksBatch(context.TODO(), batch), ierror.ErrAliasTaken)
+
+	after, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, string(before), string(after), "a rejected batch must not write anything")
+
+	l, err := link.NewLink("userID", "expired", "")
+	require.NoError(t, err)
+	require.NoError(t, store.GetLink(context.TODO(), l))
+	assert.False(t, l.IsDeleted)
+
+	batch[1].ShortURL = "fresh"
+	require.NoError(t, store.SaveLinksBatch(context.TODO(), batch))
+	require.NoError(t, store.Close())
+
+	store, err = fs.NewFileStorage(path)
+	require.NoError(t, err)
+	links, err := store.GetLinksByUser(context.TODO(), "userID")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"again": "https://example.com",
+		"fresh": "https://test.com",
+		"taken": "https://taken.com",
+	}, links)
+}
+
+func TestFileStorageReopen(t *testing.T) {
+	path := "test_reopen.json"
+	defer os.Remove(path)
+
+	store, err := fs.NewFileStorage(path, fs.WithSyncEveryWrite())
+	require.NoError(t, err)
+
+	for _, l := range []*link.Link{
+		{UserID: "owner", ShortURL: "example", OriginalURL: "https://example.com"},
+		{UserID: "owner", ShortURL: "test", OriginalURL: "https://test.com"},
+	} {
+		require.NoError(t, store.SaveLink(context.TODO(), l))
+	}
+	require.NoError(t, store.DeleteLinks(context.TODO(), []*link.Link{
+		{UserID: "owner", ShortURL: "example"},
+	}))
+	require.NoError(t, store.Close())
+
+	store, err = fs.NewFileStorage(path)
+	require.NoError(t, err)
+	defer store.Close()
+
+	l, err := link.NewLink("owner", "example", "")
+	require.NoError(t, err)
+	require.NoError(t, store.GetLink(context.TODO(), l))
+	assert.True(t, l.IsDeleted, "deletion must survive a restart")
+
+	links, err := store.GetLinksByUser(context.TODO(), "owner")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"test": "https://test.com"}, links)
+
+	l = &link.Link{UserID: "owner", ShortURL: "example", OriginalURL: "https://other.com"}
+	require.ErrorIs(t, store.SaveLink(context.TODO(), l), ierror.ErrAliasTaken)
+}
+
+func TestFileStorageCompact(t *testing.T) {
+	path := "test_compact.json"
+	defer os.Remove(path)
+
+	store, err := fs.NewFileStorage(path)
+	require.NoError(t, err)
+
+	for _, l := range []*link.Link{
+		{UserID: "owner", ShortURL: "example", OriginalURL: "https://example.com"},
+		{UserID: "owner", ShortURL: "test", OriginalURL: "https://test.com"},
+		{UserID: "owner", ShortURL: "third", OriginalURL: "https://third.com"},
+	} {
+		require.NoError(t, store.SaveLink(context.TODO(), l))
+	}
+	require.NoError(t, store.DeleteLinks(context.TODO(), []*link.Link{
+		{UserID: "owner", ShortURL: "test"},
+	}))
+
+	require.NoError(t, store.Compact())
+
+	l := &link.Link{UserID: "owner", ShortURL: "fourth", OriginalURL: "https://fourth.com"}
+	require.NoError(t, store.SaveLink(context.TODO(), l), "writes must go to the compacted file")
+	require.NoError(t, store.Close())
+
+	require.NoError(t, fs.Compact(path))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, 4, strings.Count(string(data), "\n"), "only the current entries must be kept")
+
+	store, err = fs.NewFileStorage(path)
+	require.NoError(t, err)
+	defer store.Close()
+
+	deleted, err := link.NewLink("owner", "test", "")
+	require.NoError(t, err)
+	require.NoError(t, store.GetLink(context.TODO(), deleted))
+	assert.True(t, deleted.IsDeleted, "deletion marks must survive compaction")
+
+	l = &link.Link{UserID: "other", ShortURL: "test", OriginalURL: "https://other.com"}
+	require.ErrorIs(t, store.SaveLink(context.TODO(), l), ierror.ErrAliasTaken)
+
+	links, err := store.GetLinksByUser(context.TODO(), "owner")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"example": "https://example.com",
+		"third":   "https://third.com",
+		"fourth":  "https://fourth.com",
+	}, links)
+}
+
+func TestFileStorageCloseTwice(t *testing.T) {
+	store, err := fs.NewFileStorage(filepath.Join(t.TempDir(), "close.json"), fs.WithSyncInterval(time.Hour))
+	require.NoError(t, err)
+
+	require.NoError(t, store.Close())
+	assert.NotPanics(t, func() { store.Close() })
+}
+
+func TestFileStorageConcurrency(t *testing.T) {
+	path := "test_concurrency.json"
+	store, err := fs.NewFileStorage(path)
+	require.NoError(t, err)
+
+	defer func() {
+		store.Close()
+		os.Remove(path)
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			short := "short" + strconv.Itoa(i)
+			l := &link.Link{UserID: "owner", ShortURL: short, OriginalURL: "https://example.com/" + short}
+			assert.NoError(t, store.SaveLink(context.TODO(), l))
+
+			got := &link.Link{ShortURL: short}
+			assert.NoError(t, store.GetLink(context.TODO(), got))
+			assert.Equal(t, l.OriginalURL, got.OriginalURL)
+
+			_, err := store.GetLinksByUser(context.TODO(), "owner")
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+
+	links, err := store.GetLinksByUser(context.TODO(), "owner")
+	require.NoError(t, err)
+	assert.Len(t, links, 20)
+}
+
+func TestSyncOption(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    string
+		wantErr bool
+	}{
+		{name: "Default mode", mode: "", wantErr: false},
+		{name: "No sync", mode: "none", wantErr: false},
+		{name: "Sync every write", mode: "always", wantErr: false},
+		{name: "Sync interval", mode: "500ms", wantErr: false},
+		{name: "Negative interval", mode: "-1s", wantErr: true},
+		{name: "Unknown mode", mode: "sometimes", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opt, err := fs.SyncOption(tt.mode)
+
+			if tt.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				assert.NotNil(t, opt)
+			}
+		})
+	}
+}
+
+func TestFileStorageSaveDuplicateLink(t *testing.T) {
+	tests := []struct {
+		name      string
+		scope     link.UniqueScope
+		userID    string
+		wantErr   error
+		wantShort string
+	}{
+		{
+			name:      "Another user with global uniqueness",
+			scope:     link.UniqueGlobal,
+			userID:    "stranger",
+			wantErr:   ierror.ErrDuplicate,
+			wantShort: "example",
+		},
+		{
+			name:      "Same user with per-user uniqueness",
+			scope:     link.UniquePerUser,
+			userID:    "owner",
+			wantErr:   ierror.ErrDuplicate,
+			wantShort: "example",
+		},
+		{
+			name:      "Another user with per-user uniqueness",
+			scope:     link.UniquePerUser,
+			userID:    "stranger",
+			wantErr:   nil,
+			wantShort: "other",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := "test_duplicate.json"
+			store, err := fs.NewFileStorage(path, fs.WithUniqueScope(tt.scope))
+			require.NoError(t, err)
+
+			defer func() {
+				store.Close()
+				os.Remove(path)
+			}()
+
+			l := &link.Link{UserID: "owner", ShortURL: "example", OriginalURL: "https://example.com"}
+			require.NoError(t, store.SaveLink(context.TODO(), l))
+
+			l = &link.Link{UserID: tt.userID, ShortURL: "other", OriginalURL: "https://example.com"}
+			err = store.SaveLink(context.TODO(), l)
+			require.Equal(t, tt.wantErr, err)
+			assert.Equal(t, tt.wantShort, l.ShortURL)
+
+			batch := []*link.Link{
+				{UserID: tt.userID, ShortURL: "batch1", OriginalURL: "https://example.com"},
+				{UserID: tt.userID, ShortURL: "batch2", OriginalURL: "https://test.com"},
+				{UserID: tt.userID, ShortURL: "batch3", OriginalURL: "https://test.com"},
+			}
+			require.NoError(t, store.SaveLinksBatch(context.TODO(), batch))
+			assert.Equal(t, tt.wantShort, batch[0].ShortURL)
+			assert.Equal(t, "batch2", batch[2].ShortURL, "duplicates inside a batch must share a link")
+		})
+	}
+}
+
+func TestFileStorageConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) storage.StoreInterface {
+		store, err := fs.NewFileStorage(filepath.Join(t.TempDir(), "links.json"))
+		require.NoError(t, err)
+
+		return store
+	})
+}
+
+func TestFileStorageAPIKeysReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "links.json")
+	store, err := fs.NewFileStorage(path)
+	require.NoError(t, err)
+
+	_, k, err := apikey.New("owner", "ci", nil)
+	require.NoError(t, err)
+	require.NoError(t, store.SaveAPIKey(context.TODO(), k))
+	require.NoError(t, store.RevokeAPIKey(context.TODO(), "owner", k.ID, time.Now()))
+	require.NoError(t, store.Close())
+
+	_, err = os.Stat(filepath.Join(filepath.Dir(path), "links.keys.json"))
+	require.NoError(t, err, "keys must be kept next to the links file")
+
+	store, err = fs.NewFileStorage(path)
+	require.NoError(t, err)
+	defer store.Close()
+
+	got, err := store.GetAPIKey(context.TODO(), k.Hash)
+	require.NoError(t, err)
+	assert.Equal(t, k.ID, got.ID)
+	assert.True(t, got.IsRevoked(), "revocation must survive a restart")
+
+	keys, err := store.GetAPIKeysByUser(context.TODO(), "owner")
+	require.NoError(t, err)
+	assert.Len(t, keys, 1)
+}
+
+func TestFileStorageUsersReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "links.json")
+	store, err := fs.NewFileStorage(path)
+	require.NoError(t, err)
+
+	l := &link.Link{UserID: "anonymous", ShortURL: "abc", OriginalURL: "https://example.com"}
+	require.NoError(t, store.SaveLink(context.TODO(), l))
+	u := &user.User{ID: "account", Login: "alice", PasswordHash: "hash", CreatedAt: time.Now()}
+	require.NoError(t, store.SaveUser(context.TODO(), u, "anonymous"))
+	require.NoError(t, store.Close())
+
+	store, err = fs.NewFileStorage(path)
+	require.NoError(t, err)
+	defer store.Close()
+
+	got, err := store.GetUserByLogin(context.TODO(), "alice")
+	require.NoError(t, err)
+	assert.Equal(t, "account", got.ID)
+
+	links, err := store.GetLinksByUser(context.TODO(), "account")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"abc": "https://example.com"}, links,
+		"reassignment must survive a restart")
+}
+
+func TestFileStorageModerationReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "links.json")
+	store, err := fs.NewFileStorage(path)
+	require.NoError(t, err)
+
+	l := &link.Link{UserID: "alice", ShortURL: "abc", OriginalURL: "https://example.com"}
+	require.NoError(t, store.SaveLink(context.TODO(), l))
+	require.NoError(t, store.DisableLink(context.TODO(), "abc", true))
+	require.NoError(t, store.BanUser(context.TODO(), "spammer", "spam", time.Now()))
+	require.NoError(t, store.BanUser(context.TODO(), "lifted", "", time.Now()))
+	require.NoError(t, store.UnbanUser(context.TODO(), "lifted"))
+	require.NoError(t, store.Close())
+
+	store, err = fs.NewFileStorage(path)
+	require.NoError(t, err)
+	defer store.Close()
+
+	got := &link.Link{ShortURL: "abc"}
+	require.NoError(t, store.GetLink(context.TODO(), got))
+	assert.True(t, got.IsDisabled, "a disabled link must stay disabled after a restart")
+
+	banned, err := store.IsBanned(context.TODO(), "spammer")
+	require.NoError(t, err)
+	assert.True(t, banned)
+
+	banned, err = store.IsBanned(context.TODO(), "lifted")
+	require.NoError(t, err)
+	assert.False(t, banned)
+}
+
+func TestFileStorageUsageReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "links.json")
+	store, err := fs.NewFileStorage(path)
+	require.NoError(t, err)
+
+	today := time.Now()
+	_, err = store.AddDailyUsage(context.TODO(), "alice", today, 3, 0)
+	require.NoError(t, err)
+	_, err = store.AddDailyUsage(context.TODO(), "alice", today, -1, 0)
+	require.NoError(t, err)
+	_, err = store.AddDailyUsage(context.TODO(), "alice", today.AddDate(0, 0, -1), 5, 0)
+	require.NoError(t, err)
+	require.NoError(t, store.Close())
+
+	store, err = fs.NewFileStorage(path)
+	require.NoError(t, err)
+	defer store.Close()
+
+	used, err := store.GetDailyUsage(context.TODO(), "alice", today)
+	require.NoError(t, err)
+	assert.Equal(t, 2, used, "today's usage must survive a restart")
+
+	used, err = store.GetDailyUsage(context.TODO(), "alice", today.AddDate(0, 0, -1))
+	require.NoError(t, err)
+	assert.Equal(t, 0, used, "past days must not be loaded")
+}
+
+func TestFileStorageUsageRollup(t *testing.T) {
+	dir := t.TempDir()
+	store, err := fs.NewFileStorage(filepath.Join(dir, "links.json"))
+	require.NoError(t, err)
+	defer store.Close()
+
+	usageLines := func() int {
+		data, err := os.ReadFile(filepath.Join(dir, "links.usage.json"))
+		require.NoError(t, err)
+		return bytes.Count(data, []byte("\n"))
+	}
+
+	today := time.Now()
+	tomorrow := today.AddDate(0, 0, 1)
+	for range 3 {
+		_, err = store.AddDailyUsage(context.TODO(), "alice", today, 1, 0)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 3, usageLines())
+
+	_, err = store.AddDailyUsage(context.TODO(), "bob", tomorrow, 1, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1, usageLines(), "a new day must drop the lines of the previous days")
+
+	used, err := store.GetDailyUsage(context.TODO(), "alice", today)
+	require.NoError(t, err)
+	assert.Equal(t, 0, used, "the counters of the previous days must be forgotten")
+
+	_, err = store.AddDailyUsage(context.TODO(), "bob", tomorrow, 1, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 2, usageLines())
+
+	require.NoError(t, store.Compact())
+	assert.Equal(t, 1, usageLines(), "compaction must keep a line per counter")
+	used, err = store.GetDailyUsage(context.TODO(), "bob", tomorrow)
+	require.NoError(t, err)
+	assert.Equal(t, 2, used)
+
+	_, err = store.AddDailyUsage(context.TODO(), "bob", tomorrow, 1, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 2, usageLines(), "the writer must append to the compacted file")
+}
+
+func TestFileStorageCheckWritable(t *testing.T) {
+	dir := t.TempDir()
+	store, err := fs.NewFileStorage(filepath.Join(dir, "links.json"))
+	require.NoError(t, err)
+	defer store.Close()
+
+	require.NoError(t, store.CheckWritable(context.TODO()))
+	leftovers, err := filepath.Glob(filepath.Join(dir, ".healthcheck-*"))
+	require.NoError(t, err)
+	assert.Empty(t, leftovers)
+
+	require.NoError(t, os.RemoveAll(dir))
+	assert.Error(t, store.CheckWritable(context.TODO()))
+}
+
+func TestFileStorageSecretsReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.json")
+	store, err := fs.NewFileStorage(path)
+	require.NoError(t, err)
+
+	_, err = store.GetOrCreateSecret(context.TODO(), "test", []byte("first"))
+	require.NoError(t, err)
+	require.NoError(t, store.Close())
+
+	info, err := os.Stat(filepath.Join(filepath.Dir(path), "secrets.secrets.json"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	store, err = fs.NewFileStorage(path)
+	require.NoError(t, err)
+	defer store.Close()
+
+	secret, err := store.GetOrCreateSecret(context.TODO(), "test", []byte("second"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("first"), secret)
+}
@@ -0,0 +1,111 @@
+package filestorage
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/MomsEngineer/urlshortener/internal/entities/link"
+)
+
+// compactMinGarbage keeps small files from being rewritten over and
+// over, compaction starts once the superseded entries outnumber both
+// this value and the current ones.
+const compactMinGarbage = 1000
+
+// index holds the current state of every link in the file. Deleted
+// links stay in records, so their codes are not reused, but are left
+// out of the user and original URL lookups. The original URL lookup
+// is keyed by the uniqueness scope.
+type index struct {
+	scope      link.UniqueScope
+	records    map[string]*entry
+	byUser     map[string]map[string]struct{}
+	byOriginal map[string]string
+	lines      int
+	live       int
+}
+
+func newIndex(scope link.UniqueScope) *index {
+	return &index{
+		scope:      scope,
+		records:    make(map[string]*entry),
+		byUser:     make(map[string]map[string]struct{}),
+		byOriginal: make(map[string]string),
+	}
+}
+
+func (idx *index) get(short string) *entry {
+	return idx.records[short]
+}
+
+// getByOriginal returns the live link that the given link would
+// duplicate.
+func (idx *index) getByOriginal(userID, original string) *entry {
+	short, ok := idx.byOriginal[idx.scope.Key(userID, original)]
+	if !ok {
+		return nil
+	}
+
+	return idx.records[short]
+}
+
+// apply makes the entry the current state of its link.
+func (idx *index) apply(e *entry) {
+	idx.lines++
+
+	if old, ok := idx.records[e.ShortURL]; ok {
+		idx.forget(old)
+	}
+	idx.records[e.ShortURL] = e
+
+	if e.IsDeleted {
+		return
+	}
+
+	idx.live++
+	if idx.byUser[e.UserID] == nil {
+		idx.byUser[e.UserID] = make(map[string]struct{})
+	}
+	idx.byUser[e.UserID][e.ShortURL] = struct{}{}
+	idx.byOriginal[idx.scope.Key(e.UserID, e.OriginalURL)] = e.ShortURL
+}
+
+func (idx *index) forget(e *entry) {
+	if e.IsDeleted {
+		return
+	}
+
+	idx.live--
+	delete(idx.byUser[e.UserID], e.ShortURL)
+	if len(idx.byUser[e.UserID]) == 0 {
+		delete(idx.byUser, e.UserID)
+	}
+	key := idx.scope.Key(e.UserID, e.OriginalURL)
+	if idx.byOriginal[key] == e.ShortURL {
+		delete(idx.byOriginal, key)
+	}
+}
+
+// needsCompaction counts only superseded entries as garbage, the
+// deletion marks are kept by compaction.
+func (idx *index) needsCompaction() bool {
+	garbage := idx.lines - len(idx.records)
+	return garbage >= compactMinGarbage && garbage > len(idx.records)
+}
+
+// entries returns the current entry of every link, deleted ones
+// included, in the order they were written.
+func (idx *index) entries() []*entry {
+	res := make([]*entry, 0, len(idx.records))
+	for _, e := range idx.records {
+		res = append(res, e)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		a, _ := strconv.ParseUint(res[i].UUID, 10, 64)
+		b, _ := strconv.ParseUint(res[j].UUID, 10, 64)
+		return a < b
+	})
+
+	return res
+}
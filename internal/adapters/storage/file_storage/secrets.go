@@ -0,0 +1,55 @@
+package filestorage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	ierror "github.com/MomsEngineer/urlshortener/internal/errors"
+)
+
+// secretEntry is a line of the secrets file, a secret is written once
+// and never changed.
+type secretEntry struct {
+	Name  string `json:"name"`
+	Value []byte `json:"value"`
+}
+
+func (fs *FileStorage) loadSecrets() error {
+	fs.secrets = make(map[string][]byte)
+
+	return readSidecar(fs.secretsPath, func(e *secretEntry) {
+		if _, ok := fs.secrets[e.Name]; !ok {
+			fs.secrets[e.Name] = e.Value
+		}
+	})
+}
+
+// GetOrCreateSecret saves the secret under name unless one is saved
+// already and returns the saved one.
+func (fs *FileStorage) GetOrCreateSecret(ctx context.Context, name string, secret []byte) ([]byte, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if saved, ok := fs.secrets[name]; ok {
+		return saved, nil
+	}
+
+	// Unlike the other sidecars the file is readable by its owner only.
+	if fs.secretsW == nil {
+		file, err := os.OpenFile(fs.secretsPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			fs.log.Error(ctx, "Failed to create secrets writer", err)
+			return nil, fmt.Errorf("%w: %v", ierror.ErrStorageUnavailable, err)
+		}
+		fs.secretsW = &writer{file: file, encoder: json.NewEncoder(file)}
+	}
+
+	if err := fs.appendSidecar(ctx, &fs.secretsW, fs.secretsPath, &secretEntry{Name: name, Value: secret}); err != nil {
+		return nil, err
+	}
+
+	fs.secrets[name] = secret
+	return secret, nil
+}
@@ -0,0 +1,99 @@
+package filestorage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/MomsEngineer/urlshortener/internal/adapters/logger"
+	ierror "github.com/MomsEngineer/urlshortener/internal/errors"
+)
+
+// readSidecar applies every line of a sidecar file in order, a missing
+// file is created with the first appended line.
+func readSidecar[T any](path string, apply func(*T)) error {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
+	for {
+		v := new(T)
+		err := decoder.Decode(v)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		apply(v)
+	}
+}
+
+// appendSidecar writes the line through the writer, which is opened on
+// first use. The caller must hold the write lock.
+func (fs *FileStorage) appendSidecar(ctx context.Context, w **writer, path string, v any) error {
+	if *w == nil {
+		opened, err := newWriter(path)
+		if err != nil {
+			fs.log.Error(ctx, "Failed to create sidecar writer", err, logger.String("path", path))
+			return fmt.Errorf("%w: %v", ierror.ErrStorageUnavailable, err)
+		}
+		*w = opened
+	}
+
+	if err := (*w).encoder.Encode(v); err != nil {
+		fs.log.Error(ctx, "Failed to write sidecar entry", err, logger.String("path", path))
+		return fmt.Errorf("%w: %v", ierror.ErrStorageUnavailable, err)
+	}
+
+	if fs.sync.everyWrite {
+		return (*w).file.Sync()
+	}
+
+	return nil
+}
+
+// rewriteSidecar replaces the sidecar file with the lines and keeps the
+// new file open as the writer. The caller must hold the write lock.
+func (fs *FileStorage) rewriteSidecar(ctx context.Context, w **writer, path string, lines []any) error {
+	tmpPath := path + ".compact"
+	file, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC|os.O_APPEND, 0666)
+	if err != nil {
+		fs.log.Error(ctx, "Failed to create compacted sidecar", err, logger.String("path", path))
+		return fmt.Errorf("%w: %v", ierror.ErrStorageUnavailable, err)
+	}
+
+	encoder := json.NewEncoder(file)
+	for _, line := range lines {
+		if err = encoder.Encode(line); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		fs.log.Error(ctx, "Failed to compact sidecar", err, logger.String("path", path))
+		file.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("%w: %v", ierror.ErrStorageUnavailable, err)
+	}
+
+	if *w != nil {
+		(*w).file.Close()
+	}
+	*w = &writer{file: file, encoder: encoder}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package filestorage
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	ierror "github.com/MomsEngineer/urlshortener/internal/errors"
+)
+
+// usageEntry is a line of the usage file holding the links a user
+// created on a UTC day, a later entry for the same day supersedes the
+// earlier one.
+type usageEntry struct {
+	UserID string `json:"user_id"`
+	Day    string `json:"day"`
+	Links  int    `json:"links"`
+}
+
+func usageKey(userID, day string) string {
+	return userID + " " + day
+}
+
+// loadUsage keeps the counters of today only, older days no longer
+// count against any quota.
+func (fs *FileStorage) loadUsage() error {
+	fs.usage = make(map[string]int)
+	fs.usageDay = time.Now().UTC().Format(time.DateOnly)
+	fs.usageLines = 0
+
+	return readSidecar(fs.usagePath, func(e *usageEntry) {
+		fs.usageLines++
+		if e.Day == fs.usageDay {
+			fs.usage[usageKey(e.UserID, e.Day)] = e.Links
+		}
+	})
+}
+
+// rollUsage forgets the counters of the previous days once day begins
+// and rewrites the usage file with the counters of day only. The
+// caller must hold the write lock.
+func (fs *FileStorage) rollUsage(ctx context.Context, day string) error {
+	if day <= fs.usageDay {
+		return nil
+	}
+
+	fs.usage = make(map[string]int)
+	fs.usageDay = day
+
+	return fs.compactUsage(ctx)
+}
+
+// compactUsage rewrites the usage file with a line per counter of the
+// current day, the caller must hold the write lock.
+func (fs *FileStorage) compactUsage(ctx context.Context) error {
+	if fs.usageLines == len(fs.usage) {
+		return nil
+	}
+
+	lines := make([]any, 0, len(fs.usage))
+	for key, links := range fs.usage {
+		userID, day, _ := strings.Cut(key, " ")
+		lines = append(lines, &usageEntry{UserID: userID, Day: day, Links: links})
+	}
+
+	if err := fs.rewriteSidecar(ctx, &fs.usageW, fs.usagePath, lines); err != nil {
+		return err
+	}
+	fs.usageLines = len(lines)
+
+	return nil
+}
+
+func (fs *FileStorage) CountUserLinks(ctx context.Context, userID string) (int, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	return len(fs.idx.byUser[userID]), nil
+}
+
+// AddDailyUsage returns ErrQuotaExceeded and keeps the counter if it
+// would grow past limit, a limit of 0 means no limit.
+func (fs *FileStorage) AddDailyUsage(ctx context.Context, userID string, day time.Time, n, limit int) (int, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	e := &usageEntry{UserID: userID, Day: day.UTC().Format(time.DateOnly)}
+	if err := fs.rollUsage(ctx, e.Day); err != nil {
+		return 0, err
+	}
+	if e.Day != fs.usageDay {
+		// A past day no longer counts against any quota.
+		return 0, nil
+	}
+
+	key := usageKey(e.UserID, e.Day)
+	used := fs.usage[key] + n
+	if limit > 0 && n > 0 && used > limit {
+		return used - n, ierror.ErrQuotaExceeded
+	}
+
+	e.Links = max(used, 0)
+	if err := fs.appendSidecar(ctx, &fs.usageW, fs.usagePath, e); err != nil {
+		return 0, err
+	}
+
+	fs.usage[key] = e.Links
+	fs.usageLines++
+	return e.Links, nil
+}
+
+func (fs *FileStorage) GetDailyUsage(ctx context.Context, userID string, day time.Time) (int, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	return fs.usage[usageKey(userID, day.UTC().Format(time.DateOnly))], nil
+}
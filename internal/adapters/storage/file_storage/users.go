@@ -0,0 +1,156 @@
+package filestorage
+
+import (
+	"context"
+	"time"
+
+	"github.com/MomsEngineer/urlshortener/internal/entities/user"
+	ierror "github.com/MomsEngineer/urlshortener/internal/errors"
+)
+
+// userEntry is a line of the users file, a later entry with the same
+// login supersedes the earlier one.
+type userEntry struct {
+	ID           string    `json:"id"`
+	Login        string    `json:"login"`
+	PasswordHash string    `json:"password_hash"`
+	Role         user.Role `json:"role,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func (e *userEntry) user() *user.User {
+	role := e.Role
+	if role == "" {
+		role = user.RoleUser
+	}
+
+	return &user.User{
+		ID:           e.ID,
+		Login:        e.Login,
+		PasswordHash: e.PasswordHash,
+		Role:         role,
+		CreatedAt:    e.CreatedAt,
+	}
+}
+
+func (fs *FileStorage) loadUsers() error {
+	fs.users = make(map[string]*userEntry)
+
+	return readSidecar(fs.usersPath, func(e *userEntry) {
+		fs.users[e.Login] = e
+	})
+}
+
+// appendUser writes the entry and applies it, the caller must hold
+// the write lock.
+func (fs *FileStorage) appendUser(ctx context.Context, e *userEntry) error {
+	if err := fs.appendSidecar(ctx, &fs.usersW, fs.usersPath, e); err != nil {
+		return err
+	}
+
+	fs.users[e.Login] = e
+	return nil
+}
+
+// SaveUser moves the live links and API keys of fromUserID to the user
+// and writes the user last, so a failed save leaves no account behind
+// and can be retried.
+func (fs *FileStorage) SaveUser(ctx context.Context, u *user.User, fromUserID string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if _, ok := fs.users[u.Login]; ok {
+		return ierror.ErrDuplicate
+	}
+
+	if fromUserID != "" {
+		if err := fs.reassign(ctx, fromUserID, u.ID); err != nil {
+			return err
+		}
+	}
+
+	return fs.appendUser(ctx, &userEntry{
+		ID:           u.ID,
+		Login:        u.Login,
+		PasswordHash: u.PasswordHash,
+		Role:         u.Role,
+		CreatedAt:    u.CreatedAt,
+	})
+}
+
+func (fs *FileStorage) SetUserRole(ctx context.Context, userID string, role user.Role) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	for _, e := range fs.users {
+		if e.ID == userID {
+			changed := *e
+			changed.Role = role
+			return fs.appendUser(ctx, &changed)
+		}
+	}
+
+	return ierror.ErrNotFound
+}
+
+func (fs *FileStorage) GetUserByLogin(ctx context.Context, login string) (*user.User, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	e, ok := fs.users[login]
+	if !ok {
+		return nil, ierror.ErrNotFound
+	}
+
+	return e.user(), nil
+}
+
+func (fs *FileStorage) GetUserByID(ctx context.Context, id string) (*user.User, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	for _, e := range fs.users {
+		if e.ID == id {
+			return e.user(), nil
+		}
+	}
+
+	return nil, ierror.ErrNotFound
+}
+
+// reassign appends a new entry for every live link and API key of one
+// user with the other user as the owner, the caller must hold the write
+// lock.
+func (fs *FileStorage) reassign(ctx context.Context, fromUserID, toUserID string) error {
+	var moved []*entry
+	for short := range fs.idx.byUser[fromUserID] {
+		moved = append(moved, fs.idx.get(short))
+	}
+
+	for _, e := range moved {
+		reassigned := *e
+		reassigned.UserID = toUserID
+		if err := fs.append(&reassigned); err != nil {
+			fs.log.Error(ctx, "Failed to save reassigned link", err)
+			return err
+		}
+	}
+
+	if err := fs.syncWrite(ctx); err != nil {
+		return err
+	}
+
+	for _, e := range fs.apiKeys {
+		if e.UserID != fromUserID {
+			continue
+		}
+
+		reassigned := *e
+		reassigned.UserID = toUserID
+		if err := fs.appendAPIKey(ctx, &reassigned); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,94 @@
+package mapstorage
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/MomsEngineer/urlshortener/internal/entities/link"
+	ierror "github.com/MomsEngineer/urlshortener/internal/errors"
+)
+
+func (lm *MapStorage) ListLinks(_ context.Context, f link.Filter) ([]*link.Link, error) {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+
+	var res []*link.Link
+	for _, l := range lm.Links {
+		if f.Matches(l) {
+			found := *l
+			res = append(res, &found)
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].ShortURL < res[j].ShortURL
+	})
+
+	return f.Page(res), nil
+}
+
+func (lm *MapStorage) DisableLink(_ context.Context, short string, disabled bool) error {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	l := lm.findByShort(short)
+	if l == nil || l.IsDeleted {
+		return ierror.ErrNotFound
+	}
+
+	l.IsDisabled = disabled
+	return nil
+}
+
+// SetLinkOwner returns ErrDuplicate if the new owner already has a
+// link to the same original URL within the uniqueness scope.
+func (lm *MapStorage) SetLinkOwner(_ context.Context, short, userID string) error {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	l := lm.findByShort(short)
+	if l == nil || l.IsDeleted {
+		return ierror.ErrNotFound
+	}
+
+	moved := *l
+	moved.UserID = userID
+	if existing := lm.findByOriginal(&moved, time.Now()); existing != nil && existing != l {
+		return ierror.ErrDuplicate
+	}
+
+	l.UserID = userID
+	return nil
+}
+
+// BanUser keeps the reason of the first ban.
+func (lm *MapStorage) BanUser(_ context.Context, userID, reason string, _ time.Time) error {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	if lm.Bans == nil {
+		lm.Bans = make(map[string]string)
+	}
+	if _, ok := lm.Bans[userID]; !ok {
+		lm.Bans[userID] = reason
+	}
+
+	return nil
+}
+
+func (lm *MapStorage) UnbanUser(_ context.Context, userID string) error {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	delete(lm.Bans, userID)
+	return nil
+}
+
+func (lm *MapStorage) IsBanned(_ context.Context, userID string) (bool, error) {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+
+	_, ok := lm.Bans[userID]
+	return ok, nil
+}
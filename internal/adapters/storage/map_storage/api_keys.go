@@ -0,0 +1,71 @@
+package mapstorage
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/MomsEngineer/urlshortener/internal/entities/apikey"
+	ierror "github.com/MomsEngineer/urlshortener/internal/errors"
+)
+
+// The keys are copied in and out, so callers can't change them
+// without holding the lock.
+
+func (lm *MapStorage) SaveAPIKey(_ context.Context, k *apikey.APIKey) error {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	saved := *k
+	lm.APIKeys = append(lm.APIKeys, &saved)
+	return nil
+}
+
+func (lm *MapStorage) GetAPIKey(_ context.Context, hash string) (*apikey.APIKey, error) {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+
+	for _, k := range lm.APIKeys {
+		if k.Hash == hash {
+			found := *k
+			return &found, nil
+		}
+	}
+
+	return nil, ierror.ErrNotFound
+}
+
+func (lm *MapStorage) GetAPIKeysByUser(_ context.Context, userID string) ([]*apikey.APIKey, error) {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+
+	var res []*apikey.APIKey
+	for _, k := range lm.APIKeys {
+		if k.UserID == userID {
+			found := *k
+			res = append(res, &found)
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].CreatedAt.Before(res[j].CreatedAt)
+	})
+
+	return res, nil
+}
+
+func (lm *MapStorage) RevokeAPIKey(_ context.Context, userID, id string, now time.Time) error {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	for _, k := range lm.APIKeys {
+		if k.ID == id && k.UserID == userID {
+			if !k.IsRevoked() {
+				k.RevokedAt = now
+			}
+			return nil
+		}
+	}
+
+	return ierror.ErrNotFound
+}
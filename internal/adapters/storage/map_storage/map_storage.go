@@ -2,46 +2,123 @@ package mapstorage
 
 import (
 	"context"
-	"errors"
+	"sync"
+	"time"
 
+	"github.com/MomsEngineer/urlshortener/internal/entities/apikey"
+	"github.com/MomsEngineer/urlshortener/internal/entities/click"
 	"github.com/MomsEngineer/urlshortener/internal/entities/link"
+	"github.com/MomsEngineer/urlshortener/internal/entities/user"
+	ierror "github.com/MomsEngineer/urlshortener/internal/errors"
 )
 
 type MapStorage struct {
-	Links []*link.Link
+	Links   []*link.Link
+	Clicks  []*click.Click
+	APIKeys []*apikey.APIKey
+	Users   []*user.User
+	Bans    map[string]string
+	Usage   map[string]int
+	Secrets map[string][]byte
+	scope   link.UniqueScope
+	mu      sync.RWMutex
 }
 
-func NewMapStorage() *MapStorage {
-	return &MapStorage{}
+type Option func(*MapStorage)
+
+func WithUniqueScope(scope link.UniqueScope) Option {
+	return func(lm *MapStorage) {
+		lm.scope = scope
+	}
 }
 
+func NewMapStorage(opts ...Option) *MapStorage {
+	lm := &MapStorage{}
+	for _, opt := range opts {
+		opt(lm)
+	}
+
+	return lm
+}
+
+// SaveLink returns ErrDuplicate with the existing short URL
+// if the original URL is already shortened.
 func (lm *MapStorage) SaveLink(_ context.Context, l *link.Link) error {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	if existing := lm.findByOriginal(l, time.Now()); existing != nil {
+		l.ShortURL = existing.ShortURL
+		return ierror.ErrDuplicate
+	}
+
+	if lm.findByShort(l.ShortURL) != nil {
+		return ierror.ErrAliasTaken
+	}
+
 	lm.Links = append(lm.Links, l)
 	return nil
 }
 
+// SaveLinksBatch saves either all links or none of them. Links with
+// an already shortened original URL get the existing short URL.
 func (lm *MapStorage) SaveLinksBatch(_ context.Context, links []*link.Link) error {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	var fresh []*link.Link
+	shorts := make(map[string]struct{}, len(links))
+	keys := make(map[string]string, len(links))
 	for _, l := range links {
-		lm.SaveLink(context.TODO(), l)
+		key := lm.scope.Key(l.UserID, l.OriginalURL)
+		if short, ok := keys[key]; ok {
+			l.ShortURL = short
+			continue
+		}
+
+		if existing := lm.findByOriginal(l, time.Now()); existing != nil {
+			l.ShortURL = existing.ShortURL
+			continue
+		}
+
+		if _, ok := shorts[l.ShortURL]; ok || lm.findByShort(l.ShortURL) != nil {
+			return ierror.ErrAliasTaken
+		}
+
+		shorts[l.ShortURL] = struct{}{}
+		keys[key] = l.ShortURL
+		fresh = append(fresh, l)
 	}
+
+	lm.Links = append(lm.Links, fresh...)
 	return nil
 }
 
 func (lm *MapStorage) GetLink(_ context.Context, link *link.Link) error {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+
 	for _, l := range lm.Links {
 		if l.ShortURL == link.ShortURL {
+			link.UserID = l.UserID
 			link.OriginalURL = l.OriginalURL
+			link.IsDeleted = l.IsDeleted
+			link.IsDisabled = l.IsDisabled
+			link.ExpiresAt = l.ExpiresAt
 			return nil
 		}
 	}
 
-	return errors.New("not found")
+	return ierror.ErrNotFound
 }
 
 func (lm *MapStorage) GetLinksByUser(ctx context.Context, userID string) (map[string]string, error) {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+
 	res := make(map[string]string)
 	for _, l := range lm.Links {
-		if l.UserID == userID {
+		if l.UserID == userID && !l.IsDeleted {
 			res[l.ShortURL] = l.OriginalURL
 		}
 	}
@@ -49,10 +126,106 @@ func (lm *MapStorage) GetLinksByUser(ctx context.Context, userID string) (map[st
 	return res, nil
 }
 
-func (lm *MapStorage) Ping(_ context.Context) error {
-	if lm.Links == nil {
-		return errors.New("links is nil")
+func (lm *MapStorage) DeleteLinks(_ context.Context, links []*link.Link) error {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	for _, link := range links {
+		for _, l := range lm.Links {
+			if l.ShortURL == link.ShortURL && l.UserID == link.UserID {
+				l.IsDeleted = true
+			}
+		}
+	}
+
+	return nil
+}
+
+func (lm *MapStorage) DeleteExpiredLinks(_ context.Context, now time.Time) (int64, error) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	var n int64
+	for _, l := range lm.Links {
+		if !l.IsDeleted && l.IsExpired(now) {
+			l.IsDeleted = true
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+func (lm *MapStorage) SaveClicks(_ context.Context, clicks []*click.Click) error {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	lm.Clicks = append(lm.Clicks, clicks...)
+	return nil
+}
+
+func (lm *MapStorage) GetClickStats(_ context.Context, short string) (*click.Stats, error) {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+
+	var clicks []*click.Click
+	for _, c := range lm.Clicks {
+		if c.ShortURL == short {
+			clicks = append(clicks, c)
+		}
+	}
+
+	return click.NewStats(clicks), nil
+}
+
+func (lm *MapStorage) CountLinks(_ context.Context) (int, int, error) {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+
+	urls := 0
+	users := make(map[string]struct{})
+	for _, l := range lm.Links {
+		if !l.IsDeleted {
+			urls++
+			users[l.UserID] = struct{}{}
+		}
 	}
+
+	return urls, len(users), nil
+}
+
+func (lm *MapStorage) findByShort(short string) *link.Link {
+	for _, l := range lm.Links {
+		if l.ShortURL == short {
+			return l
+		}
+	}
+
+	return nil
+}
+
+// findByOriginal returns the live link that link would duplicate. An
+// expired duplicate is deleted on the way, as the reaper would, so its
+// original URL can be shortened again.
+func (lm *MapStorage) findByOriginal(link *link.Link, now time.Time) *link.Link {
+	key := lm.scope.Key(link.UserID, link.OriginalURL)
+	for _, l := range lm.Links {
+		if l.IsDeleted || lm.scope.Key(l.UserID, l.OriginalURL) != key {
+			continue
+		}
+
+		if l.IsExpired(now) {
+			l.IsDeleted = true
+			continue
+		}
+
+		return l
+	}
+
+	return nil
+}
+
+func (lm *MapStorage) Ping(_ context.Context) error {
 	return nil
 }
 
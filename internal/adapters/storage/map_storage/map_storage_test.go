@@ -6,7 +6,10 @@ import (
 	"testing"
 
 	ms "github.com/MomsEngineer/urlshortener/internal/adapters/storage/map_storage"
+	"github.com/MomsEngineer/urlshortener/internal/adapters/storage/storetest"
 	"github.com/MomsEngineer/urlshortener/internal/entities/link"
+	ierror "github.com/MomsEngineer/urlshortener/internal/errors"
+	"github.com/MomsEngineer/urlshortener/internal/usecases/storage"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -83,3 +86,153 @@ func TestGetLink(t *testing.T) {
 		})
 	}
 }
+
+func TestDeleteLinks(t *testing.T) {
+	lm := ms.NewMapStorage()
+	require.NotNil(t, lm)
+
+	for _, l := range []*link.Link{
+		{UserID: "owner", ShortURL: "abc123", OriginalURL: "https://example.com"},
+		{UserID: "owner", ShortURL: "def456", OriginalURL: "https://test.com"},
+	} {
+		require.NoError(t, lm.SaveLink(context.TODO(), l))
+	}
+
+	err := lm.DeleteLinks(context.TODO(), []*link.Link{
+		{UserID: "owner", ShortURL: "abc123"},
+		{UserID: "stranger", ShortURL: "def456"},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		id        string
+		isDeleted bool
+	}{
+		{
+			name:      "Link deleted by its owner",
+			id:        "abc123",
+			isDeleted: true,
+		},
+		{
+			name:      "Link deleted by another user",
+			id:        "def456",
+			isDeleted: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := link.NewLink("owner", tt.id, "")
+			require.NoError(t, err)
+
+			err = lm.GetLink(context.TODO(), l)
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.isDeleted, l.IsDeleted, "expected deletion flag does not match")
+		})
+	}
+
+	links, err := lm.GetLinksByUser(context.TODO(), "owner")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"def456": "https://test.com"}, links)
+}
+
+func TestSaveTakenShortLink(t *testing.T) {
+	lm := ms.NewMapStorage()
+	require.NotNil(t, lm)
+
+	l, err := link.NewLink("userID", "spring-sale", "https://example.com")
+	require.NoError(t, err)
+	require.NoError(t, lm.SaveLink(context.TODO(), l))
+
+	l, err = link.NewLink("userID", "spring-sale", "https://test.com")
+	require.NoError(t, err)
+	require.ErrorIs(t, lm.SaveLink(context.TODO(), l), ierror.ErrAliasTaken)
+
+	batch := []*link.Link{
+		{UserID: "userID", ShortURL: "fresh", OriginalURL: "https://fresh.com"},
+		{UserID: "userID", ShortURL: "spring-sale", OriginalURL: "https://test.com"},
+	}
+	require.ErrorIs(t, lm.SaveLinksBatch(context.TODO(), batch), ierror.ErrAliasTaken)
+	assert.Len(t, lm.Links, 1, "a failed batch must not save any link")
+}
+
+func TestSaveDuplicateLink(t *testing.T) {
+	tests := []struct {
+		name      string
+		scope     link.UniqueScope
+		userID    string
+		wantErr   error
+		wantShort string
+	}{
+		{
+			name:      "Same user with global uniqueness",
+			scope:     link.UniqueGlobal,
+			userID:    "owner",
+			wantErr:   ierror.ErrDuplicate,
+			wantShort: "abc123",
+		},
+		{
+			name:      "Another user with global uniqueness",
+			scope:     link.UniqueGlobal,
+			userID:    "stranger",
+			wantErr:   ierror.ErrDuplicate,
+			wantShort: "abc123",
+		},
+		{
+			name:      "Same user with per-user uniqueness",
+			scope:     link.UniquePerUser,
+			userID:    "owner",
+			wantErr:   ierror.ErrDuplicate,
+			wantShort: "abc123",
+		},
+		{
+			name:      "Another user with per-user uniqueness",
+			scope:     link.UniquePerUser,
+			userID:    "stranger",
+			wantErr:   nil,
+			wantShort: "def456",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lm := ms.NewMapStorage(ms.WithUniqueScope(tt.scope))
+
+			l := &link.Link{UserID: "owner", ShortURL: "abc123", OriginalURL: "https://example.com"}
+			require.NoError(t, lm.SaveLink(context.TODO(), l))
+
+			l = &link.Link{UserID: tt.userID, ShortURL: "def456", OriginalURL: "https://example.com"}
+			err := lm.SaveLink(context.TODO(), l)
+			require.Equal(t, tt.wantErr, err)
+			assert.Equal(t, tt.wantShort, l.ShortURL)
+
+			batch := []*link.Link{
+				{UserID: tt.userID, ShortURL: "ghi789", OriginalURL: "https://example.com"},
+				{UserID: tt.userID, ShortURL: "jkl012", OriginalURL: "https://test.com"},
+				{UserID: tt.userID, ShortURL: "mno345", OriginalURL: "https://test.com"},
+			}
+			require.NoError(t, lm.SaveLinksBatch(context.TODO(), batch))
+			assert.Equal(t, tt.wantShort, batch[0].ShortURL)
+			assert.Equal(t, "jkl012", batch[2].ShortURL, "duplicates inside a batch must share a link")
+		})
+	}
+}
+
+func TestSaveLinkAfterDeletion(t *testing.T) {
+	lm := ms.NewMapStorage()
+
+	l := &link.Link{UserID: "owner", ShortURL: "abc123", OriginalURL: "https://example.com"}
+	require.NoError(t, lm.SaveLink(context.TODO(), l))
+	require.NoError(t, lm.DeleteLinks(context.TODO(), []*link.Link{l}))
+
+	l = &link.Link{UserID: "owner", ShortURL: "def456", OriginalURL: "https://example.com"}
+	require.NoError(t, lm.SaveLink(context.TODO(), l), "a deleted link must not block its original URL")
+}
+
+func TestMapStorageConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) storage.StoreInterface {
+		return ms.NewMapStorage()
+	})
+}
@@ -0,0 +1,21 @@
+package mapstorage
+
+import "context"
+
+// GetOrCreateSecret saves the secret under name unless one is saved
+// already and returns the saved one.
+func (lm *MapStorage) GetOrCreateSecret(_ context.Context, name string, secret []byte) ([]byte, error) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	if saved, ok := lm.Secrets[name]; ok {
+		return saved, nil
+	}
+
+	if lm.Secrets == nil {
+		lm.Secrets = make(map[string][]byte)
+	}
+	lm.Secrets[name] = secret
+
+	return secret, nil
+}
@@ -0,0 +1,53 @@
+package mapstorage
+
+import (
+	"context"
+	"time"
+
+	ierror "github.com/MomsEngineer/urlshortener/internal/errors"
+)
+
+func usageKey(userID string, day time.Time) string {
+	return userID + " " + day.UTC().Format(time.DateOnly)
+}
+
+func (lm *MapStorage) CountUserLinks(_ context.Context, userID string) (int, error) {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+
+	n := 0
+	for _, l := range lm.Links {
+		if !l.IsDeleted && l.UserID == userID {
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// AddDailyUsage returns ErrQuotaExceeded and keeps the counter if it
+// would grow past limit, a limit of 0 means no limit.
+func (lm *MapStorage) AddDailyUsage(_ context.Context, userID string, day time.Time, n, limit int) (int, error) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	key := usageKey(userID, day)
+	used := lm.Usage[key] + n
+	if limit > 0 && n > 0 && used > limit {
+		return used - n, ierror.ErrQuotaExceeded
+	}
+
+	if lm.Usage == nil {
+		lm.Usage = make(map[string]int)
+	}
+	lm.Usage[key] = max(used, 0)
+
+	return lm.Usage[key], nil
+}
+
+func (lm *MapStorage) GetDailyUsage(_ context.Context, userID string, day time.Time) (int, error) {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+
+	return lm.Usage[usageKey(userID, day)], nil
+}
@@ -0,0 +1,81 @@
+package mapstorage
+
+import (
+	"context"
+
+	"github.com/MomsEngineer/urlshortener/internal/entities/user"
+	ierror "github.com/MomsEngineer/urlshortener/internal/errors"
+)
+
+// SaveUser saves the user and moves the live links and the API keys of
+// fromUserID to it.
+func (lm *MapStorage) SaveUser(_ context.Context, u *user.User, fromUserID string) error {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	for _, existing := range lm.Users {
+		if existing.Login == u.Login {
+			return ierror.ErrDuplicate
+		}
+	}
+
+	if fromUserID != "" {
+		for _, l := range lm.Links {
+			if l.UserID == fromUserID && !l.IsDeleted {
+				l.UserID = u.ID
+			}
+		}
+
+		for _, k := range lm.APIKeys {
+			if k.UserID == fromUserID {
+				k.UserID = u.ID
+			}
+		}
+	}
+
+	saved := *u
+	lm.Users = append(lm.Users, &saved)
+	return nil
+}
+
+func (lm *MapStorage) GetUserByLogin(_ context.Context, login string) (*user.User, error) {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+
+	for _, u := range lm.Users {
+		if u.Login == login {
+			found := *u
+			return &found, nil
+		}
+	}
+
+	return nil, ierror.ErrNotFound
+}
+
+func (lm *MapStorage) GetUserByID(_ context.Context, id string) (*user.User, error) {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+
+	for _, u := range lm.Users {
+		if u.ID == id {
+			found := *u
+			return &found, nil
+		}
+	}
+
+	return nil, ierror.ErrNotFound
+}
+
+func (lm *MapStorage) SetUserRole(_ context.Context, userID string, role user.Role) error {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	for _, u := range lm.Users {
+		if u.ID == userID {
+			u.Role = role
+			return nil
+		}
+	}
+
+	return ierror.ErrNotFound
+}
@@ -0,0 +1,653 @@
+// Package storetest checks that a storage backend behaves the way the
+// use case layer expects, so every backend can run the same suite.
+package storetest
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MomsEngineer/urlshortener/internal/entities/apikey"
+	"github.com/MomsEngineer/urlshortener/internal/entities/click"
+	"github.com/MomsEngineer/urlshortener/internal/entities/link"
+	"github.com/MomsEngineer/urlshortener/internal/entities/user"
+	ierror "github.com/MomsEngineer/urlshortener/internal/errors"
+	"github.com/MomsEngineer/urlshortener/internal/usecases/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Factory returns an empty store with global uniqueness of original
+// URLs, the suite closes it when the test ends.
+type Factory func(t *testing.T) storage.StoreInterface
+
+func Run(t *testing.T, newStore Factory) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, s storage.StoreInterface)
+	}{
+		{name: "Save and get link", run: testSaveAndGet},
+		{name: "Get non-existing link", run: testGetNotFound},
+		{name: "Save taken short link", run: testSaveTaken},
+		{name: "Save duplicate original", run: testSaveDuplicate},
+		{name: "Save duplicate of expired link", run: testSaveDuplicateExpired},
+		{name: "Save batch", run: testSaveBatch},
+		{name: "Save batch with taken short link", run: testSaveBatchTaken},
+		{name: "Save batch with duplicates", run: testSaveBatchDuplicates},
+		{name: "Get links by user", run: testGetLinksByUser},
+		{name: "Delete links", run: testDeleteLinks},
+		{name: "Delete expired links", run: testDeleteExpiredLinks},
+		{name: "Save clicks and get stats", run: testClicks},
+		{name: "Save and get API keys", run: testAPIKeys},
+		{name: "Revoke API keys", run: testRevokeAPIKeys},
+		{name: "Save and get users", run: testUsers},
+		{name: "Save user with anonymous links", run: testSaveUserReassigns},
+		{name: "List links", run: testListLinks},
+		{name: "Disable link", run: testDisableLink},
+		{name: "Set link owner", run: testSetLinkOwner},
+		{name: "Set user role", run: testSetUserRole},
+		{name: "Ban users", run: testBans},
+		{name: "Count links", run: testCountLinks},
+		{name: "Count user links", run: testCountUserLinks},
+		{name: "Daily usage", run: testDailyUsage},
+		{name: "Secrets", run: testSecrets},
+		{name: "Concurrent access", run: testConcurrency},
+		{name: "Ping", run: testPing},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newStore(t)
+			t.Cleanup(func() {
+				assert.NoError(t, s.Close())
+			})
+
+			tt.run(t, s)
+		})
+	}
+}
+
+func save(t *testing.T, s storage.StoreInterface, userID, short, original string) *link.Link {
+	t.Helper()
+
+	l := &link.Link{UserID: userID, ShortURL: short, OriginalURL: original}
+	require.NoError(t, s.SaveLink(context.TODO(), l))
+
+	return l
+}
+
+func get(t *testing.T, s storage.StoreInterface, short string) *link.Link {
+	t.Helper()
+
+	l := &link.Link{ShortURL: short}
+	require.NoError(t, s.GetLink(context.TODO(), l))
+
+	return l
+}
+
+func testSaveAndGet(t *testing.T, s storage.StoreInterface) {
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	l := &link.Link{
+		UserID:      "owner",
+		ShortURL:    "abc123",
+		OriginalURL: "https://example.com",
+		ExpiresAt:   expiresAt,
+	}
+	require.NoError(t, s.SaveLink(context.TODO(), l))
+	save(t, s, "owner", "def456", "https://test.com")
+
+	got := get(t, s, "abc123")
+	assert.Equal(t, "owner", got.UserID)
+	assert.Equal(t, "https://example.com", got.OriginalURL)
+	assert.False(t, got.IsDeleted)
+	assert.True(t, expiresAt.Equal(got.ExpiresAt), "expected expiry does not match")
+
+	got = get(t, s, "def456")
+	assert.Equal(t, "https://test.com", got.OriginalURL)
+	assert.True(t, got.ExpiresAt.IsZero(), "link without expiry must not expire")
+}
+
+func testGetNotFound(t *testing.T, s storage.StoreInterface) {
+	save(t, s, "owner", "abc123", "https://example.com")
+
+	l := &link.Link{ShortURL: "missing"}
+	require.ErrorIs(t, s.GetLink(context.TODO(), l), ierror.ErrNotFound)
+	assert.Empty(t, l.OriginalURL)
+}
+
+func testSaveTaken(t *testing.T, s storage.StoreInterface) {
+	save(t, s, "owner", "abc123", "https://example.com")
+
+	l := &link.Link{UserID: "owner", ShortURL: "abc123", OriginalURL: "https://test.com"}
+	require.ErrorIs(t, s.SaveLink(context.TODO(), l), ierror.ErrAliasTaken)
+
+	assert.Equal(t, "https://example.com", get(t, s, "abc123").OriginalURL)
+}
+
+func testSaveDuplicate(t *testing.T, s storage.StoreInterface) {
+	save(t, s, "owner", "abc123", "https://example.com")
+
+	l := &link.Link{UserID: "stranger", ShortURL: "def456", OriginalURL: "https://example.com"}
+	require.ErrorIs(t, s.SaveLink(context.TODO(), l), ierror.ErrDuplicate)
+	assert.Equal(t, "abc123", l.ShortURL, "a duplicate must get the existing short link")
+
+	require.NoError(t, s.DeleteLinks(context.TODO(), []*link.Link{{UserID: "owner", ShortURL: "abc123"}}))
+
+	l = &link.Link{UserID: "stranger", ShortURL: "def456", OriginalURL: "https://example.com"}
+	require.NoError(t, s.SaveLink(context.TODO(), l), "a deleted link must not block its original URL")
+}
+
+func testSaveDuplicateExpired(t *testing.T, s storage.StoreInterface) {
+	expired := &link.Link{UserID: "owner", ShortURL: "abc123", OriginalURL: "https://example.com",
+		ExpiresAt: time.Now().Add(-time.Minute)}
+	require.NoError(t, s.SaveLink(context.TODO(), expired))
+
+	l := &link.Link{UserID: "owner", ShortURL: "def456", OriginalURL: "https://example.com"}
+	require.NoError(t, s.SaveLink(context.TODO(), l), "an expired link must not block its original URL")
+	assert.Equal(t, "def456", l.ShortURL)
+	assert.True(t, get(t, s, "abc123").IsDeleted, "the expired link must be replaced")
+
+	expired = &link.Link{UserID: "owner", ShortURL: "ghi789", OriginalURL: "https://test.com",
+		ExpiresAt: time.Now().Add(-time.Minute)}
+	require.NoError(t, s.SaveLink(context.TODO(), expired))
+
+	batch := []*link.Link{{UserID: "owner", ShortURL: "jkl012", OriginalURL: "https://test.com"}}
+	require.NoError(t, s.SaveLinksBatch(context.TODO(), batch))
+	assert.Equal(t, "jkl012", batch[0].ShortURL)
+}
+
+func testSaveBatch(t *testing.T, s storage.StoreInterface) {
+	batch := []*link.Link{
+		{UserID: "owner", ShortURL: "abc123", OriginalURL: "https://example.com"},
+		{UserID: "owner", ShortURL: "def456", OriginalURL: "https://test.com"},
+	}
+	require.NoError(t, s.SaveLinksBatch(context.TODO(), batch))
+
+	assert.Equal(t, "https://example.com", get(t, s, "abc123").OriginalURL)
+	assert.Equal(t, "https://test.com", get(t, s, "def456").OriginalURL)
+}
+
+func testSaveBatchTaken(t *testing.T, s storage.StoreInterface) {
+	save(t, s, "owner", "abc123", "https://example.com")
+
+	batch := []*link.Link{
+		{UserID: "owner", ShortURL: "def456", OriginalURL: "https://test.com"},
+		{UserID: "owner", ShortURL: "abc123", OriginalURL: "https://other.com"},
+	}
+	require.ErrorIs(t, s.SaveLinksBatch(context.TODO(), batch), ierror.ErrAliasTaken)
+
+	require.ErrorIs(t, s.GetLink(context.TODO(), &link.Link{ShortURL: "def456"}), ierror.ErrNotFound,
+		"a failed batch must not save any link")
+}
+
+func testSaveBatchDuplicates(t *testing.T, s storage.StoreInterface) {
+	save(t, s, "owner", "abc123", "https://example.com")
+
+	batch := []*link.Link{
+		{UserID: "owner", ShortURL: "def456", OriginalURL: "https://example.com"},
+		{UserID: "owner", ShortURL: "ghi789", OriginalURL: "https://test.com"},
+		{UserID: "owner", ShortURL: "jkl012", OriginalURL: "https://test.com"},
+	}
+	require.NoError(t, s.SaveLinksBatch(context.TODO(), batch))
+
+	assert.Equal(t, "abc123", batch[0].ShortURL, "a duplicate must get the existing short link")
+	assert.Equal(t, "ghi789", batch[2].ShortURL, "duplicates inside a batch must share a link")
+
+	links, err := s.GetLinksByUser(context.TODO(), "owner")
+	require.NoError(t, err)
+	assert.Len(t, links, 2)
+}
+
+func testGetLinksByUser(t *testing.T, s storage.StoreInterface) {
+	save(t, s, "owner", "abc123", "https://example.com")
+	save(t, s, "owner", "def456", "https://test.com")
+	save(t, s, "stranger", "ghi789", "https://other.com")
+
+	links, err := s.GetLinksByUser(context.TODO(), "owner")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"abc123": "https://example.com",
+		"def456": "https://test.com",
+	}, links)
+
+	links, err = s.GetLinksByUser(context.TODO(), "nobody")
+	require.NoError(t, err)
+	assert.Empty(t, links)
+}
+
+func testDeleteLinks(t *testing.T, s storage.StoreInterface) {
+	save(t, s, "owner", "abc123", "https://example.com")
+	save(t, s, "owner", "def456", "https://test.com")
+
+	err := s.DeleteLinks(context.TODO(), []*link.Link{
+		{UserID: "owner", ShortURL: "abc123"},
+		{UserID: "stranger", ShortURL: "def456"},
+		{UserID: "owner", ShortURL: "missing"},
+	})
+	require.NoError(t, err)
+
+	assert.True(t, get(t, s, "abc123").IsDeleted, "link deleted by its owner must be marked")
+	assert.False(t, get(t, s, "def456").IsDeleted, "link deleted by another user must be kept")
+
+	links, err := s.GetLinksByUser(context.TODO(), "owner")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"def456": "https://test.com"}, links)
+}
+
+func testDeleteExpiredLinks(t *testing.T, s storage.StoreInterface) {
+	now := time.Now()
+	for _, l := range []*link.Link{
+		{UserID: "owner", ShortURL: "expired", OriginalURL: "https://example.com",
+			ExpiresAt: now.Add(-time.Minute)},
+		{UserID: "owner", ShortURL: "active", OriginalURL: "https://test.com",
+			ExpiresAt: now.Add(time.Hour)},
+		{UserID: "owner", ShortURL: "forever", OriginalURL: "https://forever.com"},
+	} {
+		require.NoError(t, s.SaveLink(context.TODO(), l))
+	}
+
+	n, err := s.DeleteExpiredLinks(context.TODO(), now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	n, err = s.DeleteExpiredLinks(context.TODO(), now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), n, "expired links must be marked only once")
+
+	assert.True(t, get(t, s, "expired").IsDeleted)
+	assert.False(t, get(t, s, "active").IsDeleted)
+	assert.False(t, get(t, s, "forever").IsDeleted)
+}
+
+func testClicks(t *testing.T, s storage.StoreInterface) {
+	save(t, s, "owner", "abc123", "https://example.com")
+
+	stats, err := s.GetClickStats(context.TODO(), "abc123")
+	require.NoError(t, err)
+	assert.Equal(t, &click.Stats{Daily: []click.DailyClicks{}}, stats)
+
+	day := time.Date(2024, 10, 1, 23, 0, 0, 0, time.UTC)
+	clicked := func(short, ipHash string, at time.Time) *click.Click {
+		c := click.NewClick(short, "https://referrer.com", "agent", ipHash)
+		c.Timestamp = at
+		return c
+	}
+	err = s.SaveClicks(context.TODO(), []*click.Click{
+		clicked("abc123", "first", day),
+		clicked("def456", "second", day),
+		clicked("abc123", "first", day.Add(2*time.Hour)),
+		clicked("abc123", "third", day.Add(3*time.Hour)),
+	})
+	require.NoError(t, err)
+
+	stats, err = s.GetClickStats(context.TODO(), "abc123")
+	require.NoError(t, err)
+	assert.Equal(t, &click.Stats{
+		Total:  3,
+		Unique: 2,
+		Daily: []click.DailyClicks{
+			{Date: "2024-10-01", Clicks: 1},
+			{Date: "2024-10-02", Clicks: 2},
+		},
+	}, stats)
+}
+
+func saveAPIKey(t *testing.T, s storage.StoreInterface, userID, name string,
+	createdAt time.Time) *apikey.APIKey {
+	t.Helper()
+
+	_, k, err := apikey.New(userID, name, []apikey.Scope{apikey.ScopeRead, apikey.ScopeShorten})
+	require.NoError(t, err)
+	k.CreatedAt = createdAt
+	require.NoError(t, s.SaveAPIKey(context.TODO(), k))
+
+	return k
+}
+
+func testAPIKeys(t *testing.T, s storage.StoreInterface) {
+	now := time.Now().Truncate(time.Second)
+	second := saveAPIKey(t, s, "owner", "second", now)
+	first := saveAPIKey(t, s, "owner", "first", now.Add(-time.Minute))
+	saveAPIKey(t, s, "stranger", "other", now)
+
+	got, err := s.GetAPIKey(context.TODO(), first.Hash)
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, got.ID)
+	assert.Equal(t, "owner", got.UserID)
+	assert.Equal(t, "first", got.Name)
+	assert.Equal(t, first.Prefix, got.Prefix)
+	assert.Equal(t, first.Scopes, got.Scopes)
+	assert.True(t, first.CreatedAt.Equal(got.CreatedAt), "expected creation time does not match")
+	assert.False(t, got.IsRevoked())
+
+	_, err = s.GetAPIKey(context.TODO(), apikey.Hash("unknown"))
+	require.ErrorIs(t, err, ierror.ErrNotFound)
+
+	keys, err := s.GetAPIKeysByUser(context.TODO(), "owner")
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+	assert.Equal(t, first.ID, keys[0].ID, "keys must be listed oldest first")
+	assert.Equal(t, second.ID, keys[1].ID, "keys must be listed oldest first")
+
+	keys, err = s.GetAPIKeysByUser(context.TODO(), "nobody")
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+}
+
+func testRevokeAPIKeys(t *testing.T, s storage.StoreInterface) {
+	now := time.Now().Truncate(time.Second)
+	k := saveAPIKey(t, s, "owner", "key", now)
+
+	require.ErrorIs(t, s.RevokeAPIKey(context.TODO(), "stranger", k.ID, now), ierror.ErrNotFound,
+		"only the owner may revoke a key")
+	require.ErrorIs(t, s.RevokeAPIKey(context.TODO(), "owner", "missing", now), ierror.ErrNotFound)
+
+	got, err := s.GetAPIKey(context.TODO(), k.Hash)
+	require.NoError(t, err)
+	assert.False(t, got.IsRevoked())
+
+	require.NoError(t, s.RevokeAPIKey(context.TODO(), "owner", k.ID, now))
+	require.NoError(t, s.RevokeAPIKey(context.TODO(), "owner", k.ID, now.Add(time.Hour)),
+		"revoking a revoked key must succeed")
+
+	got, err = s.GetAPIKey(context.TODO(), k.Hash)
+	require.NoError(t, err)
+	assert.True(t, now.Equal(got.RevokedAt), "the first revocation time must be kept")
+}
+
+func testUsers(t *testing.T, s storage.StoreInterface) {
+	u := &user.User{
+		ID:           "account",
+		Login:        "alice",
+		PasswordHash: "hash",
+		Role:         user.RoleUser,
+		CreatedAt:    time.Now().Truncate(time.Second),
+	}
+	require.NoError(t, s.SaveUser(context.TODO(), u, ""))
+
+	got, err := s.GetUserByLogin(context.TODO(), "alice")
+	require.NoError(t, err)
+	assert.Equal(t, u.ID, got.ID)
+	assert.Equal(t, u.PasswordHash, got.PasswordHash)
+	assert.Equal(t, user.RoleUser, got.Role)
+	assert.True(t, u.CreatedAt.Equal(got.CreatedAt), "expected creation time does not match")
+
+	got, err = s.GetUserByID(context.TODO(), "account")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", got.Login)
+	_, err = s.GetUserByID(context.TODO(), "missing")
+	require.ErrorIs(t, err, ierror.ErrNotFound)
+
+	taken := &user.User{ID: "other", Login: "alice", PasswordHash: "hash", CreatedAt: time.Now()}
+	require.ErrorIs(t, s.SaveUser(context.TODO(), taken, ""), ierror.ErrDuplicate)
+
+	_, err = s.GetUserByLogin(context.TODO(), "bob")
+	require.ErrorIs(t, err, ierror.ErrNotFound)
+}
+
+func testSaveUserReassigns(t *testing.T, s storage.StoreInterface) {
+	save(t, s, "anonymous", "abc", "https://a.example.com")
+	deleted := save(t, s, "anonymous", "def", "https://b.example.com")
+	save(t, s, "stranger", "ghi", "https://c.example.com")
+	require.NoError(t, s.DeleteLinks(context.TODO(), []*link.Link{deleted}))
+	k := saveAPIKey(t, s, "anonymous", "key", time.Now().Truncate(time.Second))
+
+	taken := &user.User{ID: "account", Login: "alice", PasswordHash: "hash", CreatedAt: time.Now()}
+	require.NoError(t, s.SaveUser(context.TODO(), &user.User{
+		ID: "first", Login: "alice", PasswordHash: "hash", CreatedAt: time.Now(),
+	}, ""))
+	require.ErrorIs(t, s.SaveUser(context.TODO(), taken, "anonymous"), ierror.ErrDuplicate)
+	assert.Equal(t, "anonymous", get(t, s, "abc").UserID, "a failed save must not move links")
+
+	require.NoError(t, s.SaveUser(context.TODO(), &user.User{
+		ID: "account", Login: "bob", PasswordHash: "hash", CreatedAt: time.Now(),
+	}, "anonymous"))
+
+	links, err := s.GetLinksByUser(context.TODO(), "account")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"abc": "https://a.example.com"}, links)
+
+	links, err = s.GetLinksByUser(context.TODO(), "anonymous")
+	require.NoError(t, err)
+	assert.Empty(t, links)
+
+	assert.Equal(t, "account", get(t, s, "abc").UserID)
+	assert.Equal(t, "stranger", get(t, s, "ghi").UserID)
+
+	got, err := s.GetAPIKey(context.TODO(), k.Hash)
+	require.NoError(t, err)
+	assert.Equal(t, "account", got.UserID)
+}
+
+func testListLinks(t *testing.T, s storage.StoreInterface) {
+	save(t, s, "alice", "ccc", "https://example.com/Cats")
+	save(t, s, "bob", "aaa", "https://example.com/dogs")
+	save(t, s, "alice", "bbb", "https://example.org/100%_cats")
+	deleted := save(t, s, "alice", "ddd", "https://example.com/cats/deleted")
+	require.NoError(t, s.DeleteLinks(context.TODO(), []*link.Link{deleted}))
+
+	shorts := func(f link.Filter) []string {
+		links, err := s.ListLinks(context.TODO(), f)
+		require.NoError(t, err)
+
+		res := []string{}
+		for _, l := range links {
+			res = append(res, l.ShortURL)
+		}
+		return res
+	}
+
+	assert.Equal(t, []string{"aaa", "bbb", "ccc"}, shorts(link.Filter{}),
+		"live links must be listed by short URL")
+	assert.Equal(t, []string{"bbb", "ccc"}, shorts(link.Filter{Query: "CATS"}))
+	assert.Equal(t, []string{"bbb"}, shorts(link.Filter{Query: "100%_"}),
+		"wildcards in the query must match literally")
+	assert.Equal(t, []string{"aaa"}, shorts(link.Filter{Query: "aa"}))
+	assert.Equal(t, []string{"bbb", "ccc"}, shorts(link.Filter{UserID: "alice"}))
+	assert.Equal(t, []string{"bbb"}, shorts(link.Filter{Limit: 1, Offset: 1}))
+	assert.Empty(t, shorts(link.Filter{Offset: 5}))
+
+	links, err := s.ListLinks(context.TODO(), link.Filter{UserID: "bob"})
+	require.NoError(t, err)
+	require.Len(t, links, 1)
+	assert.Equal(t, "https://example.com/dogs", links[0].OriginalURL)
+	assert.Equal(t, "bob", links[0].UserID)
+}
+
+func testDisableLink(t *testing.T, s storage.StoreInterface) {
+	save(t, s, "user", "abc", "https://example.com")
+
+	require.NoError(t, s.DisableLink(context.TODO(), "abc", true))
+	assert.True(t, get(t, s, "abc").IsDisabled)
+
+	links, err := s.ListLinks(context.TODO(), link.Filter{})
+	require.NoError(t, err)
+	require.Len(t, links, 1)
+	assert.True(t, links[0].IsDisabled)
+
+	require.NoError(t, s.DisableLink(context.TODO(), "abc", false))
+	assert.False(t, get(t, s, "abc").IsDisabled)
+
+	require.ErrorIs(t, s.DisableLink(context.TODO(), "missing", true), ierror.ErrNotFound)
+}
+
+func testSetLinkOwner(t *testing.T, s storage.StoreInterface) {
+	save(t, s, "alice", "abc", "https://example.com")
+
+	require.NoError(t, s.SetLinkOwner(context.TODO(), "abc", "bob"))
+	assert.Equal(t, "bob", get(t, s, "abc").UserID)
+
+	links, err := s.GetLinksByUser(context.TODO(), "alice")
+	require.NoError(t, err)
+	assert.Empty(t, links)
+
+	links, err = s.GetLinksByUser(context.TODO(), "bob")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"abc": "https://example.com"}, links)
+
+	require.ErrorIs(t, s.SetLinkOwner(context.TODO(), "missing", "bob"), ierror.ErrNotFound)
+}
+
+func testSetUserRole(t *testing.T, s storage.StoreInterface) {
+	u := &user.User{ID: "account", Login: "alice", PasswordHash: "hash", Role: user.RoleUser,
+		CreatedAt: time.Now()}
+	require.NoError(t, s.SaveUser(context.TODO(), u, ""))
+
+	require.NoError(t, s.SetUserRole(context.TODO(), "account", user.RoleModerator))
+
+	got, err := s.GetUserByLogin(context.TODO(), "alice")
+	require.NoError(t, err)
+	assert.Equal(t, user.RoleModerator, got.Role)
+
+	require.ErrorIs(t, s.SetUserRole(context.TODO(), "missing", user.RoleAdmin), ierror.ErrNotFound)
+}
+
+func testBans(t *testing.T, s storage.StoreInterface) {
+	banned, err := s.IsBanned(context.TODO(), "spammer")
+	require.NoError(t, err)
+	assert.False(t, banned)
+
+	require.NoError(t, s.BanUser(context.TODO(), "spammer", "spam", time.Now()))
+	require.NoError(t, s.BanUser(context.TODO(), "spammer", "again", time.Now()),
+		"banning a banned user must succeed")
+
+	banned, err = s.IsBanned(context.TODO(), "spammer")
+	require.NoError(t, err)
+	assert.True(t, banned)
+
+	banned, err = s.IsBanned(context.TODO(), "user")
+	require.NoError(t, err)
+	assert.False(t, banned)
+
+	require.NoError(t, s.UnbanUser(context.TODO(), "spammer"))
+	require.NoError(t, s.UnbanUser(context.TODO(), "spammer"))
+
+	banned, err = s.IsBanned(context.TODO(), "spammer")
+	require.NoError(t, err)
+	assert.False(t, banned)
+}
+
+func testCountLinks(t *testing.T, s storage.StoreInterface) {
+	urls, users, err := s.CountLinks(context.TODO())
+	require.NoError(t, err)
+	assert.Equal(t, 0, urls)
+	assert.Equal(t, 0, users)
+
+	save(t, s, "alice", "abc", "https://a.example.com")
+	save(t, s, "alice", "def", "https://b.example.com")
+	save(t, s, "bob", "ghi", "https://c.example.com")
+	deleted := save(t, s, "carol", "jkl", "https://d.example.com")
+	require.NoError(t, s.DeleteLinks(context.TODO(), []*link.Link{deleted}))
+
+	urls, users, err = s.CountLinks(context.TODO())
+	require.NoError(t, err)
+	assert.Equal(t, 3, urls, "deleted links must not be counted")
+	assert.Equal(t, 2, users, "users without live links must not be counted")
+}
+
+func testCountUserLinks(t *testing.T, s storage.StoreInterface) {
+	save(t, s, "alice", "abc", "https://a.example.com")
+	save(t, s, "bob", "def", "https://b.example.com")
+	deleted := save(t, s, "alice", "ghi", "https://c.example.com")
+	require.NoError(t, s.DeleteLinks(context.TODO(), []*link.Link{deleted}))
+
+	n, err := s.CountUserLinks(context.TODO(), "alice")
+	require.NoError(t, err)
+	assert.Equal(t, 1, n, "deleted links must not be counted")
+
+	n, err = s.CountUserLinks(context.TODO(), "carol")
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func testDailyUsage(t *testing.T, s storage.StoreInterface) {
+	today := time.Now()
+	yesterday := today.AddDate(0, 0, -1)
+
+	used, err := s.GetDailyUsage(context.TODO(), "alice", today)
+	require.NoError(t, err)
+	assert.Equal(t, 0, used)
+
+	used, err = s.AddDailyUsage(context.TODO(), "alice", today, 2, 3)
+	require.NoError(t, err)
+	assert.Equal(t, 2, used)
+
+	used, err = s.AddDailyUsage(context.TODO(), "alice", today, 2, 3)
+	require.ErrorIs(t, err, ierror.ErrQuotaExceeded)
+	assert.Equal(t, 2, used, "a rejected addition must keep the counter")
+
+	_, err = s.AddDailyUsage(context.TODO(), "alice", today, 5, 3)
+	require.ErrorIs(t, err, ierror.ErrQuotaExceeded)
+
+	used, err = s.AddDailyUsage(context.TODO(), "alice", today, 1, 3)
+	require.NoError(t, err)
+	assert.Equal(t, 3, used)
+
+	used, err = s.AddDailyUsage(context.TODO(), "alice", today, -1, 3)
+	require.NoError(t, err)
+	assert.Equal(t, 2, used, "a negative addition returns links")
+
+	used, err = s.AddDailyUsage(context.TODO(), "alice", today, 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 12, used, "a zero limit must not limit")
+
+	used, err = s.GetDailyUsage(context.TODO(), "alice", today)
+	require.NoError(t, err)
+	assert.Equal(t, 12, used)
+
+	used, err = s.GetDailyUsage(context.TODO(), "alice", yesterday)
+	require.NoError(t, err)
+	assert.Equal(t, 0, used, "days must be counted separately")
+
+	used, err = s.GetDailyUsage(context.TODO(), "bob", today)
+	require.NoError(t, err)
+	assert.Equal(t, 0, used, "users must be counted separately")
+}
+
+func testSecrets(t *testing.T, s storage.StoreInterface) {
+	secret, err := s.GetOrCreateSecret(context.TODO(), "test", []byte("first"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("first"), secret)
+
+	secret, err = s.GetOrCreateSecret(context.TODO(), "test", []byte("second"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("first"), secret, "a saved secret must not be replaced")
+
+	secret, err = s.GetOrCreateSecret(context.TODO(), "other", []byte("second"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("second"), secret)
+}
+
+func testConcurrency(t *testing.T, s storage.StoreInterface) {
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			short := "short" + strconv.Itoa(i)
+			l := &link.Link{UserID: "owner", ShortURL: short, OriginalURL: "https://example.com/" + short}
+			if !assert.NoError(t, s.SaveLink(context.TODO(), l)) {
+				return
+			}
+
+			got := &link.Link{ShortURL: short}
+			assert.NoError(t, s.GetLink(context.TODO(), got))
+			assert.Equal(t, l.OriginalURL, got.OriginalURL)
+
+			_, err := s.GetLinksByUser(context.TODO(), "owner")
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+
+	links, err := s.GetLinksByUser(context.TODO(), "owner")
+	require.NoError(t, err)
+	assert.Len(t, links, 20)
+}
+
+func testPing(t *testing.T, s storage.StoreInterface) {
+	require.NoError(t, s.Ping(context.TODO()))
+}
@@ -0,0 +1,156 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/MomsEngineer/urlshortener/internal/adapters/config"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	grpccodes "google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func record(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+
+	recorder := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	return recorder
+}
+
+func attributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+
+	return attrs
+}
+
+func TestMiddleware(t *testing.T) {
+	recorder := record(t)
+	_, err := Setup(context.Background(), &config.Config{TraceExporter: "none"})
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Middleware())
+	router.GET("/:id", func(c *gin.Context) {
+		assert.True(t, trace.SpanFromContext(c.Request.Context()).SpanContext().IsValid())
+		c.Status(http.StatusTemporaryRedirect)
+	})
+	router.GET("/api/fail", func(c *gin.Context) {
+		c.Error(errors.New("storage is down"))
+		c.Status(http.StatusInternalServerError)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/abc", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/fail", nil))
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+
+	redirect := spans[0]
+	assert.Equal(t, "GET /:id", redirect.Name())
+	assert.Equal(t, trace.SpanKindServer, redirect.SpanKind())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", redirect.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", redirect.Parent().SpanID().String())
+	assert.Equal(t, int64(http.StatusTemporaryRedirect), attributes(redirect)["http.response.status_code"].AsInt64())
+	assert.Equal(t, "/:id", attributes(redirect)["http.route"].AsString())
+	assert.Equal(t, codes.Unset, redirect.Status().Code)
+
+	failed := spans[1]
+	assert.False(t, failed.Parent().IsValid())
+	assert.Equal(t, codes.Error, failed.Status().Code)
+	require.Len(t, failed.Events(), 1)
+	assert.Equal(t, "exception", failed.Events()[0].Name)
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	recorder := record(t)
+	_, err := Setup(context.Background(), &config.Config{TraceExporter: "none"})
+	require.NoError(t, err)
+
+	interceptor := UnaryServerInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: "/shortener.v1.Shortener/GetOriginal"}
+
+	ctx := metadata.NewIncomingContext(context.Background(),
+		metadata.Pairs("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"))
+	_, err = interceptor(ctx, nil, info, func(ctx context.Context, _ any) (any, error) {
+		assert.True(t, trace.SpanFromContext(ctx).SpanContext().IsValid())
+		return nil, nil
+	})
+	require.NoError(t, err)
+
+	_, err = interceptor(context.Background(), nil, info, func(context.Context, any) (any, error) {
+		return nil, status.Error(grpccodes.Internal, "storage is down")
+	})
+	require.Error(t, err)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+
+	served := spans[0]
+	assert.Equal(t, "shortener.v1.Shortener/GetOriginal", served.Name())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", served.SpanContext().TraceID().String())
+	assert.Equal(t, "GetOriginal", attributes(served)["rpc.method"].AsString())
+	assert.Equal(t, int64(0), attributes(served)["rpc.grpc.status_code"].AsInt64())
+	assert.Equal(t, codes.Unset, served.Status().Code)
+
+	failed := spans[1]
+	assert.False(t, failed.Parent().IsValid())
+	assert.Equal(t, codes.Error, failed.Status().Code)
+}
+
+func TestSetupFileExporter(t *testing.T) {
+	prev := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	path := filepath.Join(t.TempDir(), "traces.json")
+	shutdown, err := Setup(context.Background(), &config.Config{
+		TraceExporter:    "file",
+		TraceFile:        path,
+		TraceSampleRatio: 1,
+	})
+	require.NoError(t, err)
+
+	_, span := otel.Tracer("test").Start(context.Background(), "test span")
+	span.End()
+	require.NoError(t, shutdown(context.Background()))
+
+	out, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(out), `"Name":"test span"`)
+	assert.Contains(t, string(out), "urlshortener")
+}
+
+func TestSetupErrors(t *testing.T) {
+	_, err := Setup(context.Background(), &config.Config{
+		TraceExporter: "file",
+		TraceFile:     filepath.Join(t.TempDir(), "missing", "traces.json"),
+	})
+	assert.ErrorContains(t, err, "failed to open the trace file")
+
+	_, err = Setup(context.Background(), &config.Config{TraceExporter: "zipkin"})
+	assert.ErrorContains(t, err, "unknown trace exporter")
+}
@@ -0,0 +1,83 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/MomsEngineer/urlshortener/internal/adapters/web/cookie"
+	"github.com/MomsEngineer/urlshortener/internal/entities/user"
+	"github.com/MomsEngineer/urlshortener/internal/usecases/storage"
+	"github.com/gin-gonic/gin"
+)
+
+type Credentials struct {
+	Login    string `json:"login"`
+	Password string `json:"password"`
+}
+
+type AccountResponse struct {
+	ID        string    `json:"id"`
+	Login     string    `json:"login"`
+	Role      user.Role `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func newAccountResponse(u *user.User) AccountResponse {
+	return AccountResponse{ID: u.ID, Login: u.Login, Role: u.Role, CreatedAt: u.CreatedAt}
+}
+
+func decodeCredentials(c *gin.Context) (Credentials, bool) {
+	var request Credentials
+	if err := json.NewDecoder(c.Request.Body).Decode(&request); err != nil {
+		c.Error(badRequest(err))
+		return request, false
+	}
+
+	return request, true
+}
+
+// HandleRegister creates an account and logs the user in. The links of
+// an anonymous user are moved to the account, a logged in user keeps
+// the links in the current account.
+func HandleRegister(c *gin.Context, s storage.StoregeInterface, cookies *cookie.Manager) {
+	request, ok := decodeCredentials(c)
+	if !ok {
+		return
+	}
+
+	var anonymousID string
+	if _, loggedIn := c.Get("accountID"); !loggedIn {
+		anonymousID = c.GetString("userID")
+	}
+
+	u, err := s.Register(c.Request.Context(), anonymousID, request.Login, request.Password)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	cookies.LogIn(c, u.ID)
+	c.JSON(http.StatusCreated, newAccountResponse(u))
+}
+
+func HandleLogin(c *gin.Context, s storage.StoregeInterface, cookies *cookie.Manager) {
+	request, ok := decodeCredentials(c)
+	if !ok {
+		return
+	}
+
+	u, err := s.Login(c.Request.Context(), request.Login, request.Password)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	cookies.LogIn(c, u.ID)
+	c.JSON(http.StatusOK, newAccountResponse(u))
+}
+
+func HandleLogout(c *gin.Context, cookies *cookie.Manager) {
+	cookies.LogOut(c)
+	c.Status(http.StatusNoContent)
+}
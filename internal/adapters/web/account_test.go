@@ -0,0 +1,116 @@
+package web
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/MomsEngineer/urlshortener/internal/adapters/config"
+	"github.com/MomsEngineer/urlshortener/internal/adapters/logger"
+	"github.com/MomsEngineer/urlshortener/internal/adapters/web/cookie"
+	"github.com/MomsEngineer/urlshortener/internal/adapters/web/mocks"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccountHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cookies, err := cookie.New(&config.Config{
+		JWTKeys:   "k:secret",
+		JWTIssuer: "test",
+		TokenTTL:  time.Hour,
+	}, nil, logger.NewNop())
+	require.NoError(t, err)
+
+	mockStorage := new(mocks.Storage)
+
+	router := gin.New()
+	router.Use(ErrorMiddleware())
+	router.POST("/api/user/register", func(c *gin.Context) {
+		c.Set("userID", "anonymous")
+		HandleRegister(c, mockStorage, cookies)
+	})
+	router.POST("/api/user/login", func(c *gin.Context) {
+		HandleLogin(c, mockStorage, cookies)
+	})
+	router.POST("/api/user/logout", func(c *gin.Context) {
+		HandleLogout(c, cookies)
+	})
+
+	tests := []struct {
+		name           string
+		url            string
+		body           []byte
+		expectedStatus int
+		expectedBody   string
+		wantCookie     bool
+	}{
+		{
+			name:           "Register",
+			url:            "/api/user/register",
+			body:           []byte("{\"login\":\"Alice\",\"password\":\"password\"}"),
+			expectedStatus: http.StatusCreated,
+			expectedBody:   "\"login\":\"alice\"",
+			wantCookie:     true,
+		},
+		{
+			name:           "Register taken login",
+			url:            "/api/user/register",
+			body:           []byte("{\"login\":\"taken\",\"password\":\"password\"}"),
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:           "Register short password",
+			url:            "/api/user/register",
+			body:           []byte("{\"login\":\"alice\",\"password\":\"pass\"}"),
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "invalid password",
+		},
+		{
+			name:           "Register invalid body",
+			url:            "/api/user/register",
+			body:           []byte("alice"),
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Login",
+			url:            "/api/user/login",
+			body:           []byte("{\"login\":\"user\",\"password\":\"password\"}"),
+			expectedStatus: http.StatusOK,
+			expectedBody:   "\"id\":\"account\"",
+			wantCookie:     true,
+		},
+		{
+			name:           "Login wrong password",
+			url:            "/api/user/login",
+			body:           []byte("{\"login\":\"user\",\"password\":\"wrong\"}"),
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "Logout",
+			url:            "/api/user/logout",
+			expectedStatus: http.StatusNoContent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.url, bytes.NewBuffer(tt.body))
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			assert.Contains(t, rr.Body.String(), tt.expectedBody)
+			if tt.wantCookie {
+				assert.NotEmpty(t, rr.Result().Cookies())
+			}
+		})
+	}
+
+	assert.Equal(t, "anonymous", mockStorage.MergedFrom, "links of the anonymous user must be merged")
+}
@@ -0,0 +1,180 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/MomsEngineer/urlshortener/internal/entities/link"
+	"github.com/MomsEngineer/urlshortener/internal/entities/user"
+	ierrors "github.com/MomsEngineer/urlshortener/internal/errors"
+	"github.com/MomsEngineer/urlshortener/internal/usecases/storage"
+	"github.com/gin-gonic/gin"
+)
+
+type AdminLinkResponse struct {
+	ShortURL    string     `json:"short_url"`
+	OriginalURL string     `json:"original_url"`
+	UserID      string     `json:"user_id"`
+	Disabled    bool       `json:"disabled"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+// RequireRole rejects requests of users whose role, taken from the
+// cookie, doesn't grant the required one.
+func RequireRole(required user.Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role, _ := c.Get("role")
+		if r, ok := role.(user.Role); !ok || !r.Allows(required) {
+			c.Error(fmt.Errorf("%w: %s role is required", ierrors.ErrForbidden, required))
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func queryInt(c *gin.Context, name string) (int, error) {
+	value := c.Query(name)
+	if value == "" {
+		return 0, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, badRequest(fmt.Errorf("%s must be a non-negative number", name))
+	}
+
+	return n, nil
+}
+
+// HandleListLinks searches the links of all users by the q, user_id,
+// limit and offset query parameters.
+func HandleListLinks(c *gin.Context, s storage.StoregeInterface, baseURL string) {
+	limit, err := queryInt(c, "limit")
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	offset, err := queryInt(c, "offset")
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	links, err := s.ListAllLinks(c.Request.Context(), link.Filter{
+		Query:  c.Query("q"),
+		UserID: c.Query("user_id"),
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	responses := []AdminLinkResponse{}
+	for _, l := range links {
+		response := AdminLinkResponse{
+			ShortURL:    baseURL + "/" + l.ShortURL,
+			OriginalURL: l.OriginalURL,
+			UserID:      l.UserID,
+			Disabled:    l.IsDisabled,
+		}
+		if !l.ExpiresAt.IsZero() {
+			expiresAt := l.ExpiresAt
+			response.ExpiresAt = &expiresAt
+		}
+		responses = append(responses, response)
+	}
+
+	c.JSON(http.StatusOK, responses)
+}
+
+func HandleDisableLink(c *gin.Context, s storage.StoregeInterface, disabled bool) {
+	if err := s.DisableLink(c.Request.Context(), c.Param("id"), disabled); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func HandleReassignLink(c *gin.Context, s storage.StoregeInterface) {
+	request := struct {
+		UserID string `json:"user_id"`
+	}{}
+	if err := json.NewDecoder(c.Request.Body).Decode(&request); err != nil {
+		c.Error(badRequest(err))
+		return
+	}
+
+	if request.UserID == "" {
+		c.Error(badRequest(errors.New("user_id is required")))
+		return
+	}
+
+	if err := s.ReassignLink(c.Request.Context(), c.Param("id"), request.UserID); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func HandleBanUser(c *gin.Context, s storage.StoregeInterface) {
+	request := struct {
+		Reason string `json:"reason"`
+	}{}
+	// The reason is optional, so is the body.
+	if c.Request.ContentLength != 0 {
+		if err := json.NewDecoder(c.Request.Body).Decode(&request); err != nil {
+			c.Error(badRequest(err))
+			return
+		}
+	}
+
+	if err := s.BanUser(c.Request.Context(), c.Param("id"), request.Reason); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func HandleUnbanUser(c *gin.Context, s storage.StoregeInterface) {
+	if err := s.UnbanUser(c.Request.Context(), c.Param("id")); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func HandleSetUserRole(c *gin.Context, s storage.StoregeInterface) {
+	request := struct {
+		Role string `json:"role"`
+	}{}
+	if err := json.NewDecoder(c.Request.Body).Decode(&request); err != nil {
+		c.Error(badRequest(err))
+		return
+	}
+
+	role, err := user.ParseRole(request.Role)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if err := s.SetUserRole(c.Request.Context(), c.Param("id"), role); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,187 @@
+package web
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/MomsEngineer/urlshortener/internal/adapters/web/mocks"
+	"github.com/MomsEngineer/urlshortener/internal/entities/user"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdminHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockStorage := new(mocks.Storage)
+
+	router := gin.New()
+	router.Use(ErrorMiddleware())
+	router.Use(func(c *gin.Context) {
+		if role := c.GetHeader("X-Test-Role"); role != "" {
+			c.Set("role", user.Role(role))
+		}
+	})
+
+	admin := router.Group("/api/admin", RequireRole(user.RoleModerator))
+	admin.GET("/links", func(c *gin.Context) {
+		HandleListLinks(c, mockStorage, "http://localhost:8080")
+	})
+	admin.POST("/links/:id/disable", func(c *gin.Context) {
+		HandleDisableLink(c, mockStorage, true)
+	})
+	admin.PUT("/links/:id/owner", RequireRole(user.RoleAdmin), func(c *gin.Context) {
+		HandleReassignLink(c, mockStorage)
+	})
+	admin.PUT("/bans/:id", RequireRole(user.RoleAdmin), func(c *gin.Context) {
+		HandleBanUser(c, mockStorage)
+	})
+	admin.DELETE("/bans/:id", RequireRole(user.RoleAdmin), func(c *gin.Context) {
+		HandleUnbanUser(c, mockStorage)
+	})
+	admin.PUT("/users/:id/role", RequireRole(user.RoleAdmin), func(c *gin.Context) {
+		HandleSetUserRole(c, mockStorage)
+	})
+
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		role           string
+		body           []byte
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Without role",
+			method:         http.MethodGet,
+			url:            "/api/admin/links",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "User role",
+			method:         http.MethodGet,
+			url:            "/api/admin/links",
+			role:           "user",
+			expectedStatus: http.StatusForbidden,
+			expectedBody:   "moderator role is required",
+		},
+		{
+			name:           "List links",
+			method:         http.MethodGet,
+			url:            "/api/admin/links",
+			role:           "moderator",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "\"short_url\":\"http://localhost:8080/def\"",
+		},
+		{
+			name:           "Search links",
+			method:         http.MethodGet,
+			url:            "/api/admin/links?q=EXAMPLE.ORG",
+			role:           "moderator",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "[{\"short_url\":\"http://localhost:8080/def\",\"original_url\":\"https://example.org\",\"user_id\":\"other\",\"disabled\":true}]",
+		},
+		{
+			name:           "List links with invalid limit",
+			method:         http.MethodGet,
+			url:            "/api/admin/links?limit=-1",
+			role:           "admin",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Disable link",
+			method:         http.MethodPost,
+			url:            "/api/admin/links/abc/disable",
+			role:           "moderator",
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "Disable missing link",
+			method:         http.MethodPost,
+			url:            "/api/admin/links/missing/disable",
+			role:           "moderator",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "Reassign link as moderator",
+			method:         http.MethodPut,
+			url:            "/api/admin/links/abc/owner",
+			role:           "moderator",
+			body:           []byte("{\"user_id\":\"other\"}"),
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "Reassign link",
+			method:         http.MethodPut,
+			url:            "/api/admin/links/abc/owner",
+			role:           "admin",
+			body:           []byte("{\"user_id\":\"other\"}"),
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "Reassign link without user",
+			method:         http.MethodPut,
+			url:            "/api/admin/links/abc/owner",
+			role:           "admin",
+			body:           []byte("{}"),
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Ban user",
+			method:         http.MethodPut,
+			url:            "/api/admin/bans/spammer",
+			role:           "admin",
+			body:           []byte("{\"reason\":\"spam\"}"),
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "Ban user without reason",
+			method:         http.MethodPut,
+			url:            "/api/admin/bans/spammer",
+			role:           "admin",
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "Unban user",
+			method:         http.MethodDelete,
+			url:            "/api/admin/bans/spammer",
+			role:           "admin",
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "Set role",
+			method:         http.MethodPut,
+			url:            "/api/admin/users/account/role",
+			role:           "admin",
+			body:           []byte("{\"role\":\"moderator\"}"),
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "Set unknown role",
+			method:         http.MethodPut,
+			url:            "/api/admin/users/account/role",
+			role:           "admin",
+			body:           []byte("{\"role\":\"root\"}"),
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "invalid role",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.url, bytes.NewBuffer(tt.body))
+			if tt.role != "" {
+				req.Header.Set("X-Test-Role", tt.role)
+			}
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			assert.Contains(t, rr.Body.String(), tt.expectedBody)
+		})
+	}
+}
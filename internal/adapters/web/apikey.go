@@ -0,0 +1,156 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/MomsEngineer/urlshortener/internal/adapters/logger"
+	"github.com/MomsEngineer/urlshortener/internal/entities/apikey"
+	ierrors "github.com/MomsEngineer/urlshortener/internal/errors"
+	"github.com/MomsEngineer/urlshortener/internal/usecases/storage"
+	"github.com/gin-gonic/gin"
+)
+
+const apiKeyContextKey = "apiKey"
+
+type APIKeyResponse struct {
+	ID        string         `json:"id"`
+	Name      string         `json:"name,omitempty"`
+	Prefix    string         `json:"prefix"`
+	Scopes    []apikey.Scope `json:"scopes"`
+	CreatedAt time.Time      `json:"created_at"`
+	RevokedAt *time.Time     `json:"revoked_at,omitempty"`
+	Key       string         `json:"key,omitempty"`
+}
+
+func newAPIKeyResponse(k *apikey.APIKey) APIKeyResponse {
+	res := APIKeyResponse{
+		ID:        k.ID,
+		Name:      k.Name,
+		Prefix:    k.Prefix,
+		Scopes:    k.Scopes,
+		CreatedAt: k.CreatedAt,
+	}
+
+	if k.IsRevoked() {
+		revokedAt := k.RevokedAt
+		res.RevokedAt = &revokedAt
+	}
+
+	return res
+}
+
+// APIKeyMiddleware identifies requests carrying an
+// "Authorization: Bearer <key>" header by the key owner, the other
+// requests are passed to the cookie middleware.
+func APIKeyMiddleware(s storage.StoregeInterface, cookieMiddleware gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scheme, key, ok := strings.Cut(c.GetHeader("Authorization"), " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") {
+			cookieMiddleware(c)
+			return
+		}
+
+		k, err := s.AuthenticateAPIKey(c.Request.Context(), strings.TrimSpace(key))
+		if err != nil {
+			ctx := c.Request.Context()
+			logger.FromContext(ctx).Debug(ctx, "Rejected API key", logger.Err(err))
+			c.Error(err)
+			c.Abort()
+			return
+		}
+
+		c.Set("userID", k.UserID)
+		c.Set(apiKeyContextKey, k)
+		c.Request = c.Request.WithContext(logger.WithUserID(c.Request.Context(), k.UserID))
+
+		c.Next()
+	}
+}
+
+// RequireScope rejects requests made with an API key that lacks the
+// scope, cookie requests are not limited.
+func RequireScope(scope apikey.Scope) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, exists := c.Get(apiKeyContextKey)
+		if !exists {
+			c.Next()
+			return
+		}
+
+		if k, ok := value.(*apikey.APIKey); !ok || !k.Allows(scope) {
+			c.Error(fmt.Errorf("%w: API key has no %q scope", ierrors.ErrForbidden, scope))
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func HandleCreateAPIKey(c *gin.Context, s storage.StoregeInterface) {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	request := struct {
+		Name   string         `json:"name"`
+		Scopes []apikey.Scope `json:"scopes"`
+	}{}
+	if err := json.NewDecoder(c.Request.Body).Decode(&request); err != nil {
+		c.Error(badRequest(err))
+		return
+	}
+
+	plain, k, err := s.CreateAPIKey(c.Request.Context(), userID, request.Name, request.Scopes)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	response := newAPIKeyResponse(k)
+	response.Key = plain
+
+	c.JSON(http.StatusCreated, response)
+}
+
+func HandleListAPIKeys(c *gin.Context, s storage.StoregeInterface) {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	keys, err := s.ListAPIKeys(c.Request.Context(), userID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	responses := []APIKeyResponse{}
+	for _, k := range keys {
+		responses = append(responses, newAPIKeyResponse(k))
+	}
+
+	c.JSON(http.StatusOK, responses)
+}
+
+func HandleRevokeAPIKey(c *gin.Context, s storage.StoregeInterface) {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if err := s.RevokeAPIKey(c.Request.Context(), userID, c.Param("id")); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,192 @@
+package web
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/MomsEngineer/urlshortener/internal/adapters/web/mocks"
+	"github.com/MomsEngineer/urlshortener/internal/entities/apikey"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIKeyMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockStorage := new(mocks.Storage)
+	cookieMiddleware := func(c *gin.Context) {
+		c.Set("userID", "cookieUser")
+		c.Next()
+	}
+	whoAmI := func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString("userID"))
+	}
+
+	router := gin.New()
+	router.Use(ErrorMiddleware())
+	router.Use(APIKeyMiddleware(mockStorage, cookieMiddleware))
+	router.GET("/read", RequireScope(apikey.ScopeRead), whoAmI)
+	router.POST("/shorten", RequireScope(apikey.ScopeShorten), whoAmI)
+
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		authorization  string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Cookie identity",
+			method:         http.MethodPost,
+			url:            "/shorten",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "cookieUser",
+		},
+		{
+			name:           "Key identity",
+			method:         http.MethodGet,
+			url:            "/read",
+			authorization:  "Bearer read-key",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "keyOwner",
+		},
+		{
+			name:           "Lowercase scheme",
+			method:         http.MethodPost,
+			url:            "/shorten",
+			authorization:  "bearer full-key",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "keyOwner",
+		},
+		{
+			name:           "Missing scope",
+			method:         http.MethodPost,
+			url:            "/shorten",
+			authorization:  "Bearer read-key",
+			expectedStatus: http.StatusForbidden,
+			expectedBody:   "API key has no \\\"shorten\\\" scope",
+		},
+		{
+			name:           "Unknown key",
+			method:         http.MethodGet,
+			url:            "/read",
+			authorization:  "Bearer wrong-key",
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   "\"status\":401",
+		},
+		{
+			name:           "Other scheme",
+			method:         http.MethodGet,
+			url:            "/read",
+			authorization:  "Basic dXNlcjpwYXNz",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "cookieUser",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.url, nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			assert.Contains(t, rr.Body.String(), tt.expectedBody)
+		})
+	}
+}
+
+func TestAPIKeyHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockStorage := new(mocks.Storage)
+
+	router := gin.New()
+	router.Use(ErrorMiddleware())
+	router.Use(func(c *gin.Context) {
+		c.Set("userID", "userID")
+	})
+	router.POST("/api/user/keys", func(c *gin.Context) {
+		HandleCreateAPIKey(c, mockStorage)
+	})
+	router.GET("/api/user/keys", func(c *gin.Context) {
+		HandleListAPIKeys(c, mockStorage)
+	})
+	router.DELETE("/api/user/keys/:id", func(c *gin.Context) {
+		HandleRevokeAPIKey(c, mockStorage)
+	})
+
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		body           []byte
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Create key",
+			method:         http.MethodPost,
+			url:            "/api/user/keys",
+			body:           []byte("{\"name\":\"ci\",\"scopes\":[\"shorten\"]}"),
+			expectedStatus: http.StatusCreated,
+			expectedBody:   "\"key\":\"usk_",
+		},
+		{
+			name:           "Create key with unknown scope",
+			method:         http.MethodPost,
+			url:            "/api/user/keys",
+			body:           []byte("{\"scopes\":[\"admin\"]}"),
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "invalid scope",
+		},
+		{
+			name:           "Create key with invalid body",
+			method:         http.MethodPost,
+			url:            "/api/user/keys",
+			body:           []byte("ci"),
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "List keys",
+			method:         http.MethodGet,
+			url:            "/api/user/keys",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "\"scopes\":[\"read\",\"shorten\",\"delete\"]",
+		},
+		{
+			name:           "Revoke key",
+			method:         http.MethodDelete,
+			url:            "/api/user/keys/abc",
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "Revoke missing key",
+			method:         http.MethodDelete,
+			url:            "/api/user/keys/missing",
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.url, bytes.NewBuffer(tt.body))
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			assert.Contains(t, rr.Body.String(), tt.expectedBody)
+			if tt.name == "List keys" {
+				assert.NotContains(t, rr.Body.String(), "\"key\"", "listed keys must not be shown")
+			}
+		})
+	}
+}
@@ -1,117 +1,480 @@
 package cookie
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/MomsEngineer/urlshortener/internal/adapters/config"
 	"github.com/MomsEngineer/urlshortener/internal/adapters/logger"
+	"github.com/MomsEngineer/urlshortener/internal/entities/user"
+	ierrors "github.com/MomsEngineer/urlshortener/internal/errors"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/google/uuid"
 )
 
-var log = logger.Create(logger.DebugLevel)
+const cookieName = "token"
 
+// keySecret names the signing key kept in the storage when no JWT keys
+// are configured.
+const keySecret = "jwt"
+
+// Claims identify the user. AccountID is set once the user logs in,
+// it then equals UserID.
 type Claims struct {
 	jwt.RegisteredClaims
-	UserID string
+	UserID    string
+	AccountID string `json:",omitempty"`
+}
+
+// BanList tells whether a user is banned.
+type BanList interface {
+	IsBanned(ctx context.Context, userID string) (bool, error)
+}
+
+// RoleSource returns the current role of an account.
+type RoleSource interface {
+	UserRole(ctx context.Context, userID string) (user.Role, error)
+}
+
+// SecretStore keeps generated secrets across restarts.
+type SecretStore interface {
+	Secret(ctx context.Context, name string) ([]byte, error)
+}
+
+// Key is a signing secret identified by the kid token header.
+type Key struct {
+	ID     string
+	Secret []byte
+}
+
+// Manager issues and checks the user cookies. The first key signs new
+// tokens, all keys are accepted so a rotated key keeps working until
+// it is removed from the configuration. Tokens without a key ID are
+// checked with the legacy key, if there is one.
+type Manager struct {
+	keys      []Key
+	legacyKey []byte
+	ttl       time.Duration
+	issuer    string
+	domain    string
+	secure    bool
+	sameSite  http.SameSite
+	bans      BanList
+	roles     RoleSource
+	log       *logger.Logger
+}
+
+// New creates the manager. Without configured JWT keys the signing key
+// is generated once and kept in secrets, without secrets it is lost on
+// restart.
+func New(cfg *config.Config, secrets SecretStore, log *logger.Logger) (*Manager, error) {
+	keys, err := ParseKeys(cfg.JWTKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(keys) == 0 {
+		key, err := generatedKey(secrets, log)
+		if err != nil {
+			return nil, err
+		}
+		keys = []Key{key}
+	}
+
+	sameSite, err := parseSameSite(cfg.CookieSameSite)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.TokenTTL <= 0 {
+		return nil, fmt.Errorf("token TTL must be positive, got %s", cfg.TokenTTL)
+	}
+
+	// Behind TLS the cookies never need to travel over plain HTTP.
+	m := &Manager{
+		keys:     keys,
+		ttl:      cfg.TokenTTL,
+		issuer:   cfg.JWTIssuer,
+		domain:   cfg.CookieDomain,
+		secure:   cfg.CookieSecure || cfg.EnableHTTPS,
+		sameSite: sameSite,
+		log:      log,
+	}
+	if cfg.JWTLegacyKey != "" {
+		m.legacyKey = []byte(cfg.JWTLegacyKey)
+	}
+
+	return m, nil
 }
 
-const SecretKey = "token"
+// ParseKeys parses a comma separated list of kid:secret pairs.
+func ParseKeys(s string) ([]Key, error) {
+	var keys []Key
+	seen := make(map[string]bool)
+
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
 
-func PublicCookieMiddleware() gin.HandlerFunc {
+		id, secret, ok := strings.Cut(pair, ":")
+		if !ok || id == "" || secret == "" {
+			return nil, fmt.Errorf("JWT key %q must look like kid:secret", id)
+		}
+
+		if seen[id] {
+			return nil, fmt.Errorf("duplicate JWT key id %q", id)
+		}
+		seen[id] = true
+
+		keys = append(keys, Key{ID: id, Secret: []byte(secret)})
+	}
+
+	return keys, nil
+}
+
+func parseSameSite(s string) (http.SameSite, error) {
+	switch strings.ToLower(s) {
+	case "", "default":
+		return http.SameSiteDefaultMode, nil
+	case "lax":
+		return http.SameSiteLaxMode, nil
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	}
+
+	return 0, fmt.Errorf("unknown SameSite mode %q", s)
+}
+
+func generatedKey(secrets SecretStore, log *logger.Logger) (Key, error) {
+	ctx := context.Background()
+	var secret []byte
+	if secrets != nil {
+		s, err := secrets.Secret(ctx, keySecret)
+		if err != nil {
+			return Key{}, fmt.Errorf("failed to get the generated JWT key: %w", err)
+		}
+		secret = s
+	} else {
+		log.Warn(ctx, "No JWT keys configured, cookies won't survive a restart")
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return Key{}, err
+		}
+	}
+
+	// The ID follows from the secret, so it is stable across restarts.
+	sum := sha256.Sum256(secret)
+	return Key{ID: hex.EncodeToString(sum[:4]), Secret: secret}, nil
+}
+
+// UseBanList makes the middlewares reject banned users.
+func (m *Manager) UseBanList(bans BanList) {
+	m.bans = bans
+}
+
+// UseRoles makes the middlewares look up the role of logged in users
+// on every request, without it nobody has a role.
+func (m *Manager) UseRoles(roles RoleSource) {
+	m.roles = roles
+}
+
+func (m *Manager) PublicCookieMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		cookieName := "token"
 		cookies, err := c.Request.Cookie(cookieName)
+		ctx := c.Request.Context()
 		if err != nil && !errors.Is(err, http.ErrNoCookie) {
-			log.Error("Failed to get a request cookie", err)
+			m.log.Error(ctx, "Failed to get a request cookie", err)
 			c.Status(http.StatusInternalServerError)
 			c.Abort()
 			return
 		}
 
-		var userID string
+		claims := &Claims{}
 		if errors.Is(err, http.ErrNoCookie) {
-			log.Error("No cookie", err)
-			userID = uuid.NewString()
+			m.log.Debug(ctx, "No cookie, issuing a new user")
+			claims.UserID = uuid.NewString()
 		} else if cookies != nil {
-			userID, err = checkCookie(cookies.Value)
+			claims, err = m.checkCookie(cookies.Value)
 			if err != nil {
-				log.Debug("Invalid cookie", err)
-				userID = uuid.NewString()
+				m.log.Debug(ctx, "Invalid cookie, issuing a new user", logger.Err(err))
+				claims = &Claims{UserID: uuid.NewString()}
 			}
 		}
 
-		if userID == "" {
-			log.Error("User id does not exist", nil)
+		if claims.UserID == "" {
+			m.log.Error(ctx, "User id does not exist", nil)
 			c.Status(http.StatusUnauthorized)
 			c.Abort()
 			return
 		}
 
-		c.Set("userID", userID)
-		setCookie(c, userID, cookieName)
+		if m.rejectBanned(c, claims.UserID) {
+			return
+		}
+
+		setIdentity(c, claims)
+		if m.setRole(c, claims) {
+			return
+		}
+		m.setCookie(c, claims)
 
 		c.Next()
 	}
 }
 
-func AuthCookieMiddleware() gin.HandlerFunc {
+func (m *Manager) AuthCookieMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		cookieName := "token"
+		ctx := c.Request.Context()
 		cookies, err := c.Request.Cookie(cookieName)
 		if err != nil {
-			log.Error("Failed to get a request cookie", err)
+			m.log.Debug(ctx, "No cookie", logger.Err(err))
 			c.Status(http.StatusUnauthorized)
 			c.Abort()
 			return
 		}
 
-		userID, err := checkCookie(cookies.Value)
-		if err != nil || userID == "" {
-			log.Error("User id does not exist", err)
+		claims, err := m.checkCookie(cookies.Value)
+		if err != nil || claims.UserID == "" {
+			m.log.Debug(ctx, "Invalid cookie", logger.Err(err))
 			c.Status(http.StatusUnauthorized)
 			c.Abort()
 			return
 		}
 
-		c.Set("userID", userID)
-		c.SetCookie(cookieName, cookies.Value, 3600, "/", "", false, true)
+		if m.rejectBanned(c, claims.UserID) {
+			return
+		}
+
+		setIdentity(c, claims)
+		if m.setRole(c, claims) {
+			return
+		}
+		// A fresh token extends the session and moves it to the
+		// current signing key.
+		m.setCookie(c, claims)
 
 		c.Next()
 	}
 }
 
-func setCookie(c *gin.Context, userID, cookieName string) {
-	cookie, err := buildJWTString(userID)
+// rejectBanned aborts the request of a banned user.
+func (m *Manager) rejectBanned(c *gin.Context, userID string) bool {
+	if err := m.CheckBan(c.Request.Context(), userID); err != nil {
+		c.Error(err)
+		c.Abort()
+		return true
+	}
+
+	return false
+}
+
+// CheckBan fails with ErrForbidden if the user is banned, nobody is
+// banned without a ban list.
+func (m *Manager) CheckBan(ctx context.Context, userID string) error {
+	if m.bans == nil {
+		return nil
+	}
+
+	banned, err := m.bans.IsBanned(ctx, userID)
+	if err != nil {
+		m.log.Error(ctx, "Failed to check user ban", err)
+		return err
+	}
+
+	if banned {
+		m.log.Debug(ctx, "Rejected banned user", logger.String("banned_user_id", userID))
+		return fmt.Errorf("%w: user is banned", ierrors.ErrForbidden)
+	}
+
+	return nil
+}
+
+// setIdentity stores the cookie owner in the context, the account ID
+// is set only for logged in users. The user ID is also added to the
+// log entries of the request.
+func setIdentity(c *gin.Context, claims *Claims) {
+	c.Set("userID", claims.UserID)
+	c.Request = c.Request.WithContext(logger.WithUserID(c.Request.Context(), claims.UserID))
+	if claims.AccountID != "" {
+		c.Set("accountID", claims.AccountID)
+	}
+}
+
+// setRole stores the current role of a logged in user in the context,
+// it is never taken from the token, so a changed role applies at once.
+// It aborts the request if the role cannot be looked up.
+func (m *Manager) setRole(c *gin.Context, claims *Claims) bool {
+	if claims.AccountID == "" || m.roles == nil {
+		return false
+	}
+
+	ctx := c.Request.Context()
+	role, err := m.roles.UserRole(ctx, claims.AccountID)
+	if errors.Is(err, ierrors.ErrNotFound) {
+		m.log.Debug(ctx, "Account of the token does not exist")
+		return false
+	} else if err != nil {
+		c.Error(err)
+		c.Abort()
+		return true
+	}
+
+	c.Set("role", role)
+	return false
+}
+
+// LogIn replaces the cookie with one of the account, its ID becomes
+// the user ID of the following requests.
+func (m *Manager) LogIn(c *gin.Context, accountID string) {
+	m.setCookie(c, &Claims{UserID: accountID, AccountID: accountID})
+}
+
+// LogOut removes the cookie, the next request gets a new anonymous
+// user.
+func (m *Manager) LogOut(c *gin.Context) {
+	writeCookie(c, &http.Cookie{
+		Name:     cookieName,
+		Value:    "",
+		Path:     "/",
+		Domain:   m.domain,
+		MaxAge:   -1,
+		Secure:   m.secure,
+		HttpOnly: true,
+		SameSite: m.sameSite,
+	})
+}
+
+func (m *Manager) setCookie(c *gin.Context, claims *Claims) {
+	cookie, err := m.buildJWTString(claims, time.Now())
 	if err != nil {
-		log.Error("Failed to create a cookie", err)
+		m.log.Error(c.Request.Context(), "Failed to create a cookie", err)
 		c.Status(http.StatusInternalServerError)
 		return
 	}
 
-	c.SetCookie(cookieName, cookie, 3600, "/", "", false, true)
+	writeCookie(c, &http.Cookie{
+		Name:     cookieName,
+		Value:    cookie,
+		Path:     "/",
+		Domain:   m.domain,
+		MaxAge:   int(m.ttl.Seconds()),
+		Secure:   m.secure,
+		HttpOnly: true,
+		SameSite: m.sameSite,
+	})
 }
 
-func checkCookie(tokenString string) (string, error) {
+// writeCookie replaces the cookie set earlier in the same response,
+// e.g. by the middleware before the user logs in.
+func writeCookie(c *gin.Context, cookie *http.Cookie) {
+	header := c.Writer.Header()
+	kept := header.Values("Set-Cookie")[:0:0]
+	for _, v := range header.Values("Set-Cookie") {
+		if !strings.HasPrefix(v, cookieName+"=") {
+			kept = append(kept, v)
+		}
+	}
+	header.Del("Set-Cookie")
+	for _, v := range kept {
+		header.Add("Set-Cookie", v)
+	}
+
+	http.SetCookie(c.Writer, cookie)
+}
+
+func (m *Manager) key(id string) ([]byte, error) {
+	for _, k := range m.keys {
+		if k.ID == id {
+			return k.Secret, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown key id %q", id)
+}
+
+// CheckToken validates a token passed outside of the cookie, such as in
+// gRPC metadata, the same way as the cookie.
+func (m *Manager) CheckToken(token string) (*Claims, error) {
+	claims, err := m.checkCookie(token)
+	if err != nil {
+		return nil, err
+	}
+	if claims.UserID == "" {
+		return nil, errors.New("token has no user ID")
+	}
+
+	return claims, nil
+}
+
+// IssueToken signs a fresh token for the identity of claims.
+func (m *Manager) IssueToken(claims *Claims) (string, error) {
+	return m.buildJWTString(claims, time.Now())
+}
+
+// checkCookie accepts tokens signed with any configured key that carry
+// this issuer and valid exp and iat claims. Tokens without a key ID
+// predate key rotation and carry only the user ID, they are accepted
+// under the legacy key and replaced by the middlewares.
+func (m *Manager) checkCookie(tokenString string) (*Claims, error) {
 	claims := &Claims{}
+	legacy := false
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
-		return []byte(SecretKey), nil
-	})
+		id, ok := t.Header["kid"].(string)
+		if !ok && m.legacyKey != nil {
+			legacy = true
+			return m.legacyKey, nil
+		}
+		return m.key(id)
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
 	if err != nil || !token.Valid {
-		log.Error("Invalid or expired token:", err)
-		return "", err
+		return nil, err
+	}
+
+	if legacy {
+		return &Claims{UserID: claims.UserID}, nil
+	}
+
+	now := time.Now()
+	switch {
+	case !claims.VerifyExpiresAt(now, true):
+		return nil, errors.New("token has no expiry")
+	case !claims.VerifyIssuedAt(now, true):
+		return nil, errors.New("token has no issue time")
+	case claims.Issuer != m.issuer:
+		return nil, fmt.Errorf("token is issued by %q", claims.Issuer)
 	}
 
-	return claims.UserID, nil
+	return claims, nil
 }
 
-func buildJWTString(userID string) (string, error) {
+// buildJWTString signs the identity of claims with fresh registered
+// claims.
+func (m *Manager) buildJWTString(claims *Claims, now time.Time) (string, error) {
+	key := m.keys[0]
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
-		UserID: userID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    m.issuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(m.ttl)),
+		},
+		UserID:    claims.UserID,
+		AccountID: claims.AccountID,
 	})
+	token.Header["kid"] = key.ID
 
-	tokenString, err := token.SignedString([]byte(SecretKey))
+	tokenString, err := token.SignedString(key.Secret)
 	if err != nil {
 		return "", err
 	}
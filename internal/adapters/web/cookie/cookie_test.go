@@ -0,0 +1,383 @@
+package cookie
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/MomsEngineer/urlshortener/internal/adapters/config"
+	"github.com/MomsEngineer/urlshortener/internal/adapters/logger"
+	"github.com/MomsEngineer/urlshortener/internal/entities/user"
+	ierrors "github.com/MomsEngineer/urlshortener/internal/errors"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newManager(t *testing.T, keys string) *Manager {
+	t.Helper()
+
+	m, err := New(&config.Config{
+		JWTKeys:        keys,
+		JWTIssuer:      "test",
+		TokenTTL:       time.Hour,
+		CookieDomain:   "example.com",
+		CookieSecure:   true,
+		CookieSameSite: "strict",
+	}, nil, logger.NewNop())
+	require.NoError(t, err)
+
+	return m
+}
+
+func signed(t *testing.T, kid, secret string, claims Claims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = kid
+	s, err := token.SignedString([]byte(secret))
+	require.NoError(t, err)
+
+	return s
+}
+
+func TestParseKeys(t *testing.T) {
+	keys, err := ParseKeys("new:first, old:second")
+	require.NoError(t, err)
+	assert.Equal(t, []Key{
+		{ID: "new", Secret: []byte("first")},
+		{ID: "old", Secret: []byte("second")},
+	}, keys)
+
+	for _, s := range []string{"secret", ":secret", "kid:", "a:1,a:2"} {
+		_, err := ParseKeys(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestNewWithoutKeys(t *testing.T) {
+	m, err := New(&config.Config{TokenTTL: time.Hour}, nil, logger.NewNop())
+	require.NoError(t, err)
+	require.Len(t, m.keys, 1)
+	assert.Len(t, m.keys[0].Secret, 32)
+
+	_, err = New(&config.Config{TokenTTL: time.Hour, CookieSameSite: "sometimes"}, nil, logger.NewNop())
+	assert.Error(t, err)
+
+	_, err = New(&config.Config{}, nil, logger.NewNop())
+	assert.Error(t, err)
+}
+
+type secretStore map[string][]byte
+
+func (s secretStore) Secret(_ context.Context, name string) ([]byte, error) {
+	if s[name] == nil {
+		s[name] = []byte("generated secret " + name)
+	}
+	return s[name], nil
+}
+
+func TestNewWithStoredKey(t *testing.T) {
+	secrets := secretStore{}
+	cfg := &config.Config{JWTIssuer: "test", TokenTTL: time.Hour}
+
+	m, err := New(cfg, secrets, logger.NewNop())
+	require.NoError(t, err)
+	token, err := m.IssueToken(&Claims{UserID: "user"})
+	require.NoError(t, err)
+
+	restarted, err := New(cfg, secrets, logger.NewNop())
+	require.NoError(t, err)
+	claims, err := restarted.CheckToken(token)
+	require.NoError(t, err, "tokens must survive a restart")
+	assert.Equal(t, "user", claims.UserID)
+}
+
+func TestNewWithHTTPS(t *testing.T) {
+	m, err := New(&config.Config{TokenTTL: time.Hour}, nil, logger.NewNop())
+	require.NoError(t, err)
+	assert.False(t, m.secure)
+
+	m, err = New(&config.Config{TokenTTL: time.Hour, EnableHTTPS: true}, nil, logger.NewNop())
+	require.NoError(t, err)
+	assert.True(t, m.secure, "cookies must be secure when TLS is on")
+}
+
+func TestCheckCookie(t *testing.T) {
+	m := newManager(t, "new:first,old:second")
+	now := time.Now()
+	valid := jwt.RegisteredClaims{
+		Issuer:    "test",
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+	}
+
+	built, err := m.buildJWTString(&Claims{UserID: "user"}, now)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{name: "Built token", token: built},
+		{name: "Rotated key", token: signed(t, "old", "second", Claims{valid, "user", ""})},
+		{name: "Unknown key", token: signed(t, "gone", "second", Claims{valid, "user", ""}), wantErr: true},
+		{name: "Wrong secret", token: signed(t, "new", "second", Claims{valid, "user", ""}), wantErr: true},
+		{name: "Without kid", token: signed(t, "", "first", Claims{valid, "user", ""}), wantErr: true},
+		{
+			name: "Without expiry",
+			token: signed(t, "new", "first", Claims{jwt.RegisteredClaims{
+				Issuer: "test", IssuedAt: valid.IssuedAt,
+			}, "user", ""}),
+			wantErr: true,
+		},
+		{
+			name: "Expired",
+			token: signed(t, "new", "first", Claims{jwt.RegisteredClaims{
+				Issuer: "test", IssuedAt: valid.IssuedAt,
+				ExpiresAt: jwt.NewNumericDate(now.Add(-time.Minute)),
+			}, "user", ""}),
+			wantErr: true,
+		},
+		{
+			name: "Without issue time",
+			token: signed(t, "new", "first", Claims{jwt.RegisteredClaims{
+				Issuer: "test", ExpiresAt: valid.ExpiresAt,
+			}, "user", ""}),
+			wantErr: true,
+		},
+		{
+			name: "Issued in the future",
+			token: signed(t, "new", "first", Claims{jwt.RegisteredClaims{
+				Issuer: "test", ExpiresAt: valid.ExpiresAt,
+				IssuedAt: jwt.NewNumericDate(now.Add(time.Minute)),
+			}, "user", ""}),
+			wantErr: true,
+		},
+		{
+			name: "Other issuer",
+			token: signed(t, "new", "first", Claims{jwt.RegisteredClaims{
+				Issuer: "other", IssuedAt: valid.IssuedAt, ExpiresAt: valid.ExpiresAt,
+			}, "user", ""}),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := m.checkCookie(tt.token)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "user", claims.UserID)
+		})
+	}
+}
+
+func TestLegacyToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	legacy := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"UserID": "user", "AccountID": "admin"})
+	token, err := legacy.SignedString([]byte("token"))
+	require.NoError(t, err)
+
+	_, err = newManager(t, "new:first").checkCookie(token)
+	assert.Error(t, err, "tokens without kid need the legacy key")
+
+	m, err := New(&config.Config{
+		JWTKeys: "new:first", JWTLegacyKey: "token", JWTIssuer: "test", TokenTTL: time.Hour,
+	}, nil, logger.NewNop())
+	require.NoError(t, err)
+
+	claims, err := m.checkCookie(token)
+	require.NoError(t, err)
+	assert.Equal(t, &Claims{UserID: "user"}, claims, "only the user ID is taken from legacy tokens")
+
+	router := gin.New()
+	router.GET("/", m.AuthCookieMiddleware(), func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString("userID"))
+	})
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: cookieName, Value: token})
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "user", rr.Body.String())
+	cookies := rr.Result().Cookies()
+	require.Len(t, cookies, 1)
+	reissued, _, err := jwt.NewParser().ParseUnverified(cookies[0].Value, &Claims{})
+	require.NoError(t, err)
+	assert.Equal(t, "new", reissued.Header["kid"], "legacy tokens must be re-issued")
+}
+
+func TestAuthCookieMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	m := newManager(t, "new:first,old:second")
+	router := gin.New()
+	router.GET("/", m.AuthCookieMiddleware(), func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString("userID"))
+	})
+
+	now := time.Now()
+	old := signed(t, "old", "second", Claims{jwt.RegisteredClaims{
+		Issuer:    "test",
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+	}, "user", ""})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: cookieName, Value: old})
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "user", rr.Body.String())
+
+	cookies := rr.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, "example.com", cookies[0].Domain)
+	assert.Equal(t, 3600, cookies[0].MaxAge)
+	assert.True(t, cookies[0].Secure)
+	assert.True(t, cookies[0].HttpOnly)
+	assert.Equal(t, http.SameSiteStrictMode, cookies[0].SameSite)
+
+	token, _, err := jwt.NewParser().ParseUnverified(cookies[0].Value, &Claims{})
+	require.NoError(t, err)
+	assert.Equal(t, "new", token.Header["kid"], "the cookie must be re-signed with the current key")
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
+func TestLogInAndOut(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	roles := roleSource{"account": user.RoleModerator}
+	m := newManager(t, "new:first")
+	m.UseRoles(roles)
+	router := gin.New()
+	router.POST("/login", m.PublicCookieMiddleware(), func(c *gin.Context) {
+		m.LogIn(c, "account")
+	})
+	router.POST("/logout", func(c *gin.Context) {
+		m.LogOut(c)
+	})
+	router.GET("/", m.AuthCookieMiddleware(), func(c *gin.Context) {
+		role, _ := c.Get("role")
+		c.String(http.StatusOK, "%s %s %s", c.GetString("userID"), c.GetString("accountID"), role)
+	})
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/login", nil))
+
+	cookies := rr.Result().Cookies()
+	require.Len(t, cookies, 1, "the anonymous cookie must be replaced")
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(cookies[0])
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "account account moderator", rr.Body.String())
+
+	roles["account"] = user.RoleUser
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(cookies[0])
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "account account user", rr.Body.String(), "a demotion must apply to the old token")
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/logout", nil))
+	cookies = rr.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, -1, cookies[0].MaxAge)
+}
+
+type roleSource map[string]user.Role
+
+func (r roleSource) UserRole(_ context.Context, userID string) (user.Role, error) {
+	role, ok := r[userID]
+	if !ok {
+		return "", ierrors.ErrNotFound
+	}
+	return role, nil
+}
+
+type banList map[string]bool
+
+func (b banList) IsBanned(_ context.Context, userID string) (bool, error) {
+	return b[userID], nil
+}
+
+func TestBannedUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	m := newManager(t, "new:first")
+	m.UseBanList(banList{"banned": true})
+
+	var errs []error
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Next()
+		for _, err := range c.Errors {
+			errs = append(errs, err.Err)
+		}
+	})
+	router.GET("/", m.PublicCookieMiddleware(), func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString("userID"))
+	})
+
+	for _, userID := range []string{"banned", "user"} {
+		token, err := m.buildJWTString(&Claims{UserID: userID}, time.Now())
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.AddCookie(&http.Cookie{Name: cookieName, Value: token})
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if userID == "banned" {
+			require.Len(t, errs, 1)
+			assert.ErrorIs(t, errs[0], ierrors.ErrForbidden)
+			assert.Empty(t, rr.Body.String())
+		} else {
+			assert.Equal(t, "user", rr.Body.String())
+		}
+	}
+}
+
+func TestCheckToken(t *testing.T) {
+	m := newManager(t, "new:first")
+	m.UseBanList(banList{"banned": true})
+
+	token, err := m.IssueToken(&Claims{UserID: "user", AccountID: "user"})
+	require.NoError(t, err)
+
+	claims, err := m.CheckToken(token)
+	require.NoError(t, err)
+	assert.Equal(t, "user", claims.UserID)
+	assert.Equal(t, "user", claims.AccountID)
+
+	empty, err := m.IssueToken(&Claims{})
+	require.NoError(t, err)
+	_, err = m.CheckToken(empty)
+	assert.Error(t, err)
+
+	_, err = m.CheckToken("not a token")
+	assert.Error(t, err)
+
+	assert.NoError(t, m.CheckBan(context.TODO(), "user"))
+	assert.ErrorIs(t, m.CheckBan(context.TODO(), "banned"), ierrors.ErrForbidden)
+}
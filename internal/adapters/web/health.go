@@ -0,0 +1,29 @@
+package web
+
+import (
+	"net/http"
+
+	"github.com/MomsEngineer/urlshortener/internal/adapters/health"
+	"github.com/gin-gonic/gin"
+)
+
+// HandleHealthz tells that the process is up, it checks no dependency
+// so a broken database doesn't get the service restarted.
+func HandleHealthz(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{"status": health.StatusOK})
+}
+
+// HandleReadyz answers 200 if the service can take traffic and 503
+// otherwise, with the status and latency of every check.
+func HandleReadyz(c *gin.Context, checker *health.Checker) {
+	report := checker.Ready(c.Request.Context())
+
+	status := http.StatusOK
+	if !report.OK() {
+		status = http.StatusServiceUnavailable
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(status, report)
+}
@@ -0,0 +1,62 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/MomsEngineer/urlshortener/internal/adapters/health"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var diskErr error
+	checker := health.NewChecker(
+		health.Check{Name: "storage", Run: func(context.Context) error { return nil }},
+		health.Check{Name: "disk", Run: func(context.Context) error { return diskErr }},
+	)
+
+	router := gin.New()
+	router.GET("/healthz", HandleHealthz)
+	router.GET("/readyz", func(c *gin.Context) {
+		HandleReadyz(c, checker)
+	})
+
+	get := func(path string) (int, health.Report) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+
+		var report health.Report
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+		return w.Code, report
+	}
+
+	code, report := get("/readyz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, health.StatusOK, report.Status)
+	assert.Equal(t, health.StatusOK, report.Checks["disk"].Status)
+
+	diskErr = errors.New("read-only file system")
+	code, report = get("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, health.StatusFailing, report.Status)
+	assert.Equal(t, "read-only file system", report.Checks["disk"].Error)
+	assert.Equal(t, health.StatusOK, report.Checks["storage"].Status)
+
+	diskErr = nil
+	checker.Drain()
+	code, report = get("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, health.StatusDraining, report.Status)
+
+	code, report = get("/healthz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, health.StatusOK, report.Status)
+}
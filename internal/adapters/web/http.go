@@ -4,20 +4,24 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"time"
 
 	"github.com/MomsEngineer/urlshortener/internal/adapters/logger"
+	"github.com/MomsEngineer/urlshortener/internal/adapters/metrics"
+	"github.com/MomsEngineer/urlshortener/internal/entities/link"
 	ierrors "github.com/MomsEngineer/urlshortener/internal/errors"
 	"github.com/MomsEngineer/urlshortener/internal/usecases/storage"
 	"github.com/gin-gonic/gin"
 )
 
-var log = logger.Create(logger.InfoLevel)
-
 type BatchRequest struct {
-	CorrelationID string `json:"correlation_id"`
-	OriginalURL   string `json:"original_url"`
+	CorrelationID string     `json:"correlation_id"`
+	OriginalURL   string     `json:"original_url"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	TTLSeconds    int64      `json:"ttl_seconds,omitempty"`
 }
 
 type BatchResponse struct {
@@ -28,54 +32,91 @@ type BatchResponse struct {
 func getUserIDFromContext(c *gin.Context) (string, error) {
 	userID, exists := c.Get("userID")
 	if !exists {
-		log.Error("User ID not found in context", nil)
 		return "", errors.New("user ID not found in context")
 	}
 
 	userIDStr, ok := userID.(string)
 	if !ok {
-		log.Error("User ID is not a string", nil)
 		return "", errors.New("user ID is not a string")
 	}
 
-	log.Debug("User ID:", userIDStr)
-
 	return userIDStr, nil
 }
 
 func HandleGet(c *gin.Context, s storage.StoregeInterface) {
 	userID, err := getUserIDFromContext(c)
 	if err != nil {
-		c.Status(http.StatusInternalServerError)
+		c.Error(err)
 		return
 	}
 
 	id := c.Param("id")
 	link, err := s.GetLink(c.Request.Context(), userID, id)
 	if err != nil {
-		c.String(http.StatusNotFound, "Link not found")
+		c.Error(err)
 		return
 	}
 
+	ctx := c.Request.Context()
+	err = s.RecordClick(ctx, id, c.Request.Referer(), c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		logger.FromContext(ctx).Error(ctx, "Failed to record click", err, logger.String("code", id))
+	}
+
+	metrics.RedirectServed()
 	c.Redirect(http.StatusTemporaryRedirect, link)
 }
 
+func HandleGetLinkStats(c *gin.Context, s storage.StoregeInterface) {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	id := c.Param("id")
+	stats, err := s.GetLinkStats(c.Request.Context(), userID, id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	type daily struct {
+		Date   string `json:"date"`
+		Clicks int    `json:"clicks"`
+	}
+
+	response := struct {
+		TotalClicks    int     `json:"total_clicks"`
+		UniqueVisitors int     `json:"unique_visitors"`
+		Daily          []daily `json:"daily"`
+	}{
+		TotalClicks:    stats.Total,
+		UniqueVisitors: stats.Unique,
+		Daily:          []daily{},
+	}
+
+	for _, d := range stats.Daily {
+		response.Daily = append(response.Daily, daily{Date: d.Date, Clicks: d.Clicks})
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
 func HandleGetUserURL(c *gin.Context, s storage.StoregeInterface, baseURL string) {
 	userID, err := getUserIDFromContext(c)
 	if err != nil {
-		c.Status(http.StatusInternalServerError)
+		c.Error(err)
 		return
 	}
 
 	links, err := s.GetLinksByUser(c.Request.Context(), userID)
 	if err != nil {
 		if errors.Is(err, ierrors.ErrNoContent) {
-			log.Debug("Get links by user", err)
 			c.Status(http.StatusNoContent)
 			return
 		}
-		log.Error("Failed to get link by user", err)
-		c.String(http.StatusInternalServerError, "Failed to get link by user")
+		c.Error(err)
 		return
 	}
 
@@ -98,9 +139,33 @@ func HandleGetUserURL(c *gin.Context, s storage.StoregeInterface, baseURL string
 
 }
 
+func HandleDeleteUserURLs(c *gin.Context, s storage.StoregeInterface) {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	var shorts []string
+	if err := json.NewDecoder(c.Request.Body).Decode(&shorts); err != nil {
+		c.Error(badRequest(err))
+		return
+	}
+
+	if err := s.DeleteLinks(c.Request.Context(), userID, shorts); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusAccepted)
+}
+
 func HandlePing(c *gin.Context, s storage.StoregeInterface) {
 	if err := s.Ping(c.Request.Context()); err != nil {
-		c.Status(http.StatusInternalServerError)
+		if !errors.Is(err, ierrors.ErrStorageUnavailable) {
+			err = fmt.Errorf("%w: %v", ierrors.ErrStorageUnavailable, err)
+		}
+		c.Error(err)
 		return
 	}
 
@@ -110,25 +175,26 @@ func HandlePing(c *gin.Context, s storage.StoregeInterface) {
 func HandlePost(c *gin.Context, s storage.StoregeInterface, baseURL string) {
 	userID, err := getUserIDFromContext(c)
 	if err != nil {
-		c.Status(http.StatusInternalServerError)
+		c.Error(err)
 		return
 	}
 
 	link, err := io.ReadAll(c.Request.Body)
 	if err != nil {
-		c.String(http.StatusInternalServerError, "Unable to read request body")
+		c.Error(badRequest(err))
 		return
 	}
 
 	shortURL, err := s.SaveLink(c.Request.Context(), userID, string(link))
 	if err != nil {
 		if errors.Is(err, ierrors.ErrDuplicate) {
-			log.Error("Error: Duplicate entry for "+string(link), err)
+			ctx := c.Request.Context()
+			logger.FromContext(ctx).Debug(ctx, "Link already shortened", logger.String("url", string(link)))
 			c.String(http.StatusConflict, baseURL+"/"+shortURL)
 			return
 		}
 
-		c.String(http.StatusInternalServerError, "Failed to save link")
+		c.Error(err)
 		return
 	}
 	c.String(http.StatusCreated, baseURL+"/"+shortURL)
@@ -137,36 +203,50 @@ func HandlePost(c *gin.Context, s storage.StoregeInterface, baseURL string) {
 func HandlePostAPI(c *gin.Context, s storage.StoregeInterface, baseURL string) {
 	userID, err := getUserIDFromContext(c)
 	if err != nil {
-		c.Status(http.StatusInternalServerError)
+		c.Error(err)
 		return
 	}
 
 	var buf bytes.Buffer
 	if _, err := buf.ReadFrom(c.Request.Body); err != nil {
-		http.Error(c.Writer, err.Error(), http.StatusBadRequest)
+		c.Error(badRequest(err))
 		return
 	}
 
 	request := struct {
-		URL string `json:"url"`
+		URL        string     `json:"url"`
+		Alias      string     `json:"alias,omitempty"`
+		ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+		TTLSeconds int64      `json:"ttl_seconds,omitempty"`
 	}{}
 
 	if err := json.Unmarshal(buf.Bytes(), &request); err != nil {
-		http.Error(c.Writer, err.Error(), http.StatusBadRequest)
+		c.Error(badRequest(err))
+		return
+	}
+
+	expiresAt, err := link.ParseExpiry(request.ExpiresAt, request.TTLSeconds, time.Now())
+	if err != nil {
+		c.Error(badRequest(err))
 		return
 	}
 
 	retCode := http.StatusCreated
 
-	shortURL, err := s.SaveLink(c.Request.Context(), userID, request.URL)
+	shortURL, err := s.SaveLink(c.Request.Context(), userID, request.URL,
+		link.WithAlias(request.Alias), link.WithExpiry(expiresAt))
 	if err != nil {
-		if errors.Is(err, ierrors.ErrDuplicate) {
-			log.Error("Error: Duplicate entry for "+string(request.URL), err)
-			retCode = http.StatusConflict
-		} else {
-			c.String(http.StatusInternalServerError, "Failed to save link")
+		if errors.Is(err, ierrors.ErrAliasTaken) {
+			c.Error(fmt.Errorf("%w: %q", err, request.Alias))
+			return
+		}
+		if !errors.Is(err, ierrors.ErrDuplicate) {
+			c.Error(err)
 			return
 		}
+		ctx := c.Request.Context()
+		logger.FromContext(ctx).Debug(ctx, "Link already shortened", logger.String("url", string(request.URL)))
+		retCode = http.StatusConflict
 	}
 
 	response := struct {
@@ -181,35 +261,56 @@ func HandlePostAPI(c *gin.Context, s storage.StoregeInterface, baseURL string) {
 func HandlePostBatch(c *gin.Context, s storage.StoregeInterface, baseURL string) {
 	userID, err := getUserIDFromContext(c)
 	if err != nil {
-		c.Status(http.StatusInternalServerError)
+		c.Error(err)
 		return
 	}
 
 	var requests []BatchRequest
 	err = json.NewDecoder(c.Request.Body).Decode(&requests)
 	if err != nil {
-		log.Error("Failed to decode request", err)
-		c.String(http.StatusBadRequest, "Failed to decode request")
+		c.Error(badRequest(err))
 		return
 	}
 
-	links := make(map[string]string)
+	var items []*storage.BatchItem
 	for _, r := range requests {
-		links[r.CorrelationID] = r.OriginalURL
+		expiresAt, err := link.ParseExpiry(r.ExpiresAt, r.TTLSeconds, time.Now())
+		if err != nil {
+			c.Error(badRequest(fmt.Errorf("correlation_id %q: %w", r.CorrelationID, err)))
+			return
+		}
+
+		items = append(items, &storage.BatchItem{
+			CorrelationID: r.CorrelationID,
+			OriginalURL:   r.OriginalURL,
+			ExpiresAt:     expiresAt,
+		})
 	}
 
-	if err = s.SaveLinksBatch(c.Request.Context(), userID, links); err != nil {
-		log.Error("Failed to save links batch", err)
-		c.String(http.StatusInternalServerError, "Failed to save link")
+	if err = s.SaveLinksBatch(c.Request.Context(), userID, items); err != nil {
+		if errors.Is(err, ierrors.ErrInvalidURL) {
+			problem := NewProblem(err, c.Request.URL.Path)
+			for _, item := range items {
+				if item.Err != nil {
+					problem.Errors = append(problem.Errors, ProblemItem{
+						CorrelationID: item.CorrelationID,
+						Detail:        item.Err.Error(),
+					})
+				}
+			}
+			writeProblem(c, problem)
+			return
+		}
+		c.Error(err)
 		return
 	}
 
 	var responses []BatchResponse
-	for id, short := range links {
+	for _, item := range items {
 		responses = append(responses,
 			BatchResponse{
-				CorrelationID: id,
-				ShortURL:      baseURL + "/" + short,
+				CorrelationID: item.CorrelationID,
+				ShortURL:      baseURL + "/" + item.ShortURL,
 			})
 	}
 
@@ -17,6 +17,7 @@ func setup() *gin.Engine {
 	mockStorage := new(mocks.Storage)
 
 	router := gin.New()
+	router.Use(ErrorMiddleware())
 	router.POST("/", func(c *gin.Context) {
 		c.Set("userID", "userID")
 		HandlePost(c, mockStorage, "http://localhost:8080/")
@@ -25,10 +26,22 @@ func setup() *gin.Engine {
 		c.Set("userID", "userID")
 		HandlePostAPI(c, mockStorage, "http://localhost:8080/")
 	})
+	router.POST("/api/shorten/batch", func(c *gin.Context) {
+		c.Set("userID", "userID")
+		HandlePostBatch(c, mockStorage, "http://localhost:8080/")
+	})
 	router.GET("/:id", func(c *gin.Context) {
 		c.Set("userID", "userID")
 		HandleGet(c, mockStorage)
 	})
+	router.DELETE("/api/user/urls", func(c *gin.Context) {
+		c.Set("userID", "userID")
+		HandleDeleteUserURLs(c, mockStorage)
+	})
+	router.GET("/api/user/urls/:id/stats", func(c *gin.Context) {
+		c.Set("userID", "userID")
+		HandleGetLinkStats(c, mockStorage)
+	})
 
 	return router
 }
@@ -68,6 +81,118 @@ func TestHandler(t *testing.T) {
 			expectedStatus: http.StatusCreated,
 			expectedBody:   "{\"result\":\"http://localhost:8080/",
 		},
+		{
+			name:           "POST api request with alias",
+			method:         http.MethodPost,
+			url:            "/api/shorten",
+			body:           []byte("{\"url\":\"https://example.com\",\"alias\":\"spring-sale\"}"),
+			expectedStatus: http.StatusCreated,
+			expectedBody:   "{\"result\":\"http://localhost:8080/",
+		},
+		{
+			name:           "POST api request with reserved alias",
+			method:         http.MethodPost,
+			url:            "/api/shorten",
+			body:           []byte("{\"url\":\"https://example.com\",\"alias\":\"ping\"}"),
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "\"detail\":\"invalid alias",
+		},
+		{
+			name:           "POST api request with taken alias",
+			method:         http.MethodPost,
+			url:            "/api/shorten",
+			body:           []byte("{\"url\":\"https://example.com\",\"alias\":\"taken\"}"),
+			expectedStatus: http.StatusConflict,
+			expectedBody:   "\"detail\":\"alias is already taken: \\\"taken\\\"\"",
+		},
+		{
+			name:           "POST api request with ttl",
+			method:         http.MethodPost,
+			url:            "/api/shorten",
+			body:           []byte("{\"url\":\"https://example.com\",\"ttl_seconds\":60}"),
+			expectedStatus: http.StatusCreated,
+			expectedBody:   "{\"result\":\"http://localhost:8080/",
+		},
+		{
+			name:   "POST api request with expiry in the past",
+			method: http.MethodPost,
+			url:    "/api/shorten",
+			body: []byte("{\"url\":\"https://example.com\"," +
+				"\"expires_at\":\"2000-01-01T00:00:00Z\"}"),
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "expires_at must be in the future",
+		},
+		{
+			name:   "POST api request with both expiry and ttl",
+			method: http.MethodPost,
+			url:    "/api/shorten",
+			body: []byte("{\"url\":\"https://example.com\",\"ttl_seconds\":60," +
+				"\"expires_at\":\"2100-01-01T00:00:00Z\"}"),
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "mutually exclusive",
+		},
+		{
+			name:   "POST batch request with expiry",
+			method: http.MethodPost,
+			url:    "/api/shorten/batch",
+			body: []byte("[{\"correlation_id\":\"1\",\"original_url\":\"https://example.com\"," +
+				"\"expires_at\":\"2100-01-01T00:00:00Z\"}]"),
+			expectedStatus: http.StatusCreated,
+			expectedBody:   "\"correlation_id\":\"1\"",
+		},
+		{
+			name:           "POST request with invalid URL",
+			method:         http.MethodPost,
+			url:            "/",
+			body:           []byte("javascript:alert(1)"),
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "\"detail\":\"invalid URL\"",
+		},
+		{
+			name:           "POST api request with invalid URL",
+			method:         http.MethodPost,
+			url:            "/api/shorten",
+			body:           []byte("{\"url\":\" \"}"),
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "\"detail\":\"invalid URL\"",
+		},
+		{
+			name:   "POST batch request with invalid URL",
+			method: http.MethodPost,
+			url:    "/api/shorten/batch",
+			body: []byte("[{\"correlation_id\":\"1\",\"original_url\":\"https://example.com\"}," +
+				"{\"correlation_id\":\"2\",\"original_url\":\"ftp://example.com\"}]"),
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "\"errors\":[{\"correlation_id\":\"2\",\"detail\":\"invalid URL\"}]",
+		},
+		{
+			name:           "POST api request over the daily quota",
+			method:         http.MethodPost,
+			url:            "/api/shorten",
+			body:           []byte("{\"url\":\"https://quota.example.com\"}"),
+			expectedStatus: http.StatusTooManyRequests,
+			expectedBody:   "\"detail\":\"quota exceeded: too many links today\"",
+		},
+		{
+			name:   "POST batch request over the batch size",
+			method: http.MethodPost,
+			url:    "/api/shorten/batch",
+			body: []byte("[{\"correlation_id\":\"1\",\"original_url\":\"https://a.example.com\"}," +
+				"{\"correlation_id\":\"2\",\"original_url\":\"https://b.example.com\"}," +
+				"{\"correlation_id\":\"3\",\"original_url\":\"https://c.example.com\"}," +
+				"{\"correlation_id\":\"4\",\"original_url\":\"https://d.example.com\"}]"),
+			expectedStatus: http.StatusForbidden,
+			expectedBody:   "\"detail\":\"quota exceeded: batch is too large\"",
+		},
+		{
+			name:   "POST batch request with negative ttl",
+			method: http.MethodPost,
+			url:    "/api/shorten/batch",
+			body: []byte("[{\"correlation_id\":\"1\",\"original_url\":\"https://example.com\"," +
+				"\"ttl_seconds\":-1}]"),
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "ttl_seconds must be positive",
+		},
 		{
 			name:           "Successful GET request",
 			method:         http.MethodGet,
@@ -84,6 +209,63 @@ func TestHandler(t *testing.T) {
 			expectedStatus: http.StatusNotFound,
 			expectedBody:   "",
 		},
+		{
+			name:           "GET request for a deleted link",
+			method:         http.MethodGet,
+			url:            "/deleted",
+			body:           nil,
+			expectedStatus: http.StatusGone,
+			expectedBody:   "",
+		},
+		{
+			name:           "GET request for an expired link",
+			method:         http.MethodGet,
+			url:            "/expired",
+			body:           nil,
+			expectedStatus: http.StatusGone,
+			expectedBody:   "",
+		},
+		{
+			name:           "DELETE user urls request",
+			method:         http.MethodDelete,
+			url:            "/api/user/urls",
+			body:           []byte("[\"abc123\", \"def456\"]"),
+			expectedStatus: http.StatusAccepted,
+			expectedBody:   "",
+		},
+		{
+			name:           "DELETE user urls request with invalid body",
+			method:         http.MethodDelete,
+			url:            "/api/user/urls",
+			body:           []byte("abc123"),
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "",
+		},
+		{
+			name:           "GET link stats request",
+			method:         http.MethodGet,
+			url:            "/api/user/urls/abc123/stats",
+			body:           nil,
+			expectedStatus: http.StatusOK,
+			expectedBody: "{\"total_clicks\":3,\"unique_visitors\":2," +
+				"\"daily\":[{\"date\":\"2024-10-01\",\"clicks\":3}]}",
+		},
+		{
+			name:           "GET stats request for a link of another user",
+			method:         http.MethodGet,
+			url:            "/api/user/urls/foreign/stats",
+			body:           nil,
+			expectedStatus: http.StatusForbidden,
+			expectedBody:   "",
+		},
+		{
+			name:           "GET stats request for a non-existing link",
+			method:         http.MethodGet,
+			url:            "/api/user/urls/abc/stats",
+			body:           nil,
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   "",
+		},
 		{
 			name:           "Invalid method",
 			method:         http.MethodPut,
@@ -0,0 +1,95 @@
+package web
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/MomsEngineer/urlshortener/internal/adapters/logger"
+	ierrors "github.com/MomsEngineer/urlshortener/internal/errors"
+	"github.com/MomsEngineer/urlshortener/internal/usecases/storage"
+	"github.com/gin-gonic/gin"
+)
+
+type StatsResponse struct {
+	URLs  int `json:"urls"`
+	Users int `json:"users"`
+}
+
+// ParseTrustedSubnet parses the CIDR of the trusted subnet, an empty
+// string means there is none.
+func ParseTrustedSubnet(cidr string) (*net.IPNet, error) {
+	if cidr == "" {
+		return nil, nil
+	}
+
+	_, subnet, err := net.ParseCIDR(strings.TrimSpace(cidr))
+	if err != nil {
+		return nil, fmt.Errorf("invalid trusted subnet: %w", err)
+	}
+
+	return subnet, nil
+}
+
+// ParseTrustedProxies parses the comma separated IPs and CIDRs of the
+// proxies in front of the service, a single IP becomes a /32 or /128
+// network.
+func ParseTrustedProxies(s string) ([]*net.IPNet, error) {
+	var proxies []*net.IPNet
+	for _, proxy := range strings.Split(s, ",") {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+
+		if ip := net.ParseIP(proxy); ip != nil {
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, subnet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy: %w", err)
+		}
+		proxies = append(proxies, subnet)
+	}
+
+	return proxies, nil
+}
+
+// TrustedSubnetMiddleware lets through only requests whose X-Real-IP
+// header, set by the proxy in front of the service, is in the subnet.
+// Without a subnet every request is rejected. The header is read from
+// any client, whatever the trusted proxies are, so the route is only
+// safe behind a proxy that overwrites it. The gRPC Stats call checks
+// the peer address instead.
+func TrustedSubnetMiddleware(subnet *net.IPNet) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ip := net.ParseIP(strings.TrimSpace(c.GetHeader("X-Real-IP")))
+		if subnet == nil || ip == nil || !subnet.Contains(ip) {
+			ctx := c.Request.Context()
+			logger.FromContext(ctx).Debug(ctx, "Rejected untrusted client",
+				logger.String("real_ip", c.GetHeader("X-Real-IP")))
+			c.Error(fmt.Errorf("%w: client is not in the trusted subnet", ierrors.ErrForbidden))
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func HandleStats(c *gin.Context, s storage.StoregeInterface) {
+	stats, err := s.GetStats(c.Request.Context())
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, StatsResponse{URLs: stats.URLs, Users: stats.Users})
+}
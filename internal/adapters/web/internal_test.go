@@ -0,0 +1,114 @@
+package web
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/MomsEngineer/urlshortener/internal/adapters/web/mocks"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTrustedSubnet(t *testing.T) {
+	subnet, err := ParseTrustedSubnet("")
+	require.NoError(t, err)
+	assert.Nil(t, subnet)
+
+	subnet, err = ParseTrustedSubnet("192.168.1.0/24")
+	require.NoError(t, err)
+	assert.Equal(t, "192.168.1.0/24", subnet.String())
+
+	_, err = ParseTrustedSubnet("192.168.1.1")
+	require.Error(t, err)
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	proxies, err := ParseTrustedProxies("")
+	require.NoError(t, err)
+	assert.Empty(t, proxies)
+
+	proxies, err = ParseTrustedProxies("10.0.0.1, 192.168.0.0/16,::1")
+	require.NoError(t, err)
+	require.Len(t, proxies, 3)
+	assert.Equal(t, "10.0.0.1/32", proxies[0].String())
+	assert.Equal(t, "192.168.0.0/16", proxies[1].String())
+	assert.Equal(t, "::1/128", proxies[2].String())
+
+	_, err = ParseTrustedProxies("proxy")
+	require.Error(t, err)
+}
+
+func TestHandleStats(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockStorage := new(mocks.Storage)
+	subnet, err := ParseTrustedSubnet("192.168.1.0/24")
+	require.NoError(t, err)
+
+	newRouter := func(subnet *net.IPNet) *gin.Engine {
+		router := gin.New()
+		router.Use(ErrorMiddleware())
+		router.GET("/api/internal/stats", TrustedSubnetMiddleware(subnet), func(c *gin.Context) {
+			HandleStats(c, mockStorage)
+		})
+		return router
+	}
+
+	tests := []struct {
+		name           string
+		realIP         string
+		untrusted      bool
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Trusted client",
+			realIP:         "192.168.1.10",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "{\"urls\":3,\"users\":2}",
+		},
+		{
+			name:           "Client outside the subnet",
+			realIP:         "10.0.0.1",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "Without X-Real-IP",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "Invalid X-Real-IP",
+			realIP:         "192.168.1",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "Without trusted subnet",
+			realIP:         "192.168.1.10",
+			untrusted:      true,
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newRouter(subnet)
+			if tt.untrusted {
+				router = newRouter(nil)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/api/internal/stats", nil)
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-IP", tt.realIP)
+			}
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			assert.Contains(t, rr.Body.String(), tt.expectedBody)
+		})
+	}
+}
@@ -2,30 +2,235 @@ package mocks
 
 import (
 	"context"
-	"errors"
+	"strings"
+	"time"
+
+	"github.com/MomsEngineer/urlshortener/internal/adapters/health"
+	"github.com/MomsEngineer/urlshortener/internal/entities/apikey"
+	"github.com/MomsEngineer/urlshortener/internal/entities/click"
+	"github.com/MomsEngineer/urlshortener/internal/entities/link"
+	"github.com/MomsEngineer/urlshortener/internal/entities/user"
+	ierrors "github.com/MomsEngineer/urlshortener/internal/errors"
+	"github.com/MomsEngineer/urlshortener/internal/usecases/storage"
 )
 
-type Storage struct{}
+// Storage is a canned StoregeInterface. MergedFrom records the
+// anonymous user passed to the last Register call.
+type Storage struct {
+	MergedFrom string
+}
 
-func (s *Storage) SaveLink(context.Context, string, string) (string, error) {
+func (s *Storage) SaveLink(_ context.Context, userID, original string,
+	opts ...link.Option) (string, error) {
+	if !strings.HasPrefix(original, "http") {
+		return "", ierrors.ErrInvalidURL
+	}
+	if original == "https://quota.example.com" {
+		return "", ierrors.ErrDailyQuota
+	}
+	l, err := link.NewLink(userID, "", original, opts...)
+	if err != nil {
+		return "", err
+	}
+	if l.ShortURL == "taken" {
+		return "", ierrors.ErrAliasTaken
+	}
 	return "", nil
 }
 
-func (s *Storage) SaveLinksBatch(context.Context, string, map[string]string) error {
-	return nil
+func (s *Storage) SaveLinksBatch(_ context.Context, _ string, items []*storage.BatchItem) error {
+	if len(items) > 3 {
+		return ierrors.ErrBatchQuota
+	}
+	var err error
+	for _, item := range items {
+		if !strings.HasPrefix(item.OriginalURL, "http") {
+			item.Err = ierrors.ErrInvalidURL
+			err = ierrors.ErrInvalidURL
+		}
+	}
+	return err
 }
 
 func (s *Storage) GetLink(_ context.Context, _ string, id string) (link string, err error) {
 	if id == "abc123" {
 		return "https://example.com", nil
 	}
-	return "", errors.New("not found")
+	if id == "deleted" {
+		return "", ierrors.ErrDeleted
+	}
+	if id == "expired" {
+		return "", ierrors.ErrExpired
+	}
+	return "", ierrors.ErrNotFound
 }
 
 func (s *Storage) GetLinksByUser(context.Context, string) (map[string]string, error) {
 	return nil, nil
 }
 
+func (s *Storage) DeleteLinks(context.Context, string, []string) error {
+	return nil
+}
+
+func (s *Storage) RecordClick(context.Context, string, string, string, string) error {
+	return nil
+}
+
+func (s *Storage) GetLinkStats(_ context.Context, _ string, id string) (*click.Stats, error) {
+	switch id {
+	case "abc123":
+		return &click.Stats{
+			Total:  3,
+			Unique: 2,
+			Daily:  []click.DailyClicks{{Date: "2024-10-01", Clicks: 3}},
+		}, nil
+	case "foreign":
+		return nil, ierrors.ErrForbidden
+	}
+	return nil, ierrors.ErrNotFound
+}
+
+func (s *Storage) CreateAPIKey(_ context.Context, userID, name string,
+	scopes []apikey.Scope) (string, *apikey.APIKey, error) {
+	return apikey.New(userID, name, scopes)
+}
+
+func (s *Storage) ListAPIKeys(_ context.Context, userID string) ([]*apikey.APIKey, error) {
+	_, k, err := apikey.New(userID, "test", nil)
+	if err != nil {
+		return nil, err
+	}
+	return []*apikey.APIKey{k}, nil
+}
+
+func (s *Storage) RevokeAPIKey(_ context.Context, _, id string) error {
+	if id == "missing" {
+		return ierrors.ErrNotFound
+	}
+	return nil
+}
+
+// AuthenticateAPIKey accepts "read-key" with the read scope,
+// "shorten-key" with the shorten scope and "full-key" with all scopes.
+func (s *Storage) AuthenticateAPIKey(_ context.Context, key string) (*apikey.APIKey, error) {
+	switch key {
+	case "read-key":
+		return &apikey.APIKey{UserID: "keyOwner", Scopes: []apikey.Scope{apikey.ScopeRead}}, nil
+	case "shorten-key":
+		return &apikey.APIKey{UserID: "keyOwner", Scopes: []apikey.Scope{apikey.ScopeShorten}}, nil
+	case "full-key":
+		return &apikey.APIKey{UserID: "keyOwner", Scopes: apikey.AllScopes}, nil
+	}
+	return nil, ierrors.ErrUnauthorized
+}
+
+// Register rejects the "taken" login, other logins are validated
+// as real accounts.
+func (s *Storage) Register(_ context.Context, anonymousID, login,
+	password string) (*user.User, error) {
+	if login == "taken" {
+		return nil, ierrors.ErrDuplicate
+	}
+
+	u, err := user.NewUser(login, password)
+	if err != nil {
+		return nil, err
+	}
+	u.ID = "account"
+	s.MergedFrom = anonymousID
+
+	return u, nil
+}
+
+// Login accepts "user" with the password "password".
+func (s *Storage) Login(_ context.Context, login, password string) (*user.User, error) {
+	if login != "user" || password != "password" {
+		return nil, ierrors.ErrUnauthorized
+	}
+	return &user.User{ID: "account", Login: login}, nil
+}
+
+func (s *Storage) ListAllLinks(_ context.Context, f link.Filter) ([]*link.Link, error) {
+	links := []*link.Link{
+		{UserID: "userID", ShortURL: "abc", OriginalURL: "https://example.com"},
+		{UserID: "other", ShortURL: "def", OriginalURL: "https://example.org", IsDisabled: true},
+	}
+
+	var res []*link.Link
+	for _, l := range links {
+		if f.Matches(l) {
+			res = append(res, l)
+		}
+	}
+	return f.Page(res), nil
+}
+
+// DisableLink, ReassignLink and SetUserRole don't know "missing".
+func (s *Storage) DisableLink(_ context.Context, short string, _ bool) error {
+	if short == "missing" {
+		return ierrors.ErrNotFound
+	}
+	return nil
+}
+
+func (s *Storage) ReassignLink(_ context.Context, short, _ string) error {
+	if short == "missing" {
+		return ierrors.ErrNotFound
+	}
+	return nil
+}
+
+func (s *Storage) UserRole(_ context.Context, userID string) (user.Role, error) {
+	if userID == "missing" {
+		return "", ierrors.ErrNotFound
+	}
+	return user.RoleUser, nil
+}
+
+func (s *Storage) SetUserRole(_ context.Context, userID string, _ user.Role) error {
+	if userID == "missing" {
+		return ierrors.ErrNotFound
+	}
+	return nil
+}
+
+func (s *Storage) BanUser(_ context.Context, _, _ string) error {
+	return nil
+}
+
+func (s *Storage) UnbanUser(_ context.Context, _ string) error {
+	return nil
+}
+
+// IsBanned bans the "banned" user.
+func (s *Storage) IsBanned(_ context.Context, userID string) (bool, error) {
+	return userID == "banned", nil
+}
+
+func (s *Storage) GetStats(_ context.Context) (*storage.Stats, error) {
+	return &storage.Stats{URLs: 3, Users: 2}, nil
+}
+
+func (s *Storage) GetUsage(_ context.Context, _ string) (*storage.Usage, error) {
+	return &storage.Usage{
+		Links:          5,
+		MaxLinks:       100,
+		LinksToday:     2,
+		MaxLinksPerDay: 10,
+		MaxBatchSize:   3,
+		ResetsAt:       time.Date(2024, 10, 2, 0, 0, 0, 0, time.UTC),
+	}, nil
+}
+
+func (s *Storage) Secret(_ context.Context, name string) ([]byte, error) {
+	return []byte("secret of " + name), nil
+}
+
+func (s *Storage) HealthChecks() []health.Check {
+	return []health.Check{{Name: "storage", Run: s.Ping}}
+}
+
 func (s *Storage) Ping(_ context.Context) error {
 	return nil
 }
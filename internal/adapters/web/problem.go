@@ -0,0 +1,131 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/MomsEngineer/urlshortener/internal/adapters/logger"
+	"github.com/MomsEngineer/urlshortener/internal/entities/apikey"
+	"github.com/MomsEngineer/urlshortener/internal/entities/link"
+	"github.com/MomsEngineer/urlshortener/internal/entities/user"
+	ierrors "github.com/MomsEngineer/urlshortener/internal/errors"
+	"github.com/gin-gonic/gin"
+)
+
+const problemContentType = "application/problem+json"
+
+// errBadRequest marks errors caused by a malformed request.
+var errBadRequest = errors.New("bad request")
+
+// Problem is an RFC 7807 problem details body, Errors is an extension
+// member listing the rejected items of a batch.
+type Problem struct {
+	Type     string        `json:"type"`
+	Title    string        `json:"title"`
+	Status   int           `json:"status"`
+	Detail   string        `json:"detail,omitempty"`
+	Instance string        `json:"instance,omitempty"`
+	Errors   []ProblemItem `json:"errors,omitempty"`
+}
+
+type ProblemItem struct {
+	CorrelationID string `json:"correlation_id"`
+	Detail        string `json:"detail"`
+}
+
+// problemStatuses maps the error taxonomy to HTTP statuses,
+// the first matching error wins.
+var problemStatuses = []struct {
+	err    error
+	status int
+}{
+	{err: errBadRequest, status: http.StatusBadRequest},
+	{err: ierrors.ErrInvalidURL, status: http.StatusBadRequest},
+	{err: link.ErrInvalidAlias, status: http.StatusBadRequest},
+	{err: apikey.ErrInvalidScope, status: http.StatusBadRequest},
+	{err: user.ErrInvalidLogin, status: http.StatusBadRequest},
+	{err: user.ErrInvalidPassword, status: http.StatusBadRequest},
+	{err: user.ErrInvalidRole, status: http.StatusBadRequest},
+	{err: ierrors.ErrUnauthorized, status: http.StatusUnauthorized},
+	{err: ierrors.ErrNotFound, status: http.StatusNotFound},
+	{err: ierrors.ErrGone, status: http.StatusGone},
+	{err: ierrors.ErrForbidden, status: http.StatusForbidden},
+	{err: ierrors.ErrAliasTaken, status: http.StatusConflict},
+	{err: ierrors.ErrDuplicate, status: http.StatusConflict},
+	{err: ierrors.ErrLinksQuota, status: http.StatusForbidden},
+	{err: ierrors.ErrBatchQuota, status: http.StatusForbidden},
+	{err: ierrors.ErrQuotaExceeded, status: http.StatusTooManyRequests},
+	{err: ierrors.ErrRateLimited, status: http.StatusTooManyRequests},
+	{err: ierrors.ErrStorageUnavailable, status: http.StatusServiceUnavailable},
+}
+
+func badRequest(err error) error {
+	return fmt.Errorf("%w: %v", errBadRequest, err)
+}
+
+func errorStatus(err error) int {
+	for _, p := range problemStatuses {
+		if errors.Is(err, p.err) {
+			return p.status
+		}
+	}
+
+	return http.StatusInternalServerError
+}
+
+// NewProblem describes the error, details of unknown errors are
+// hidden from the client.
+func NewProblem(err error, instance string) *Problem {
+	status := errorStatus(err)
+
+	detail := err.Error()
+	if status == http.StatusInternalServerError {
+		detail = ""
+	}
+
+	return &Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: instance,
+	}
+}
+
+// ErrorMiddleware answers with a problem+json body for the last error
+// a handler added with c.Error, unless the handler already responded.
+func ErrorMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+
+		err := c.Errors.Last().Err
+		problem := NewProblem(err, c.Request.URL.Path)
+		if problem.Status == http.StatusInternalServerError {
+			ctx := c.Request.Context()
+			logger.FromContext(ctx).Error(ctx, "Request failed", err)
+		}
+		if errors.Is(err, ierrors.ErrDailyQuota) {
+			c.Header("Retry-After", strconv.Itoa(untilMidnight(time.Now())))
+		}
+
+		writeProblem(c, problem)
+	}
+}
+
+// untilMidnight counts the seconds until the daily quotas reset.
+func untilMidnight(now time.Time) int {
+	now = now.UTC()
+	return int(now.Truncate(24*time.Hour).Add(24*time.Hour).Sub(now).Seconds()) + 1
+}
+
+func writeProblem(c *gin.Context, problem *Problem) {
+	c.Header("Content-Type", problemContentType)
+	c.JSON(problem.Status, problem)
+}
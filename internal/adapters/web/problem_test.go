@@ -0,0 +1,105 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/MomsEngineer/urlshortener/internal/entities/link"
+	ierrors "github.com/MomsEngineer/urlshortener/internal/errors"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewProblem(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		expectedStatus int
+		expectedDetail string
+	}{
+		{"Bad request", badRequest(errors.New("bad body")), http.StatusBadRequest, "bad request: bad body"},
+		{"Invalid URL", ierrors.ErrInvalidURL, http.StatusBadRequest, "invalid URL"},
+		{"Invalid alias", fmt.Errorf("%w: too short", link.ErrInvalidAlias), http.StatusBadRequest, "invalid alias: too short"},
+		{"Not found", ierrors.ErrNotFound, http.StatusNotFound, "not found"},
+		{"Deleted", ierrors.ErrDeleted, http.StatusGone, "gone: link is deleted"},
+		{"Expired", ierrors.ErrExpired, http.StatusGone, "gone: link is expired"},
+		{"Forbidden", ierrors.ErrForbidden, http.StatusForbidden, "forbidden"},
+		{"Alias taken", ierrors.ErrAliasTaken, http.StatusConflict, "alias is already taken"},
+		{"Quota exceeded", ierrors.ErrQuotaExceeded, http.StatusTooManyRequests, "quota exceeded"},
+		{"Links quota", ierrors.ErrLinksQuota, http.StatusForbidden, "quota exceeded: too many links"},
+		{"Batch quota", ierrors.ErrBatchQuota, http.StatusForbidden, "quota exceeded: batch is too large"},
+		{"Daily quota", ierrors.ErrDailyQuota, http.StatusTooManyRequests, "quota exceeded: too many links today"},
+		{"Storage unavailable", ierrors.ErrStorageUnavailable, http.StatusServiceUnavailable, "storage unavailable"},
+		{"Unknown error", errors.New("secret"), http.StatusInternalServerError, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewProblem(tt.err, "/abc")
+			assert.Equal(t, tt.expectedStatus, p.Status)
+			assert.Equal(t, http.StatusText(tt.expectedStatus), p.Title)
+			assert.Equal(t, tt.expectedDetail, p.Detail)
+			assert.Equal(t, "about:blank", p.Type)
+			assert.Equal(t, "/abc", p.Instance)
+		})
+	}
+}
+
+func TestErrorMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(ErrorMiddleware())
+	router.GET("/missing", func(c *gin.Context) {
+		c.Error(ierrors.ErrNotFound)
+	})
+	router.GET("/written", func(c *gin.Context) {
+		c.Error(ierrors.ErrNotFound)
+		c.String(http.StatusOK, "ok")
+	})
+	router.GET("/quota", func(c *gin.Context) {
+		c.Error(ierrors.ErrDailyQuota)
+	})
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/missing", nil))
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Equal(t, "application/problem+json", rr.Header().Get("Content-Type"))
+
+	var p Problem
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &p))
+	assert.Equal(t, Problem{
+		Type:     "about:blank",
+		Title:    "Not Found",
+		Status:   http.StatusNotFound,
+		Detail:   "not found",
+		Instance: "/missing",
+	}, p)
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/written", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "ok", rr.Body.String())
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/quota", nil))
+
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.NotEmpty(t, rr.Header().Get("Retry-After"))
+}
+
+func TestUntilMidnight(t *testing.T) {
+	now := time.Date(2024, 5, 1, 23, 59, 0, 0, time.UTC)
+	assert.Equal(t, 61, untilMidnight(now))
+
+	local := time.FixedZone("UTC+3", 3*60*60)
+	assert.Equal(t, 86401, untilMidnight(time.Date(2024, 5, 2, 3, 0, 0, 0, local)))
+}
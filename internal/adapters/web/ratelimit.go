@@ -0,0 +1,80 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/MomsEngineer/urlshortener/internal/adapters/ratelimit"
+	ierrors "github.com/MomsEngineer/urlshortener/internal/errors"
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimitMiddleware limits the requests of the class by the user ID
+// set by the cookie or API key middleware and by the client IP. The
+// RateLimit-* headers follow the IETF draft, rejected requests get 429
+// with Retry-After.
+func RateLimitMiddleware(l *ratelimit.Limiter, class ratelimit.Class) gin.HandlerFunc {
+	return RateLimitCostMiddleware(l, class, func(*gin.Context) int { return 1 })
+}
+
+// RateLimitCostMiddleware is RateLimitMiddleware taking as many tokens
+// as cost tells for the request.
+func RateLimitCostMiddleware(l *ratelimit.Limiter, class ratelimit.Class,
+	cost func(*gin.Context) int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := l.Limit(class)
+		if !limit.Enabled() {
+			c.Next()
+			return
+		}
+
+		keys := []string{"ip:" + c.ClientIP()}
+		if userID := c.GetString("userID"); userID != "" {
+			keys = append(keys, "user:"+userID)
+		}
+
+		res := l.AllowN(c.Request.Context(), class, cost(c), keys...)
+
+		c.Header("RateLimit-Policy", fmt.Sprintf("%d;w=%d", limit.Burst, ceilSeconds(limit.Window())))
+		c.Header("RateLimit-Limit", strconv.Itoa(res.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+
+		if !res.Allowed {
+			c.Header("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+			c.Error(fmt.Errorf("%w: retry in %s", ierrors.ErrRateLimited,
+				res.RetryAfter.Round(time.Second)))
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// BatchCost counts the items of a JSON array body, so a batch takes a
+// token per link. The body is kept for the handler, a body that is not
+// an array costs one token and is rejected by the handler.
+func BatchCost(c *gin.Context) int {
+	body, err := io.ReadAll(c.Request.Body)
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return 1
+	}
+
+	var items []json.RawMessage
+	if err := json.Unmarshal(body, &items); err != nil {
+		return 1
+	}
+
+	return max(len(items), 1)
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
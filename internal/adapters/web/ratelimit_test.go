@@ -0,0 +1,142 @@
+package web
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/MomsEngineer/urlshortener/internal/adapters/ratelimit"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimitMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	limiter := ratelimit.New(ratelimit.NewMemoryStore(), map[ratelimit.Class]ratelimit.Limit{
+		ratelimit.ClassCreate: {Rate: 1.0 / 60, Burst: 2},
+	})
+
+	router := gin.New()
+	router.Use(ErrorMiddleware())
+	router.Use(func(c *gin.Context) {
+		c.Set("userID", c.GetHeader("X-Test-User"))
+	})
+	router.POST("/", RateLimitMiddleware(limiter, ratelimit.ClassCreate), func(c *gin.Context) {
+		c.Status(http.StatusCreated)
+	})
+	router.GET("/", RateLimitMiddleware(limiter, ratelimit.ClassRedirect), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name              string
+		method            string
+		user              string
+		ip                string
+		expectedStatus    int
+		expectedRemaining string
+		expectedRetry     string
+	}{
+		{name: "First request", method: http.MethodPost, user: "a", ip: "10.0.0.1:1",
+			expectedStatus: http.StatusCreated, expectedRemaining: "1"},
+		{name: "Second request", method: http.MethodPost, user: "a", ip: "10.0.0.1:1",
+			expectedStatus: http.StatusCreated, expectedRemaining: "0"},
+		{name: "Over the user limit", method: http.MethodPost, user: "a", ip: "10.0.0.2:1",
+			expectedStatus: http.StatusTooManyRequests, expectedRemaining: "0", expectedRetry: "60"},
+		{name: "Over the IP limit", method: http.MethodPost, user: "b", ip: "10.0.0.1:1",
+			expectedStatus: http.StatusTooManyRequests, expectedRemaining: "0", expectedRetry: "60"},
+		{name: "Other IP", method: http.MethodPost, user: "c", ip: "10.0.0.3:1",
+			expectedStatus: http.StatusCreated, expectedRemaining: "1"},
+		{name: "Unlimited class", method: http.MethodGet, user: "a", ip: "10.0.0.1:1",
+			expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/", nil)
+			req.Header.Set("X-Test-User", tt.user)
+			req.RemoteAddr = tt.ip
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			assert.Equal(t, tt.expectedRemaining, rr.Header().Get("RateLimit-Remaining"))
+			assert.Equal(t, tt.expectedRetry, rr.Header().Get("Retry-After"))
+			if tt.expectedRemaining != "" {
+				assert.Equal(t, "2", rr.Header().Get("RateLimit-Limit"))
+				assert.Equal(t, "2;w=120", rr.Header().Get("RateLimit-Policy"))
+			}
+		})
+	}
+}
+
+func TestRateLimitBatchCost(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	limiter := ratelimit.New(ratelimit.NewMemoryStore(), map[ratelimit.Class]ratelimit.Limit{
+		ratelimit.ClassCreate: {Rate: 1.0 / 60, Burst: 5},
+	})
+
+	router := gin.New()
+	router.Use(ErrorMiddleware())
+	router.POST("/", RateLimitCostMiddleware(limiter, ratelimit.ClassCreate, BatchCost), func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		c.String(http.StatusCreated, "%s", body)
+	})
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := post(`[{"original_url":"a"},{"original_url":"b"},{"original_url":"c"}]`)
+	require.Equal(t, http.StatusCreated, rr.Code)
+	assert.Equal(t, "2", rr.Header().Get("RateLimit-Remaining"), "a batch must take a token per item")
+	assert.Contains(t, rr.Body.String(), `"original_url":"c"`, "the body must be kept for the handler")
+
+	rr = post("not json")
+	require.Equal(t, http.StatusCreated, rr.Code)
+	assert.Equal(t, "1", rr.Header().Get("RateLimit-Remaining"))
+
+	rr = post(`[{"original_url":"a"},{"original_url":"b"}]`)
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+}
+
+func TestRateLimitTrustedProxies(t *testing.T) {
+	limiter := ratelimit.New(ratelimit.NewMemoryStore(), map[ratelimit.Class]ratelimit.Limit{
+		ratelimit.ClassCreate: {Rate: 1.0 / 60, Burst: 1},
+	})
+
+	proxies, err := ParseTrustedProxies("10.0.0.1")
+	require.NoError(t, err)
+	router, err := NewRouter(proxies)
+	require.NoError(t, err)
+	router.Use(ErrorMiddleware())
+	router.POST("/", RateLimitMiddleware(limiter, ratelimit.ClassCreate), func(c *gin.Context) {
+		c.Status(http.StatusCreated)
+	})
+
+	post := func(remote, forwarded string) int {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.RemoteAddr = remote
+		req.Header.Set("X-Forwarded-For", forwarded)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	assert.Equal(t, http.StatusCreated, post("10.0.0.2:1", "1.1.1.1"))
+	assert.Equal(t, http.StatusTooManyRequests, post("10.0.0.2:1", "2.2.2.2"),
+		"forwarded IPs of untrusted peers must be ignored")
+	assert.Equal(t, http.StatusCreated, post("10.0.0.1:1", "3.3.3.3"))
+	assert.Equal(t, http.StatusTooManyRequests, post("10.0.0.1:1", "3.3.3.3"))
+	assert.Equal(t, http.StatusCreated, post("10.0.0.1:1", "4.4.4.4"),
+		"the trusted proxy must pass the client IP on")
+}
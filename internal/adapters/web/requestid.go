@@ -0,0 +1,27 @@
+package web
+
+import (
+	"github.com/MomsEngineer/urlshortener/internal/adapters/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// RequestIDMiddleware keeps the X-Request-ID of the caller or generates
+// one, echoes it in the response and puts it with log into the request
+// context, so every log entry of the request carries the ID.
+func RequestIDMiddleware(log *logger.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIDHeader)
+		if !logger.ValidRequestID(id) {
+			id = uuid.NewString()
+		}
+		c.Header(requestIDHeader, id)
+
+		ctx := logger.WithRequestID(c.Request.Context(), id)
+		c.Request = c.Request.WithContext(logger.NewContext(ctx, log))
+
+		c.Next()
+	}
+}
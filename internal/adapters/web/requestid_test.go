@@ -0,0 +1,55 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/MomsEngineer/urlshortener/internal/adapters/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var seen string
+	router := gin.New()
+	router.Use(RequestIDMiddleware(logger.NewNop()))
+	router.GET("/", func(c *gin.Context) {
+		seen = logger.RequestID(c.Request.Context())
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name      string
+		header    string
+		generated bool
+	}{
+		{name: "Generated", generated: true},
+		{name: "Propagated", header: "abc-123"},
+		{name: "Too long", header: strings.Repeat("a", 129), generated: true},
+		{name: "Control characters", header: "abc\x01def", generated: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set(requestIDHeader, tt.header)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			id := w.Header().Get(requestIDHeader)
+			assert.Equal(t, id, seen)
+			if tt.generated {
+				assert.NoError(t, uuid.Validate(id))
+			} else {
+				assert.Equal(t, tt.header, id)
+			}
+		})
+	}
+}
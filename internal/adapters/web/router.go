@@ -1,41 +1,78 @@
 package web
 
 import (
+	"net"
+
+	"github.com/MomsEngineer/urlshortener/internal/adapters/health"
 	"github.com/MomsEngineer/urlshortener/internal/adapters/logger"
+	"github.com/MomsEngineer/urlshortener/internal/adapters/metrics"
+	"github.com/MomsEngineer/urlshortener/internal/adapters/ratelimit"
+	"github.com/MomsEngineer/urlshortener/internal/adapters/tracing"
 	"github.com/MomsEngineer/urlshortener/internal/adapters/web/compresser"
 	"github.com/MomsEngineer/urlshortener/internal/adapters/web/cookie"
+	"github.com/MomsEngineer/urlshortener/internal/entities/apikey"
+	"github.com/MomsEngineer/urlshortener/internal/entities/user"
 	"github.com/MomsEngineer/urlshortener/internal/usecases/storage"
 	"github.com/gin-gonic/gin"
 )
 
-func NewRouter() *gin.Engine {
+// NewRouter creates the engine, ClientIP takes the forwarded client IP
+// only from the trusted proxies and the peer address otherwise.
+func NewRouter(trustedProxies []*net.IPNet) (*gin.Engine, error) {
 	gin.SetMode(gin.ReleaseMode)
-	return gin.New()
+	router := gin.New()
+
+	proxies := make([]string, 0, len(trustedProxies))
+	for _, proxy := range trustedProxies {
+		proxies = append(proxies, proxy.String())
+	}
+	if err := router.SetTrustedProxies(proxies); err != nil {
+		return nil, err
+	}
+
+	return router, nil
 }
 
-func SetupRoutes(router *gin.Engine, s storage.StoregeInterface, baseURL string) {
-	router.Use(logger.Create(logger.InfoLevel).Logger())
+func SetupRoutes(router *gin.Engine, s storage.StoregeInterface, cookies *cookie.Manager,
+	baseURL string, trustedSubnet *net.IPNet, limiter *ratelimit.Limiter, log *logger.Logger,
+	checker *health.Checker) {
+	create := RateLimitMiddleware(limiter, ratelimit.ClassCreate)
+	createBatch := RateLimitCostMiddleware(limiter, ratelimit.ClassCreate, BatchCost)
+	redirect := RateLimitMiddleware(limiter, ratelimit.ClassRedirect)
+
+	router.Use(RequestIDMiddleware(log))
+	router.Use(tracing.Middleware())
+	router.Use(metrics.Middleware())
+	router.Use(log.Middleware("/healthz", "/readyz"))
 	router.Use(compresser.CompresserMiddleware())
-	router.Use()
+	router.Use(ErrorMiddleware())
+
+	// Probes get no cookie and no rate limit.
+	router.GET("/healthz", HandleHealthz)
+	router.GET("/readyz", func(c *gin.Context) {
+		HandleReadyz(c, checker)
+	})
 
 	public := router.Group("/")
 	{
 		// Используем middleware только для стандартных маршрутов
-		public.Use(cookie.PublicCookieMiddleware())
+		public.Use(APIKeyMiddleware(s, cookies.PublicCookieMiddleware()))
+		public.Use(AnonymousQuotaMiddleware())
 
-		public.POST("/", func(c *gin.Context) {
+		public.POST("/", RequireScope(apikey.ScopeShorten), create, func(c *gin.Context) {
 			HandlePost(c, s, baseURL)
 		})
 
-		public.POST("/api/shorten", func(c *gin.Context) {
+		public.POST("/api/shorten", RequireScope(apikey.ScopeShorten), create, func(c *gin.Context) {
 			HandlePostAPI(c, s, baseURL)
 		})
 
-		public.POST("/api/shorten/batch", func(c *gin.Context) {
+		public.POST("/api/shorten/batch", RequireScope(apikey.ScopeShorten), createBatch, func(c *gin.Context) {
 			HandlePostBatch(c, s, baseURL)
 		})
 
-		public.GET("/:id", func(c *gin.Context) {
+		// Short links are public, whatever key the client sends.
+		public.GET("/:id", redirect, func(c *gin.Context) {
 			HandleGet(c, s)
 		})
 
@@ -44,7 +81,112 @@ func SetupRoutes(router *gin.Engine, s storage.StoregeInterface, baseURL string)
 		})
 	}
 
-	router.GET("/api/user/urls", cookie.AuthCookieMiddleware(), func(c *gin.Context) {
-		HandleGetUserURL(c, s, baseURL)
-	})
+	urls := router.Group("/api/user/urls")
+	{
+		urls.Use(APIKeyMiddleware(s, cookies.AuthCookieMiddleware()))
+
+		urls.GET("", RequireScope(apikey.ScopeRead), func(c *gin.Context) {
+			HandleGetUserURL(c, s, baseURL)
+		})
+
+		urls.DELETE("", RequireScope(apikey.ScopeDelete), func(c *gin.Context) {
+			HandleDeleteUserURLs(c, s)
+		})
+
+		urls.GET("/:id/stats", RequireScope(apikey.ScopeRead), func(c *gin.Context) {
+			HandleGetLinkStats(c, s)
+		})
+	}
+
+	usage := router.Group("/api/user/usage")
+	{
+		usage.Use(APIKeyMiddleware(s, cookies.AuthCookieMiddleware()))
+
+		usage.GET("", RequireScope(apikey.ScopeRead), func(c *gin.Context) {
+			HandleGetUsage(c, s)
+		})
+	}
+
+	// Accounts use the public cookie, so links of an anonymous user can
+	// be moved to the account on registration.
+	account := router.Group("/api/user")
+	{
+		account.POST("/register", cookies.PublicCookieMiddleware(), func(c *gin.Context) {
+			HandleRegister(c, s, cookies)
+		})
+
+		account.POST("/login", func(c *gin.Context) {
+			HandleLogin(c, s, cookies)
+		})
+
+		account.POST("/logout", func(c *gin.Context) {
+			HandleLogout(c, cookies)
+		})
+	}
+
+	// Moderators review links, only admins change owners, bans and
+	// roles. The role comes from the cookie, API keys have none.
+	admin := router.Group("/api/admin")
+	{
+		admin.Use(cookies.AuthCookieMiddleware(), RequireRole(user.RoleModerator))
+
+		admin.GET("/links", func(c *gin.Context) {
+			HandleListLinks(c, s, baseURL)
+		})
+
+		admin.POST("/links/:id/disable", func(c *gin.Context) {
+			HandleDisableLink(c, s, true)
+		})
+
+		admin.POST("/links/:id/enable", func(c *gin.Context) {
+			HandleDisableLink(c, s, false)
+		})
+
+		admin.PUT("/links/:id/owner", RequireRole(user.RoleAdmin), func(c *gin.Context) {
+			HandleReassignLink(c, s)
+		})
+
+		admin.PUT("/bans/:id", RequireRole(user.RoleAdmin), func(c *gin.Context) {
+			HandleBanUser(c, s)
+		})
+
+		admin.DELETE("/bans/:id", RequireRole(user.RoleAdmin), func(c *gin.Context) {
+			HandleUnbanUser(c, s)
+		})
+
+		admin.PUT("/users/:id/role", RequireRole(user.RoleAdmin), func(c *gin.Context) {
+			HandleSetUserRole(c, s)
+		})
+
+		admin.GET("/log-level", gin.WrapH(log.LevelHandler()))
+		admin.PUT("/log-level", RequireRole(user.RoleAdmin), gin.WrapH(log.LevelHandler()))
+	}
+
+	// Internal routes are for the infrastructure, not for users.
+	internal := router.Group("/api/internal")
+	{
+		internal.Use(TrustedSubnetMiddleware(trustedSubnet))
+
+		internal.GET("/stats", func(c *gin.Context) {
+			HandleStats(c, s)
+		})
+	}
+
+	// API keys can't manage API keys, only the cookie owner can.
+	keys := router.Group("/api/user/keys")
+	{
+		keys.Use(cookies.AuthCookieMiddleware())
+
+		keys.POST("", func(c *gin.Context) {
+			HandleCreateAPIKey(c, s)
+		})
+
+		keys.GET("", func(c *gin.Context) {
+			HandleListAPIKeys(c, s)
+		})
+
+		keys.DELETE("/:id", func(c *gin.Context) {
+			HandleRevokeAPIKey(c, s)
+		})
+	}
 }
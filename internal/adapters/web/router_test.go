@@ -0,0 +1,55 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/MomsEngineer/urlshortener/internal/adapters/config"
+	"github.com/MomsEngineer/urlshortener/internal/adapters/health"
+	"github.com/MomsEngineer/urlshortener/internal/adapters/logger"
+	"github.com/MomsEngineer/urlshortener/internal/adapters/ratelimit"
+	"github.com/MomsEngineer/urlshortener/internal/adapters/web/cookie"
+	"github.com/MomsEngineer/urlshortener/internal/adapters/web/mocks"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRouter(t *testing.T, cfg *config.Config) *gin.Engine {
+	t.Helper()
+
+	cfg.JWTKeys = "k:secret"
+	cfg.TokenTTL = time.Hour
+	cookies, err := cookie.New(cfg, nil, logger.NewNop())
+	require.NoError(t, err)
+
+	limiter, err := ratelimit.Create(cfg, logger.NewNop())
+	require.NoError(t, err)
+	t.Cleanup(func() { limiter.Close() })
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	mockStorage := new(mocks.Storage)
+	SetupRoutes(router, mockStorage, cookies, "http://localhost:8080/", nil, limiter, logger.NewNop(),
+		health.NewChecker(mockStorage.HealthChecks()...))
+
+	return router
+}
+
+func TestRedirectIgnoresKeyScopes(t *testing.T) {
+	router := newTestRouter(t, &config.Config{})
+
+	for _, key := range []string{"", "read-key", "shorten-key"} {
+		req := httptest.NewRequest(http.MethodGet, "/abc123", nil)
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusTemporaryRedirect, rr.Code, key)
+		assert.Equal(t, "https://example.com", rr.Header().Get("Location"), key)
+	}
+}
@@ -0,0 +1,127 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/MomsEngineer/urlshortener/internal/adapters/config"
+	"github.com/MomsEngineer/urlshortener/internal/adapters/logger"
+)
+
+// NewServer serves HTTPS with HTTP/2 if it is enabled, plain HTTP
+// otherwise.
+func NewServer(cfg *config.Config, handler http.Handler) (*http.Server, error) {
+	tlsConfig, err := TLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Server{
+		Addr:         cfg.Address,
+		Handler:      handler,
+		TLSConfig:    tlsConfig,
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+		IdleTimeout:  cfg.IdleTimeout,
+	}, nil
+}
+
+// Server is run by Serve. Serve returns once Shutdown or Close is
+// called, Shutdown waits for the in-flight requests.
+type Server interface {
+	Addr() string
+	Serve(net.Listener) error
+	Shutdown(context.Context) error
+	Close() error
+}
+
+type httpServer struct {
+	*http.Server
+}
+
+// HTTP adapts srv to Serve, it serves HTTPS if srv has a TLS config.
+func HTTP(srv *http.Server) Server {
+	return httpServer{srv}
+}
+
+func (s httpServer) Addr() string {
+	return s.Server.Addr
+}
+
+func (s httpServer) Serve(ln net.Listener) error {
+	if s.TLSConfig != nil {
+		return s.ServeTLS(ln, "", "")
+	}
+
+	return s.Server.Serve(ln)
+}
+
+// Serve runs the servers until ctx is done or one of them fails, then
+// stops accepting connections and waits up to timeout for in-flight
+// requests. Requests still running after the timeout are cut off. It
+// logs with the logger of ctx.
+func Serve(ctx context.Context, timeout time.Duration, servers ...Server) error {
+	var listeners []net.Listener
+	for _, srv := range servers {
+		ln, err := net.Listen("tcp", srv.Addr())
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return err
+		}
+		listeners = append(listeners, ln)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make([]error, len(servers))
+	var wg sync.WaitGroup
+	for i, srv := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = serve(ctx, srv, listeners[i], timeout)
+			cancel()
+		}()
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+func serve(ctx context.Context, srv Server, ln net.Listener, timeout time.Duration) error {
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.Serve(ln)
+	}()
+	log := logger.FromContext(ctx)
+	log.Info(ctx, "Listening", logger.String("address", ln.Addr().String()))
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Info(ctx, "Shutting down, draining connections", logger.String("address", ln.Addr().String()))
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		srv.Close()
+		return fmt.Errorf("failed to drain connections: %w", err)
+	}
+
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
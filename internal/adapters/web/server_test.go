@@ -0,0 +1,79 @@
+package web
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/MomsEngineer/urlshortener/internal/adapters/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func startServer(t *testing.T, handler http.HandlerFunc, timeout time.Duration) (string, context.CancelFunc, chan error) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	srv, err := NewServer(&config.Config{ReadTimeout: time.Second, WriteTimeout: time.Second}, handler)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- serve(ctx, HTTP(srv), ln, timeout)
+	}()
+
+	return "http://" + ln.Addr().String(), cancel, done
+}
+
+func TestServeDrainsRequests(t *testing.T) {
+	started := make(chan struct{})
+	url, stop, done := startServer(t, func(w http.ResponseWriter, _ *http.Request) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("done"))
+	}, time.Second)
+
+	res := make(chan string, 1)
+	go func() {
+		resp, err := http.Get(url)
+		if err != nil {
+			res <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		res <- string(body)
+	}()
+
+	<-started
+	stop()
+
+	assert.Equal(t, "done", <-res, "an in-flight request must complete")
+	require.NoError(t, <-done)
+
+	_, err := http.Get(url)
+	assert.Error(t, err, "a stopped server must not accept connections")
+}
+
+func TestServeShutdownTimeout(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+
+	url, stop, done := startServer(t, func(_ http.ResponseWriter, _ *http.Request) {
+		close(started)
+		<-release
+	}, 50*time.Millisecond)
+
+	go http.Get(url)
+
+	<-started
+	stop()
+
+	assert.ErrorIs(t, <-done, context.DeadlineExceeded)
+}
@@ -0,0 +1,120 @@
+package web
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/MomsEngineer/urlshortener/internal/adapters/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTLSConfig(t *testing.T) {
+	tlsConfig, err := TLSConfig(&config.Config{})
+	require.NoError(t, err)
+	assert.Nil(t, tlsConfig, "HTTPS is off by default")
+
+	_, err = TLSConfig(&config.Config{EnableHTTPS: true, TLSCertFile: "cert.pem"})
+	assert.Error(t, err, "a certificate without a key must be rejected")
+
+	_, err = TLSConfig(&config.Config{EnableHTTPS: true, TLSCertFile: "missing.pem", TLSKeyFile: "missing.pem"})
+	assert.Error(t, err)
+
+	cert, err := selfSigned("shortener.test", time.Now())
+	require.NoError(t, err)
+	key, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certFile,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile,
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key}), 0o600))
+
+	tlsConfig, err = TLSConfig(&config.Config{EnableHTTPS: true, TLSCertFile: certFile, TLSKeyFile: keyFile})
+	require.NoError(t, err)
+	require.Len(t, tlsConfig.Certificates, 1)
+	assert.Equal(t, cert.Certificate, tlsConfig.Certificates[0].Certificate)
+}
+
+func TestSelfSigned(t *testing.T) {
+	now := time.Now()
+	cert, err := selfSigned("shortener.test", now)
+	require.NoError(t, err)
+
+	parsed, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	assert.Equal(t, []string{"localhost", "shortener.test"}, parsed.DNSNames)
+	require.NoError(t, parsed.VerifyHostname("127.0.0.1"))
+	assert.True(t, parsed.NotAfter.After(now))
+
+	cert, err = selfSigned("10.0.0.1", now)
+	require.NoError(t, err)
+	parsed, err = x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	assert.NoError(t, parsed.VerifyHostname("10.0.0.1"))
+}
+
+func TestServeHTTPS(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	cfg := &config.Config{Address: ln.Addr().String(), EnableHTTPS: true, ReadTimeout: time.Second}
+	srv, err := NewServer(cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- serve(ctx, HTTP(srv), ln, time.Second)
+	}()
+	defer func() {
+		cancel()
+		require.NoError(t, <-done)
+	}()
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+		ForceAttemptHTTP2: true,
+	}}
+	resp, err := client.Get("https://" + cfg.Address)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, 2, resp.ProtoMajor, "HTTPS must be served with HTTP/2")
+}
+
+func TestRedirectHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		port     string
+		target   string
+		expected string
+	}{
+		{"Default port", "443", "http://example.com/abc?x=1", "https://example.com/abc?x=1"},
+		{"Custom port", "8443", "http://example.com:8080/abc", "https://example.com:8443/abc"},
+		{"IPv6 host", "8443", "http://[::1]:8080/", "https://[::1]:8443/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			redirectHandler(tt.port).ServeHTTP(rr, httptest.NewRequest(http.MethodPost, tt.target, nil))
+
+			assert.Equal(t, http.StatusPermanentRedirect, rr.Code)
+			assert.Equal(t, tt.expected, rr.Header().Get("Location"))
+		})
+	}
+}
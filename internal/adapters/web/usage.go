@@ -0,0 +1,58 @@
+package web
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/MomsEngineer/urlshortener/internal/usecases/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// QuotaResponse shows the consumption of a quota, a zero limit means
+// there is no limit.
+type QuotaResponse struct {
+	Used  int `json:"used"`
+	Limit int `json:"limit"`
+}
+
+type UsageResponse struct {
+	Links        QuotaResponse `json:"links"`
+	LinksToday   QuotaResponse `json:"links_today"`
+	MaxBatchSize int           `json:"max_batch_size"`
+	ResetsAt     time.Time     `json:"resets_at"`
+}
+
+// AnonymousQuotaMiddleware counts the links of users who are neither
+// logged in nor using an API key against the daily quota of their IP.
+func AnonymousQuotaMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, loggedIn := c.Get("accountID")
+		_, withKey := c.Get(apiKeyContextKey)
+		if !loggedIn && !withKey {
+			c.Request = c.Request.WithContext(storage.WithAnonymousIP(c.Request.Context(), c.ClientIP()))
+		}
+
+		c.Next()
+	}
+}
+
+func HandleGetUsage(c *gin.Context, s storage.StoregeInterface) {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	usage, err := s.GetUsage(c.Request.Context(), userID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, UsageResponse{
+		Links:        QuotaResponse{Used: usage.Links, Limit: usage.MaxLinks},
+		LinksToday:   QuotaResponse{Used: usage.LinksToday, Limit: usage.MaxLinksPerDay},
+		MaxBatchSize: usage.MaxBatchSize,
+		ResetsAt:     usage.ResetsAt,
+	})
+}
@@ -0,0 +1,34 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/MomsEngineer/urlshortener/internal/adapters/web/mocks"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleGetUsage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockStorage := new(mocks.Storage)
+	router := gin.New()
+	router.Use(ErrorMiddleware())
+	router.GET("/api/user/usage", func(c *gin.Context) {
+		c.Set("userID", "user")
+		HandleGetUsage(c, mockStorage)
+	})
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/user/usage", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{
+		"links": {"used": 5, "limit": 100},
+		"links_today": {"used": 2, "limit": 10},
+		"max_batch_size": 3,
+		"resets_at": "2024-10-02T00:00:00Z"
+	}`, rr.Body.String())
+}
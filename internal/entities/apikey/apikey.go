@@ -0,0 +1,123 @@
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	keyPrefix    = "usk_"
+	secretLength = 32
+	shownLength  = len(keyPrefix) + 6
+	alphabet     = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+)
+
+var ErrInvalidScope = errors.New("invalid scope")
+
+// Scope limits what a key may be used for.
+type Scope string
+
+const (
+	ScopeRead    Scope = "read"
+	ScopeShorten Scope = "shorten"
+	ScopeDelete  Scope = "delete"
+)
+
+// AllScopes are granted to keys created without explicit scopes.
+var AllScopes = []Scope{ScopeRead, ScopeShorten, ScopeDelete}
+
+// APIKey identifies its owner like the user cookie does. Only the
+// SHA-256 hash of the key is stored, Prefix is kept to tell keys apart.
+type APIKey struct {
+	ID        string
+	UserID    string
+	Name      string
+	Prefix    string
+	Hash      string
+	Scopes    []Scope
+	CreatedAt time.Time
+	RevokedAt time.Time
+}
+
+// New generates a key and returns it in plain text together with its
+// record, the plain key can't be recovered later.
+func New(userID, name string, scopes []Scope) (string, *APIKey, error) {
+	if len(scopes) == 0 {
+		scopes = AllScopes
+	}
+
+	for _, s := range scopes {
+		if err := s.Validate(); err != nil {
+			return "", nil, err
+		}
+	}
+
+	secret, err := randomString(secretLength)
+	if err != nil {
+		return "", nil, err
+	}
+	plain := keyPrefix + secret
+
+	return plain, &APIKey{
+		ID:        uuid.NewString(),
+		UserID:    userID,
+		Name:      name,
+		Prefix:    plain[:shownLength],
+		Hash:      Hash(plain),
+		Scopes:    scopes,
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+// Hash returns the hex SHA-256 of the key, the keys are random enough
+// that a slow password hash isn't needed.
+func Hash(plain string) string {
+	sum := sha256.Sum256([]byte(plain))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s Scope) Validate() error {
+	for _, known := range AllScopes {
+		if s == known {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w %q", ErrInvalidScope, string(s))
+}
+
+func (k *APIKey) IsRevoked() bool {
+	return !k.RevokedAt.IsZero()
+}
+
+func (k *APIKey) Allows(scope Scope) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+func randomString(n int) (string, error) {
+	max := big.NewInt(int64(len(alphabet)))
+
+	res := make([]byte, n)
+	for i := range res {
+		j, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		res[i] = alphabet[j.Int64()]
+	}
+
+	return string(res), nil
+}
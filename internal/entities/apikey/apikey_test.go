@@ -0,0 +1,43 @@
+package apikey
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	plain, k, err := New("owner", "ci", []Scope{ScopeRead})
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(plain, "usk_"))
+	assert.Len(t, plain, len("usk_")+32)
+	assert.Equal(t, Hash(plain), k.Hash)
+	assert.NotContains(t, k.Hash, plain)
+	assert.True(t, strings.HasPrefix(plain, k.Prefix))
+	assert.Equal(t, "owner", k.UserID)
+	assert.Equal(t, "ci", k.Name)
+	assert.NotEmpty(t, k.ID)
+	assert.False(t, k.CreatedAt.IsZero())
+
+	other, _, err := New("owner", "ci", nil)
+	require.NoError(t, err)
+	assert.NotEqual(t, plain, other)
+}
+
+func TestScopes(t *testing.T) {
+	_, k, err := New("owner", "", nil)
+	require.NoError(t, err)
+	assert.Equal(t, AllScopes, k.Scopes, "a key without scopes gets all of them")
+
+	_, k, err = New("owner", "", []Scope{ScopeShorten})
+	require.NoError(t, err)
+	assert.True(t, k.Allows(ScopeShorten))
+	assert.False(t, k.Allows(ScopeRead))
+	assert.False(t, k.Allows(ScopeDelete))
+
+	_, _, err = New("owner", "", []Scope{"admin"})
+	assert.ErrorIs(t, err, ErrInvalidScope)
+}
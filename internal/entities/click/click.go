@@ -0,0 +1,87 @@
+package click
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"time"
+)
+
+const dateLayout = "2006-01-02"
+
+type Click struct {
+	ShortURL  string
+	Timestamp time.Time
+	Referrer  string
+	UserAgent string
+	IPHash    string
+}
+
+type DailyClicks struct {
+	Date   string
+	Clicks int
+}
+
+type Stats struct {
+	Total  int
+	Unique int
+	Daily  []DailyClicks
+}
+
+// NewClick records a redirect, the visitor is identified by the hash
+// of the address only, see IPHasher.
+func NewClick(short, referrer, userAgent, ipHash string) *Click {
+	return &Click{
+		ShortURL:  short,
+		Timestamp: time.Now().UTC(),
+		Referrer:  referrer,
+		UserAgent: userAgent,
+		IPHash:    ipHash,
+	}
+}
+
+// IPHasher keeps visitors distinguishable without storing their
+// addresses. The hash is keyed, a plain hash of an IPv4 address is
+// reversed by hashing the whole address space.
+type IPHasher struct {
+	key []byte
+}
+
+func NewIPHasher(key []byte) IPHasher {
+	return IPHasher{key: key}
+}
+
+func (h IPHasher) Hash(ip string) string {
+	if ip == "" {
+		return ""
+	}
+
+	mac := hmac.New(sha256.New, h.key)
+	mac.Write([]byte(ip))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewStats aggregates clicks into totals and a daily time series
+// ordered by date.
+func NewStats(clicks []*Click) *Stats {
+	stats := &Stats{Total: len(clicks), Daily: []DailyClicks{}}
+
+	visitors := make(map[string]struct{})
+	days := make(map[string]int)
+	for _, c := range clicks {
+		visitors[c.IPHash] = struct{}{}
+		days[c.Timestamp.UTC().Format(dateLayout)]++
+	}
+	stats.Unique = len(visitors)
+
+	for date, n := range days {
+		stats.Daily = append(stats.Daily, DailyClicks{Date: date, Clicks: n})
+	}
+
+	sort.Slice(stats.Daily, func(i, j int) bool {
+		return stats.Daily[i].Date < stats.Daily[j].Date
+	})
+
+	return stats
+}
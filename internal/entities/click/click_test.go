@@ -0,0 +1,61 @@
+package click
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewStats(t *testing.T) {
+	day := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+	h := NewIPHasher([]byte("key"))
+
+	tests := []struct {
+		name   string
+		clicks []*Click
+		want   *Stats
+	}{
+		{
+			name:   "No clicks",
+			clicks: nil,
+			want:   &Stats{Daily: []DailyClicks{}},
+		},
+		{
+			name: "Clicks over several days",
+			clicks: []*Click{
+				{ShortURL: "abc", Timestamp: day.Add(24 * time.Hour), IPHash: h.Hash("10.0.0.1")},
+				{ShortURL: "abc", Timestamp: day, IPHash: h.Hash("10.0.0.1")},
+				{ShortURL: "abc", Timestamp: day.Add(time.Hour), IPHash: h.Hash("10.0.0.2")},
+			},
+			want: &Stats{
+				Total:  3,
+				Unique: 2,
+				Daily: []DailyClicks{
+					{Date: "2024-10-01", Clicks: 2},
+					{Date: "2024-10-02", Clicks: 1},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, NewStats(tt.clicks))
+		})
+	}
+}
+
+func TestIPHasher(t *testing.T) {
+	h := NewIPHasher([]byte("key"))
+	assert.Equal(t, "", h.Hash(""))
+	assert.Equal(t, h.Hash("10.0.0.1"), h.Hash("10.0.0.1"))
+	assert.NotEqual(t, h.Hash("10.0.0.1"), h.Hash("10.0.0.2"))
+	assert.NotContains(t, h.Hash("10.0.0.1"), "10.0.0.1")
+
+	sum := sha256.Sum256([]byte("10.0.0.1"))
+	assert.NotEqual(t, hex.EncodeToString(sum[:]), h.Hash("10.0.0.1"), "the hash must be keyed")
+	assert.NotEqual(t, NewIPHasher([]byte("other")).Hash("10.0.0.1"), h.Hash("10.0.0.1"))
+}
@@ -0,0 +1,46 @@
+package link
+
+import "strings"
+
+// Filter selects live links for the admin API. Query matches a part of
+// the short or original URL regardless of case, UserID matches the
+// owner exactly, empty fields match every link.
+type Filter struct {
+	Query  string
+	UserID string
+	Limit  int
+	Offset int
+}
+
+func (f Filter) Matches(l *Link) bool {
+	if l.IsDeleted {
+		return false
+	}
+
+	if f.UserID != "" && l.UserID != f.UserID {
+		return false
+	}
+
+	if f.Query == "" {
+		return true
+	}
+
+	query := strings.ToLower(f.Query)
+	return strings.Contains(strings.ToLower(l.ShortURL), query) ||
+		strings.Contains(strings.ToLower(l.OriginalURL), query)
+}
+
+// Page returns the part of the links, sorted by the caller, that the
+// limit and offset select. A zero limit means no limit.
+func (f Filter) Page(links []*Link) []*Link {
+	if f.Offset >= len(links) {
+		return nil
+	}
+	links = links[f.Offset:]
+
+	if f.Limit > 0 && f.Limit < len(links) {
+		links = links[:f.Limit]
+	}
+
+	return links
+}
@@ -0,0 +1,27 @@
+package link
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterMatches(t *testing.T) {
+	l := &Link{UserID: "alice", ShortURL: "Abc", OriginalURL: "https://example.com/Cats"}
+
+	assert.True(t, Filter{}.Matches(l))
+	assert.True(t, Filter{Query: "cats"}.Matches(l))
+	assert.True(t, Filter{Query: "ABC", UserID: "alice"}.Matches(l))
+	assert.False(t, Filter{Query: "dogs"}.Matches(l))
+	assert.False(t, Filter{UserID: "bob"}.Matches(l))
+	assert.False(t, Filter{}.Matches(&Link{IsDeleted: true}), "deleted links must not match")
+}
+
+func TestFilterPage(t *testing.T) {
+	links := []*Link{{ShortURL: "a"}, {ShortURL: "b"}, {ShortURL: "c"}}
+
+	assert.Len(t, Filter{}.Page(links), 3)
+	assert.Equal(t, []*Link{links[1]}, Filter{Limit: 1, Offset: 1}.Page(links))
+	assert.Equal(t, links[2:], Filter{Limit: 5, Offset: 2}.Page(links))
+	assert.Empty(t, Filter{Offset: 3}.Page(links))
+}
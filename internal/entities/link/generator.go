@@ -0,0 +1,150 @@
+package link
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	base62Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	consonants     = "bdfgklmnprstvz"
+	vowels         = "aeiou"
+)
+
+var errInvalidLength = errors.New("n must be greater 0")
+
+// Generator produces short codes. The attempt counts the retries after
+// the previous codes for the same link were already taken.
+type Generator interface {
+	Generate(original string, length, attempt int) (string, error)
+}
+
+func NewGenerator(name string) (Generator, error) {
+	switch name {
+	case "", "random":
+		return RandomGenerator{}, nil
+	case "counter":
+		return NewCounterGenerator(uint64(time.Now().UnixMilli())), nil
+	case "hash":
+		return HashGenerator{}, nil
+	case "word":
+		return WordGenerator{}, nil
+	}
+
+	return nil, fmt.Errorf("unknown short code generator %q", name)
+}
+
+// RandomGenerator produces random base62 codes.
+type RandomGenerator struct{}
+
+func (RandomGenerator) Generate(_ string, length, _ int) (string, error) {
+	if length <= 0 {
+		return "", errInvalidLength
+	}
+
+	return randomString(base62Alphabet, length)
+}
+
+// CounterGenerator encodes a monotonic counter in base62, the codes
+// are short but easy to enumerate.
+type CounterGenerator struct {
+	counter atomic.Uint64
+}
+
+// NewCounterGenerator starts counting from start, seeding it with the
+// current time keeps the codes growing across restarts.
+func NewCounterGenerator(start uint64) *CounterGenerator {
+	g := &CounterGenerator{}
+	g.counter.Store(start)
+	return g
+}
+
+func (g *CounterGenerator) Generate(_ string, length, _ int) (string, error) {
+	if length <= 0 {
+		return "", errInvalidLength
+	}
+
+	code := new(big.Int).SetUint64(g.counter.Add(1)).Text(62)
+	if len(code) < length {
+		code = strings.Repeat("0", length-len(code)) + code
+	}
+
+	return code, nil
+}
+
+// HashGenerator derives the code from the original URL, so the same
+// URL always gets the same code unless it collides.
+type HashGenerator struct{}
+
+func (HashGenerator) Generate(original string, length, attempt int) (string, error) {
+	if length <= 0 {
+		return "", errInvalidLength
+	}
+
+	if attempt > 0 {
+		original += "#" + strconv.Itoa(attempt)
+	}
+
+	sum := sha256.Sum256([]byte(original))
+	code := new(big.Int).SetBytes(sum[:]).Text(62)
+	if len(code) < length {
+		return "", fmt.Errorf("hash code is shorter than %d characters", length)
+	}
+
+	return code[:length], nil
+}
+
+// WordGenerator produces pronounceable codes of alternating
+// consonants and vowels, e.g. "bakodimu".
+type WordGenerator struct{}
+
+func (WordGenerator) Generate(_ string, length, _ int) (string, error) {
+	if length <= 0 {
+		return "", errInvalidLength
+	}
+
+	var sb strings.Builder
+	for i := 0; i < length; i++ {
+		alphabet := consonants
+		if i%2 == 1 {
+			alphabet = vowels
+		}
+
+		c, err := randomString(alphabet, 1)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(c)
+	}
+
+	return sb.String(), nil
+}
+
+// randomString picks n characters of the alphabet uniformly, bytes
+// beyond the largest multiple of the alphabet size are skipped.
+func randomString(alphabet string, n int) (string, error) {
+	limit := 256 - 256%len(alphabet)
+
+	res := make([]byte, 0, n)
+	buf := make([]byte, n)
+	for len(res) < n {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+
+		for _, b := range buf {
+			if int(b) < limit && len(res) < n {
+				res = append(res, alphabet[int(b)%len(alphabet)])
+			}
+		}
+	}
+
+	return string(res), nil
+}
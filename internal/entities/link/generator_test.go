@@ -0,0 +1,89 @@
+package link
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerators(t *testing.T) {
+	tests := []struct {
+		name    string
+		gen     Generator
+		pattern *regexp.Regexp
+	}{
+		{
+			name:    "Random generator",
+			gen:     RandomGenerator{},
+			pattern: regexp.MustCompile(`^[0-9A-Za-z]{8}$`),
+		},
+		{
+			name:    "Counter generator",
+			gen:     NewCounterGenerator(0),
+			pattern: regexp.MustCompile(`^0{7}1$`),
+		},
+		{
+			name:    "Hash generator",
+			gen:     HashGenerator{},
+			pattern: regexp.MustCompile(`^[0-9A-Za-z]{8}$`),
+		},
+		{
+			name:    "Word generator",
+			gen:     WordGenerator{},
+			pattern: regexp.MustCompile(`^([bdfgklmnprstvz][aeiou]){4}$`),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := tt.gen.Generate("https://example.com", 8, 0)
+			require.NoError(t, err)
+			assert.Regexp(t, tt.pattern, code)
+
+			_, err = tt.gen.Generate("https://example.com", 0, 0)
+			require.Error(t, err, "expected an error for zero length")
+		})
+	}
+}
+
+func TestCounterGeneratorIsMonotonic(t *testing.T) {
+	gen := NewCounterGenerator(61)
+
+	first, err := gen.Generate("", 2, 0)
+	require.NoError(t, err)
+	second, err := gen.Generate("", 2, 0)
+	require.NoError(t, err)
+
+	assert.Equal(t, "10", first)
+	assert.Equal(t, "11", second)
+}
+
+func TestHashGeneratorIsDeterministic(t *testing.T) {
+	gen := HashGenerator{}
+
+	first, err := gen.Generate("https://example.com", 8, 0)
+	require.NoError(t, err)
+	second, err := gen.Generate("https://example.com", 8, 0)
+	require.NoError(t, err)
+	retry, err := gen.Generate("https://example.com", 8, 1)
+	require.NoError(t, err)
+	longer, err := gen.Generate("https://example.com", 10, 0)
+	require.NoError(t, err)
+
+	assert.Equal(t, first, second)
+	assert.NotEqual(t, first, retry, "retries must produce a different code")
+	assert.Equal(t, first, longer[:8])
+}
+
+func TestNewGenerator(t *testing.T) {
+	for _, name := range []string{"", "random", "counter", "hash", "word"} {
+		gen, err := NewGenerator(name)
+		require.NoError(t, err)
+		assert.NotNil(t, gen)
+	}
+
+	_, err := NewGenerator("unknown")
+	require.Error(t, err)
+}
@@ -1,42 +1,133 @@
 package link
 
 import (
-	"crypto/rand"
-	"encoding/base64"
 	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
 )
 
+const (
+	minAliasLength = 3
+	maxAliasLength = 64
+)
+
+var ErrInvalidAlias = errors.New("invalid alias")
+
+var aliasPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// reservedAliases are the first path segments of the service routes,
+// a link with such a short code would never be reachable.
+var reservedAliases = map[string]struct{}{
+	"api":     {},
+	"healthz": {},
+	"ping":    {},
+	"readyz":  {},
+}
+
 type Link struct {
 	UserID      string
 	ShortURL    string
 	OriginalURL string
+	IsDeleted   bool
+	IsDisabled  bool
+	ExpiresAt   time.Time
 }
 
-func NewLink(userID, short, link string) (*Link, error) {
-	var err error
-	if short == "" {
-		short, err = GenerateID(8)
-		if err != nil {
-			return nil, err
+type Option func(*Link) error
+
+// WithExpiry makes the link stop working at t, the zero time means
+// the link never expires.
+func WithExpiry(t time.Time) Option {
+	return func(l *Link) error {
+		l.ExpiresAt = t
+		return nil
+	}
+}
+
+// ParseExpiry turns the optional expires_at and ttl_seconds request
+// fields into an expiry time, the zero time means no expiry.
+func ParseExpiry(expiresAt *time.Time, ttlSeconds int64, now time.Time) (time.Time, error) {
+	switch {
+	case expiresAt != nil && ttlSeconds != 0:
+		return time.Time{}, errors.New("expires_at and ttl_seconds are mutually exclusive")
+	case ttlSeconds < 0:
+		return time.Time{}, errors.New("ttl_seconds must be positive")
+	case ttlSeconds > 0:
+		return now.Add(time.Duration(ttlSeconds) * time.Second), nil
+	case expiresAt != nil && !expiresAt.After(now):
+		return time.Time{}, errors.New("expires_at must be in the future")
+	case expiresAt != nil:
+		return *expiresAt, nil
+	}
+
+	return time.Time{}, nil
+}
+
+// WithAlias uses the user chosen alias as the short code, an empty
+// alias leaves the code to be generated.
+func WithAlias(alias string) Option {
+	return func(l *Link) error {
+		if alias == "" {
+			return nil
+		}
+
+		if err := ValidateAlias(alias); err != nil {
+			return err
 		}
+
+		l.ShortURL = alias
+		return nil
 	}
+}
 
-	return &Link{
+func NewLink(userID, short, link string, opts ...Option) (*Link, error) {
+	l := &Link{
 		UserID:      userID,
 		ShortURL:    short,
 		OriginalURL: link,
-	}, nil
+	}
+
+	for _, opt := range opts {
+		if err := opt(l); err != nil {
+			return nil, err
+		}
+	}
+
+	if l.ShortURL == "" {
+		short, err := GenerateID(8)
+		if err != nil {
+			return nil, err
+		}
+		l.ShortURL = short
+	}
+
+	return l, nil
 }
 
-func GenerateID(n int) (string, error) {
-	if n <= 0 {
-		return "", errors.New("n must be greater 0")
+func ValidateAlias(alias string) error {
+	if len(alias) < minAliasLength || len(alias) > maxAliasLength {
+		return fmt.Errorf("%w: length must be between %d and %d characters",
+			ErrInvalidAlias, minAliasLength, maxAliasLength)
 	}
 
-	b := make([]byte, n)
-	if _, err := rand.Read(b); err != nil {
-		return "", err
+	if !aliasPattern.MatchString(alias) {
+		return fmt.Errorf("%w: only latin letters, digits, '-' and '_' are allowed",
+			ErrInvalidAlias)
 	}
 
-	return base64.URLEncoding.EncodeToString(b)[:n], nil
+	if _, ok := reservedAliases[strings.ToLower(alias)]; ok {
+		return fmt.Errorf("%w: %q is reserved", ErrInvalidAlias, alias)
+	}
+
+	return nil
+}
+
+func (l *Link) IsExpired(now time.Time) bool {
+	return !l.ExpiresAt.IsZero() && !now.Before(l.ExpiresAt)
+}
+
+func GenerateID(n int) (string, error) {
+	return RandomGenerator{}.Generate("", n, 0)
 }
@@ -1,7 +1,9 @@
 package link
 
 import (
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -43,3 +45,150 @@ func TestGenerateID(t *testing.T) {
 		})
 	}
 }
+
+func TestIsExpired(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name      string
+		expiresAt time.Time
+		want      bool
+	}{
+		{
+			name:      "Link without expiry",
+			expiresAt: time.Time{},
+			want:      false,
+		},
+		{
+			name:      "Link expires in the future",
+			expiresAt: now.Add(time.Hour),
+			want:      false,
+		},
+		{
+			name:      "Link expired in the past",
+			expiresAt: now.Add(-time.Hour),
+			want:      true,
+		},
+		{
+			name:      "Link expires right now",
+			expiresAt: now,
+			want:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := NewLink("userID", "abc", "https://example.com", WithExpiry(tt.expiresAt))
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.want, l.IsExpired(now))
+		})
+	}
+}
+
+func TestValidateAlias(t *testing.T) {
+	tests := []struct {
+		name    string
+		alias   string
+		wantErr bool
+	}{
+		{
+			name:    "Valid alias",
+			alias:   "spring-sale_2024",
+			wantErr: false,
+		},
+		{
+			name:    "Too short alias",
+			alias:   "ab",
+			wantErr: true,
+		},
+		{
+			name:    "Too long alias",
+			alias:   strings.Repeat("a", 65),
+			wantErr: true,
+		},
+		{
+			name:    "Alias with forbidden characters",
+			alias:   "spring/sale",
+			wantErr: true,
+		},
+		{
+			name:    "Reserved alias",
+			alias:   "api",
+			wantErr: true,
+		},
+		{
+			name:    "Reserved alias in upper case",
+			alias:   "PING",
+			wantErr: true,
+		},
+		{
+			name:    "Reserved probe alias",
+			alias:   "healthz",
+			wantErr: true,
+		},
+		{
+			name:    "Reserved readiness probe alias",
+			alias:   "readyz",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateAlias(tt.alias)
+
+			if tt.wantErr {
+				require.ErrorIs(t, err, ErrInvalidAlias)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestNewLinkWithAlias(t *testing.T) {
+	l, err := NewLink("userID", "", "https://example.com", WithAlias("spring-sale"))
+	require.NoError(t, err)
+	assert.Equal(t, "spring-sale", l.ShortURL)
+
+	l, err = NewLink("userID", "", "https://example.com", WithAlias(""))
+	require.NoError(t, err)
+	assert.Len(t, l.ShortURL, 8)
+
+	_, err = NewLink("userID", "", "https://example.com", WithAlias("api"))
+	require.ErrorIs(t, err, ErrInvalidAlias)
+}
+
+func TestParseExpiry(t *testing.T) {
+	now := time.Now()
+	future := now.Add(time.Hour)
+	past := now.Add(-time.Hour)
+
+	tests := []struct {
+		name      string
+		expiresAt *time.Time
+		ttl       int64
+		expected  time.Time
+		wantErr   string
+	}{
+		{name: "No expiry"},
+		{name: "TTL", ttl: 60, expected: now.Add(time.Minute)},
+		{name: "Expiry time", expiresAt: &future, expected: future},
+		{name: "Both", expiresAt: &future, ttl: 60, wantErr: "mutually exclusive"},
+		{name: "Negative TTL", ttl: -1, wantErr: "ttl_seconds must be positive"},
+		{name: "Past expiry", expiresAt: &past, wantErr: "expires_at must be in the future"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expiresAt, err := ParseExpiry(tt.expiresAt, tt.ttl, now)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, expiresAt)
+		})
+	}
+}
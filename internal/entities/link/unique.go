@@ -0,0 +1,36 @@
+package link
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// UniqueScope tells which links may not share an original URL.
+type UniqueScope int
+
+const (
+	// UniqueGlobal allows one live link per original URL.
+	UniqueGlobal UniqueScope = iota
+	// UniquePerUser allows one live link per original URL and user.
+	UniquePerUser
+)
+
+func ParseUniqueScope(s string) (UniqueScope, error) {
+	switch s {
+	case "", "global":
+		return UniqueGlobal, nil
+	case "user":
+		return UniquePerUser, nil
+	}
+
+	return UniqueGlobal, fmt.Errorf("unknown uniqueness scope %q", s)
+}
+
+// Key returns the value that must be unique among live links.
+func (s UniqueScope) Key(userID, original string) string {
+	if s == UniquePerUser {
+		return strconv.Itoa(len(userID)) + ":" + userID + original
+	}
+
+	return original
+}
@@ -0,0 +1,22 @@
+package link
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUniqueScopeKey(t *testing.T) {
+	global, err := ParseUniqueScope("global")
+	require.NoError(t, err)
+	assert.Equal(t, global.Key("alice", "https://example.com"), global.Key("bob", "https://example.com"))
+
+	perUser, err := ParseUniqueScope("user")
+	require.NoError(t, err)
+	assert.NotEqual(t, perUser.Key("alice", "https://example.com"), perUser.Key("bob", "https://example.com"))
+	assert.NotEqual(t, perUser.Key("ab", "c"), perUser.Key("a", "bc"))
+
+	_, err = ParseUniqueScope("team")
+	require.Error(t, err)
+}
@@ -0,0 +1,40 @@
+package user
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrInvalidRole = errors.New("invalid role")
+
+// Role grants access to the admin API, every role includes the
+// permissions of the roles below it.
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+var roleRanks = map[Role]int{
+	RoleUser:      1,
+	RoleModerator: 2,
+	RoleAdmin:     3,
+}
+
+func ParseRole(s string) (Role, error) {
+	role := Role(s)
+	if _, ok := roleRanks[role]; !ok {
+		return "", fmt.Errorf("%w %q", ErrInvalidRole, s)
+	}
+
+	return role, nil
+}
+
+// Allows reports whether the role grants the permissions of required,
+// an unknown role grants nothing.
+func (r Role) Allows(required Role) bool {
+	rank, ok := roleRanks[r]
+	return ok && rank >= roleRanks[required]
+}
@@ -0,0 +1,29 @@
+package user
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRole(t *testing.T) {
+	role, err := ParseRole("moderator")
+	require.NoError(t, err)
+	assert.Equal(t, RoleModerator, role)
+
+	_, err = ParseRole("root")
+	require.ErrorIs(t, err, ErrInvalidRole)
+
+	_, err = ParseRole("")
+	require.ErrorIs(t, err, ErrInvalidRole)
+}
+
+func TestRoleAllows(t *testing.T) {
+	assert.True(t, RoleAdmin.Allows(RoleModerator))
+	assert.True(t, RoleModerator.Allows(RoleModerator))
+	assert.True(t, RoleUser.Allows(RoleUser))
+	assert.False(t, RoleModerator.Allows(RoleAdmin))
+	assert.False(t, RoleUser.Allows(RoleModerator))
+	assert.False(t, Role("root").Allows(RoleUser), "an unknown role must grant nothing")
+}
@@ -0,0 +1,72 @@
+package user
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	minPasswordLength = 8
+	// bcrypt ignores everything after the 72nd byte.
+	maxPasswordLength = 72
+)
+
+var (
+	ErrInvalidLogin    = errors.New("invalid login")
+	ErrInvalidPassword = errors.New("invalid password")
+)
+
+var loginPattern = regexp.MustCompile(`^[A-Za-z0-9._@+-]{3,64}$`)
+
+// User is a registered account, its ID replaces the anonymous user ID
+// of the cookie once the user logs in.
+type User struct {
+	ID           string
+	Login        string
+	PasswordHash string
+	Role         Role
+	CreatedAt    time.Time
+}
+
+// NewUser hashes the password with bcrypt, the login is normalized
+// with NormalizeLogin.
+func NewUser(login, password string) (*User, error) {
+	login = NormalizeLogin(login)
+	if !loginPattern.MatchString(login) {
+		return nil, fmt.Errorf("%w: use 3 to 64 letters, digits or ._@+- characters",
+			ErrInvalidLogin)
+	}
+
+	if len(password) < minPasswordLength || len(password) > maxPasswordLength {
+		return nil, fmt.Errorf("%w: use %d to %d characters", ErrInvalidPassword,
+			minPasswordLength, maxPasswordLength)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	return &User{
+		ID:           uuid.NewString(),
+		Login:        login,
+		PasswordHash: string(hash),
+		Role:         RoleUser,
+		CreatedAt:    time.Now(),
+	}, nil
+}
+
+// NormalizeLogin makes logins case-insensitive.
+func NormalizeLogin(login string) string {
+	return strings.ToLower(strings.TrimSpace(login))
+}
+
+func (u *User) CheckPassword(password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) == nil
+}
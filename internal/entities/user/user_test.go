@@ -0,0 +1,42 @@
+package user
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewUser(t *testing.T) {
+	tests := []struct {
+		name     string
+		login    string
+		password string
+		wantErr  error
+	}{
+		{name: "Valid", login: "Alice@example.com", password: "password"},
+		{name: "Short login", login: "al", password: "password", wantErr: ErrInvalidLogin},
+		{name: "Login with spaces", login: "al ice", password: "password", wantErr: ErrInvalidLogin},
+		{name: "Short password", login: "alice", password: "pass", wantErr: ErrInvalidPassword},
+		{name: "Long password", login: "alice", password: strings.Repeat("p", 73),
+			wantErr: ErrInvalidPassword},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := NewUser(tt.login, tt.password)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.NotEmpty(t, u.ID)
+			assert.Equal(t, "alice@example.com", u.Login)
+			assert.NotEqual(t, tt.password, u.PasswordHash, "the password must not be kept")
+			assert.True(t, u.CheckPassword(tt.password))
+			assert.False(t, u.CheckPassword("wrong password"))
+		})
+	}
+}
@@ -1,6 +1,43 @@
 package internalerrors
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var ErrDuplicate = errors.New("duplicate entry")
 var ErrNoContent = errors.New("no content")
+var ErrNotFound = errors.New("not found")
+var ErrGone = errors.New("gone")
+var ErrDeleted = fmt.Errorf("%w: link is deleted", ErrGone)
+var ErrExpired = fmt.Errorf("%w: link is expired", ErrGone)
+var ErrDisabled = fmt.Errorf("%w: link is disabled", ErrGone)
+var ErrInvalidURL = errors.New("invalid URL")
+var ErrUnauthorized = errors.New("unauthorized")
+var ErrForbidden = errors.New("forbidden")
+var ErrAliasTaken = errors.New("alias is already taken")
+var ErrQuotaExceeded = errors.New("quota exceeded")
+var ErrLinksQuota = fmt.Errorf("%w: too many links", ErrQuotaExceeded)
+var ErrDailyQuota = fmt.Errorf("%w: too many links today", ErrQuotaExceeded)
+var ErrBatchQuota = fmt.Errorf("%w: batch is too large", ErrQuotaExceeded)
+var ErrRateLimited = errors.New("rate limit exceeded")
+var ErrStorageUnavailable = errors.New("storage unavailable")
+
+// outcomes answer a valid request, such as a missing link, and are
+// not failures of the service.
+var outcomes = []error{ErrNotFound, ErrGone, ErrDuplicate, ErrAliasTaken, ErrQuotaExceeded}
+
+// IsFailure reports whether err is a failure rather than one of the
+// expected outcomes of a request.
+func IsFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	for _, outcome := range outcomes {
+		if errors.Is(err, outcome) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/MomsEngineer/urlshortener/internal/entities/link"
+	"github.com/MomsEngineer/urlshortener/internal/entities/user"
+	ierror "github.com/MomsEngineer/urlshortener/internal/errors"
+)
+
+const (
+	defaultListLimit = 100
+	maxListLimit     = 1000
+)
+
+// ListAllLinks returns the live links of all users, a page holds
+// 100 links unless the filter asks for up to 1000.
+func (s *Storage) ListAllLinks(ctx context.Context, f link.Filter) ([]*link.Link, error) {
+	if f.Limit <= 0 {
+		f.Limit = defaultListLimit
+	} else if f.Limit > maxListLimit {
+		f.Limit = maxListLimit
+	}
+	if f.Offset < 0 {
+		f.Offset = 0
+	}
+
+	links, err := s.store.ListLinks(ctx, f)
+	if err != nil {
+		s.log.Error(ctx, "Failed to list links", err)
+		return nil, err
+	}
+
+	return links, nil
+}
+
+// DisableLink stops or resumes redirects of the link, its owner still
+// sees it in the list of links.
+func (s *Storage) DisableLink(ctx context.Context, short string, disabled bool) error {
+	return s.store.DisableLink(ctx, short, disabled)
+}
+
+func (s *Storage) ReassignLink(ctx context.Context, short, userID string) error {
+	return s.store.SetLinkOwner(ctx, short, userID)
+}
+
+// SetUserRole takes effect with the next request of the user. The
+// configured admins keep the admin role, demoting them is forbidden.
+func (s *Storage) SetUserRole(ctx context.Context, userID string, role user.Role) error {
+	if _, err := user.ParseRole(string(role)); err != nil {
+		return err
+	}
+
+	u, err := s.store.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if s.isAdminLogin(u.Login) && role != user.RoleAdmin {
+		return fmt.Errorf("%w: %q is a configured admin", ierror.ErrForbidden, u.Login)
+	}
+
+	return s.store.SetUserRole(ctx, userID, role)
+}
+
+func (s *Storage) BanUser(ctx context.Context, userID, reason string) error {
+	return s.store.BanUser(ctx, userID, reason, time.Now())
+}
+
+func (s *Storage) UnbanUser(ctx context.Context, userID string) error {
+	return s.store.UnbanUser(ctx, userID)
+}
+
+func (s *Storage) IsBanned(ctx context.Context, userID string) (bool, error) {
+	return s.store.IsBanned(ctx, userID)
+}
+
+// checkBan reports a banned user as ErrForbidden.
+func (s *Storage) checkBan(ctx context.Context, userID string) error {
+	banned, err := s.store.IsBanned(ctx, userID)
+	if err != nil {
+		s.log.Error(ctx, "Failed to check user ban", err)
+		return err
+	}
+
+	if banned {
+		return fmt.Errorf("%w: user is banned", ierror.ErrForbidden)
+	}
+
+	return nil
+}
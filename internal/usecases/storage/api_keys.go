@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/MomsEngineer/urlshortener/internal/adapters/logger"
+	"github.com/MomsEngineer/urlshortener/internal/entities/apikey"
+	ierror "github.com/MomsEngineer/urlshortener/internal/errors"
+)
+
+// CreateAPIKey stores a new key of the user and returns it in plain
+// text, only its hash is kept.
+func (s *Storage) CreateAPIKey(ctx context.Context, userID, name string,
+	scopes []apikey.Scope) (string, *apikey.APIKey, error) {
+	plain, k, err := apikey.New(userID, name, scopes)
+	if err != nil {
+		s.log.Debug(ctx, "Failed to create API key", logger.Err(err))
+		return "", nil, err
+	}
+
+	if err := s.store.SaveAPIKey(ctx, k); err != nil {
+		s.log.Error(ctx, "Failed to save API key", err)
+		return "", nil, err
+	}
+
+	return plain, k, nil
+}
+
+func (s *Storage) ListAPIKeys(ctx context.Context, userID string) ([]*apikey.APIKey, error) {
+	return s.store.GetAPIKeysByUser(ctx, userID)
+}
+
+func (s *Storage) RevokeAPIKey(ctx context.Context, userID, id string) error {
+	return s.store.RevokeAPIKey(ctx, userID, id, time.Now())
+}
+
+// AuthenticateAPIKey returns the record of a valid key, unknown and
+// revoked keys are reported as ErrUnauthorized.
+func (s *Storage) AuthenticateAPIKey(ctx context.Context, key string) (*apikey.APIKey, error) {
+	k, err := s.store.GetAPIKey(ctx, apikey.Hash(key))
+	if errors.Is(err, ierror.ErrNotFound) {
+		return nil, fmt.Errorf("%w: unknown API key", ierror.ErrUnauthorized)
+	} else if err != nil {
+		s.log.Error(ctx, "Failed to get API key", err)
+		return nil, err
+	}
+
+	if k.IsRevoked() {
+		return nil, fmt.Errorf("%w: API key is revoked", ierror.ErrUnauthorized)
+	}
+
+	if err := s.checkBan(ctx, k.UserID); err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
@@ -0,0 +1,164 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/MomsEngineer/urlshortener/internal/adapters/logger"
+	"github.com/MomsEngineer/urlshortener/internal/adapters/metrics"
+	ierror "github.com/MomsEngineer/urlshortener/internal/errors"
+)
+
+const (
+	batchSize          = 100
+	batchFlushInterval = time.Second
+	// queueSize bounds the items waiting for the worker.
+	queueSize = 10 * batchSize
+)
+
+// fullPolicy tells what enqueue does when the queue is full.
+type fullPolicy int
+
+const (
+	// blockWhenFull makes the caller wait for room, so no item is lost.
+	blockWhenFull fullPolicy = iota
+	// dropWhenFull drops the items the queue has no room for, so the
+	// caller never waits.
+	dropWhenFull
+)
+
+// batcher collects items from all requests into one bounded queue and
+// passes them to the store in batches.
+type batcher[T any] struct {
+	name    string
+	flushFn func(context.Context, []T) error
+	full    fullPolicy
+	log     *logger.Logger
+	queue   chan T
+	done    chan struct{}
+	mu      sync.RWMutex
+	closing bool
+	worker  sync.WaitGroup
+	alive   heartbeat
+}
+
+func newBatcher[T any](name string, flushFn func(context.Context, []T) error, full fullPolicy,
+	log *logger.Logger) *batcher[T] {
+	b := &batcher[T]{
+		name:    name,
+		flushFn: flushFn,
+		full:    full,
+		log:     log,
+		queue:   make(chan T, queueSize),
+		done:    make(chan struct{}),
+	}
+	b.alive.beat(time.Now())
+
+	b.worker.Add(1)
+	go b.run()
+
+	return b
+}
+
+// enqueue refuses new items once close has started, so close does not
+// wait for or lose items added after it. A full queue is handled
+// according to the policy of the batcher, a blocked caller gives up
+// when ctx is done.
+func (b *batcher[T]) enqueue(ctx context.Context, items ...T) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.closing {
+		return fmt.Errorf("%w: %s batcher is closed", ierror.ErrStorageUnavailable, b.name)
+	}
+
+	for i, item := range items {
+		if b.full == dropWhenFull {
+			select {
+			case b.queue <- item:
+				continue
+			default:
+				b.log.Debug(ctx, "Queue is full, dropping items",
+					logger.String("batch", b.name), logger.Int("dropped", len(items)-i))
+				metrics.QueueDropped(b.name, len(items)-i)
+				return nil
+			}
+		}
+
+		select {
+		case b.queue <- item:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+func (b *batcher[T]) run() {
+	defer b.worker.Done()
+	defer b.alive.stop()
+
+	ticker := time.NewTicker(batchFlushInterval)
+	defer ticker.Stop()
+
+	var batch []T
+	for {
+		select {
+		case item := <-b.queue:
+			batch = append(batch, item)
+			if len(batch) >= batchSize {
+				batch = b.flush(batch)
+			}
+		case <-ticker.C:
+			batch = b.flush(batch)
+			b.alive.beat(time.Now())
+		case <-b.done:
+			for {
+				select {
+				case item := <-b.queue:
+					batch = append(batch, item)
+					if len(batch) >= batchSize {
+						batch = b.flush(batch)
+					}
+				default:
+					b.flush(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+func (b *batcher[T]) flush(batch []T) []T {
+	if len(batch) == 0 {
+		return batch
+	}
+
+	ctx := context.Background()
+	if err := b.flushFn(ctx, batch); err != nil {
+		b.log.Error(ctx, "Failed to flush batch", err,
+			logger.String("batch", b.name), logger.Int("size", len(batch)))
+	}
+
+	return nil
+}
+
+// check fails if the worker stopped or is stuck flushing.
+func (b *batcher[T]) check(now time.Time) error {
+	return b.alive.check(now, batchFlushInterval)
+}
+
+// close flushes the queued items and stops the worker. Callers blocked
+// on a full queue are let in first, the worker keeps draining the
+// queue until then.
+func (b *batcher[T]) close() {
+	b.mu.Lock()
+	b.closing = true
+	b.mu.Unlock()
+
+	close(b.done)
+	b.worker.Wait()
+}
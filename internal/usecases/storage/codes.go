@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/MomsEngineer/urlshortener/internal/adapters/logger"
+	"github.com/MomsEngineer/urlshortener/internal/entities/link"
+)
+
+const (
+	defaultCodeLength   = 8
+	maxCodeLength       = 32
+	maxGenerateAttempts = 5
+	growAfterCollisions = 2
+)
+
+// codeSource generates short codes and makes them longer once
+// collisions show that the keyspace is getting crowded. Hashed codes
+// never grow: the same original always hashes to the same codes, so
+// re-shortening it collides however empty the keyspace is.
+type codeSource struct {
+	gen    link.Generator
+	log    *logger.Logger
+	length atomic.Int64
+	grows  bool
+}
+
+func newCodeSource(gen link.Generator, length int, log *logger.Logger) *codeSource {
+	if length <= 0 {
+		length = defaultCodeLength
+	}
+
+	_, hashed := gen.(link.HashGenerator)
+	c := &codeSource{gen: gen, log: log, grows: !hashed}
+	c.length.Store(int64(length))
+
+	return c
+}
+
+func (c *codeSource) next(original string, attempt int) (string, error) {
+	return c.gen.Generate(original, int(c.length.Load()), attempt)
+}
+
+// collided is called when the code of the given attempt was already
+// taken, every further collision makes all following codes longer.
+func (c *codeSource) collided(ctx context.Context, attempt int) {
+	if !c.grows || attempt+1 < growAfterCollisions {
+		return
+	}
+
+	length := c.length.Load()
+	if length < maxCodeLength && c.length.CompareAndSwap(length, length+1) {
+		c.log.Info(ctx, "Short codes are growing", logger.Int64("length", length+1))
+	}
+}
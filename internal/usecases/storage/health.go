@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/MomsEngineer/urlshortener/internal/adapters/health"
+)
+
+// A worker is stuck once it missed this many beats in a row.
+const staleBeats = 3
+
+// heartbeat tells whether a worker loop is still turning, the loop
+// beats on every tick of its ticker.
+type heartbeat struct {
+	last    atomic.Int64
+	stopped atomic.Bool
+}
+
+func (h *heartbeat) beat(now time.Time) {
+	h.last.Store(now.UnixNano())
+}
+
+func (h *heartbeat) stop() {
+	h.stopped.Store(true)
+}
+
+func (h *heartbeat) check(now time.Time, every time.Duration) error {
+	if h.stopped.Load() {
+		return errors.New("stopped")
+	}
+
+	if since := now.Sub(time.Unix(0, h.last.Load())); since > staleBeats*every {
+		return fmt.Errorf("no progress for %s", since.Round(time.Second))
+	}
+
+	return nil
+}
+
+// migrationChecker is implemented by backends with a schema.
+type migrationChecker interface {
+	CheckMigrations(context.Context) error
+}
+
+// diskChecker is implemented by backends writing to local files.
+type diskChecker interface {
+	CheckWritable(context.Context) error
+}
+
+// HealthChecks lists what the storage needs to serve requests: the
+// backend itself, its schema or disk if it has one, and the background
+// workers. Probes hit the backend directly, so they don't show up in
+// the storage metrics and traces.
+func (s *Storage) HealthChecks() []health.Check {
+	backend := s.store
+	if o, ok := backend.(*observedStore); ok {
+		backend = o.store
+	}
+
+	checks := []health.Check{{Name: "storage", Run: backend.Ping}}
+	if m, ok := backend.(migrationChecker); ok {
+		checks = append(checks, health.Check{Name: "migrations", Run: m.CheckMigrations})
+	}
+	if d, ok := backend.(diskChecker); ok {
+		checks = append(checks, health.Check{Name: "disk", Run: d.CheckWritable})
+	}
+
+	return append(checks, health.Check{Name: "workers", Run: s.checkWorkers})
+}
+
+func (s *Storage) checkWorkers(context.Context) error {
+	now := time.Now()
+
+	var errs []error
+	if err := s.deleter.check(now); err != nil {
+		errs = append(errs, fmt.Errorf("delete batcher: %w", err))
+	}
+	if err := s.clicks.check(now); err != nil {
+		errs = append(errs, fmt.Errorf("click batcher: %w", err))
+	}
+	if err := s.reaper.check(now); err != nil {
+		errs = append(errs, fmt.Errorf("reaper: %w", err))
+	}
+
+	return errors.Join(errs...)
+}
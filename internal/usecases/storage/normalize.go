@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	ierror "github.com/MomsEngineer/urlshortener/internal/errors"
+	"golang.org/x/net/idna"
+)
+
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// normalizer turns original URLs into one canonical form, so the same
+// address written differently is detected as a duplicate.
+type normalizer struct {
+	stripFragment bool
+}
+
+// normalize accepts absolute http(s) URLs only. The scheme and host
+// are lowercased, an IDN host is converted to punycode and the
+// default port of the scheme is dropped.
+func (n normalizer) normalize(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", invalidURL("URL is empty")
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", invalidURL("URL can't be parsed")
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	if _, ok := defaultPorts[u.Scheme]; !ok {
+		return "", invalidURL("scheme must be http or https")
+	}
+
+	if u.Opaque != "" || u.Hostname() == "" {
+		return "", invalidURL("URL must be absolute")
+	}
+
+	host, err := normalizeHost(u.Hostname())
+	if err != nil {
+		return "", err
+	}
+
+	port := u.Port()
+	if port == defaultPorts[u.Scheme] {
+		port = ""
+	}
+
+	if port != "" {
+		u.Host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		u.Host = "[" + host + "]"
+	} else {
+		u.Host = host
+	}
+
+	if n.stripFragment {
+		u.Fragment = ""
+		u.RawFragment = ""
+	}
+
+	return u.String(), nil
+}
+
+func normalizeHost(host string) (string, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return strings.ToLower(host), nil
+	}
+
+	ascii, err := idna.Lookup.ToASCII(strings.TrimSuffix(host, "."))
+	if err != nil {
+		return "", invalidURL("host is not a valid domain name")
+	}
+
+	return ascii, nil
+}
+
+func invalidURL(reason string) error {
+	return fmt.Errorf("%w: %s", ierror.ErrInvalidURL, reason)
+}
@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"testing"
+
+	ierror "github.com/MomsEngineer/urlshortener/internal/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name          string
+		raw           string
+		stripFragment bool
+		expected      string
+	}{
+		{name: "Unchanged URL", raw: "https://example.com/path?q=1", expected: "https://example.com/path?q=1"},
+		{name: "Surrounding spaces", raw: "  https://example.com\n", expected: "https://example.com"},
+		{name: "Uppercase scheme and host", raw: "HTTP://Example.COM/Path", expected: "http://example.com/Path"},
+		{name: "Default http port", raw: "http://example.com:80/", expected: "http://example.com/"},
+		{name: "Default https port", raw: "https://example.com:443/", expected: "https://example.com/"},
+		{name: "Custom port", raw: "https://example.com:8443/", expected: "https://example.com:8443/"},
+		{name: "IDN host", raw: "https://пример.рф/путь", expected: "https://xn--e1afmkfd.xn--p1ai/%D0%BF%D1%83%D1%82%D1%8C"},
+		{name: "IPv6 host", raw: "http://[::1]:80/", expected: "http://[::1]/"},
+		{name: "Kept fragment", raw: "https://example.com/#top", expected: "https://example.com/#top"},
+		{name: "Stripped fragment", raw: "https://example.com/#top", stripFragment: true, expected: "https://example.com/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizer{stripFragment: tt.stripFragment}.normalize(tt.raw)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestNormalizeInvalid(t *testing.T) {
+	for _, raw := range []string{
+		"",
+		"   ",
+		"javascript:alert(1)",
+		"ftp://example.com",
+		"example.com",
+		"/relative/path",
+		"http:opaque",
+		"http://",
+		"http://exa mple.com",
+		"http://example.com:port",
+	} {
+		t.Run(raw, func(t *testing.T) {
+			_, err := normalizer{}.normalize(raw)
+			assert.ErrorIs(t, err, ierror.ErrInvalidURL)
+		})
+	}
+}
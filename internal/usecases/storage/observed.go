@@ -0,0 +1,221 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/MomsEngineer/urlshortener/internal/adapters/metrics"
+	"github.com/MomsEngineer/urlshortener/internal/entities/apikey"
+	"github.com/MomsEngineer/urlshortener/internal/entities/click"
+	"github.com/MomsEngineer/urlshortener/internal/entities/link"
+	"github.com/MomsEngineer/urlshortener/internal/entities/user"
+	ierror "github.com/MomsEngineer/urlshortener/internal/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/MomsEngineer/urlshortener/internal/usecases/storage")
+
+// observedStore records a span, the latency and the failures of every
+// call to the backend it wraps.
+type observedStore struct {
+	store   StoreInterface
+	backend string
+}
+
+func observe(store StoreInterface, backend string) StoreInterface {
+	return &observedStore{store: store, backend: backend}
+}
+
+// start begins the span of a call, the returned function ends it.
+func (s *observedStore) start(ctx context.Context, method string) (context.Context, func(error)) {
+	start := time.Now()
+	ctx, span := tracer.Start(ctx, "storage."+method,
+		trace.WithAttributes(attribute.String("storage.backend", s.backend)))
+
+	return ctx, func(err error) {
+		if ierror.IsFailure(err) {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+		metrics.ObserveStorage(s.backend, method, start, err)
+	}
+}
+
+func (s *observedStore) SaveLinksBatch(ctx context.Context, links []*link.Link) (err error) {
+	ctx, done := s.start(ctx, "SaveLinksBatch")
+	defer func() { done(err) }()
+	return s.store.SaveLinksBatch(ctx, links)
+}
+
+func (s *observedStore) SaveLink(ctx context.Context, l *link.Link) (err error) {
+	ctx, done := s.start(ctx, "SaveLink")
+	defer func() { done(err) }()
+	return s.store.SaveLink(ctx, l)
+}
+
+func (s *observedStore) GetLink(ctx context.Context, l *link.Link) (err error) {
+	ctx, done := s.start(ctx, "GetLink")
+	defer func() { done(err) }()
+	return s.store.GetLink(ctx, l)
+}
+
+func (s *observedStore) GetLinksByUser(ctx context.Context, userID string) (_ map[string]string, err error) {
+	ctx, done := s.start(ctx, "GetLinksByUser")
+	defer func() { done(err) }()
+	return s.store.GetLinksByUser(ctx, userID)
+}
+
+func (s *observedStore) DeleteLinks(ctx context.Context, links []*link.Link) (err error) {
+	ctx, done := s.start(ctx, "DeleteLinks")
+	defer func() { done(err) }()
+	return s.store.DeleteLinks(ctx, links)
+}
+
+func (s *observedStore) DeleteExpiredLinks(ctx context.Context, now time.Time) (_ int64, err error) {
+	ctx, done := s.start(ctx, "DeleteExpiredLinks")
+	defer func() { done(err) }()
+	return s.store.DeleteExpiredLinks(ctx, now)
+}
+
+func (s *observedStore) SaveClicks(ctx context.Context, clicks []*click.Click) (err error) {
+	ctx, done := s.start(ctx, "SaveClicks")
+	defer func() { done(err) }()
+	return s.store.SaveClicks(ctx, clicks)
+}
+
+func (s *observedStore) GetClickStats(ctx context.Context, short string) (_ *click.Stats, err error) {
+	ctx, done := s.start(ctx, "GetClickStats")
+	defer func() { done(err) }()
+	return s.store.GetClickStats(ctx, short)
+}
+
+func (s *observedStore) SaveAPIKey(ctx context.Context, key *apikey.APIKey) (err error) {
+	ctx, done := s.start(ctx, "SaveAPIKey")
+	defer func() { done(err) }()
+	return s.store.SaveAPIKey(ctx, key)
+}
+
+func (s *observedStore) GetAPIKey(ctx context.Context, hash string) (_ *apikey.APIKey, err error) {
+	ctx, done := s.start(ctx, "GetAPIKey")
+	defer func() { done(err) }()
+	return s.store.GetAPIKey(ctx, hash)
+}
+
+func (s *observedStore) GetAPIKeysByUser(ctx context.Context, userID string) (_ []*apikey.APIKey, err error) {
+	ctx, done := s.start(ctx, "GetAPIKeysByUser")
+	defer func() { done(err) }()
+	return s.store.GetAPIKeysByUser(ctx, userID)
+}
+
+func (s *observedStore) RevokeAPIKey(ctx context.Context, userID, id string, now time.Time) (err error) {
+	ctx, done := s.start(ctx, "RevokeAPIKey")
+	defer func() { done(err) }()
+	return s.store.RevokeAPIKey(ctx, userID, id, now)
+}
+
+func (s *observedStore) SaveUser(ctx context.Context, u *user.User, fromUserID string) (err error) {
+	ctx, done := s.start(ctx, "SaveUser")
+	defer func() { done(err) }()
+	return s.store.SaveUser(ctx, u, fromUserID)
+}
+
+func (s *observedStore) GetUserByLogin(ctx context.Context, login string) (_ *user.User, err error) {
+	ctx, done := s.start(ctx, "GetUserByLogin")
+	defer func() { done(err) }()
+	return s.store.GetUserByLogin(ctx, login)
+}
+
+func (s *observedStore) GetUserByID(ctx context.Context, id string) (_ *user.User, err error) {
+	ctx, done := s.start(ctx, "GetUserByID")
+	defer func() { done(err) }()
+	return s.store.GetUserByID(ctx, id)
+}
+
+func (s *observedStore) ListLinks(ctx context.Context, filter link.Filter) (_ []*link.Link, err error) {
+	ctx, done := s.start(ctx, "ListLinks")
+	defer func() { done(err) }()
+	return s.store.ListLinks(ctx, filter)
+}
+
+func (s *observedStore) DisableLink(ctx context.Context, short string, disabled bool) (err error) {
+	ctx, done := s.start(ctx, "DisableLink")
+	defer func() { done(err) }()
+	return s.store.DisableLink(ctx, short, disabled)
+}
+
+func (s *observedStore) SetLinkOwner(ctx context.Context, short, userID string) (err error) {
+	ctx, done := s.start(ctx, "SetLinkOwner")
+	defer func() { done(err) }()
+	return s.store.SetLinkOwner(ctx, short, userID)
+}
+
+func (s *observedStore) SetUserRole(ctx context.Context, userID string, role user.Role) (err error) {
+	ctx, done := s.start(ctx, "SetUserRole")
+	defer func() { done(err) }()
+	return s.store.SetUserRole(ctx, userID, role)
+}
+
+func (s *observedStore) BanUser(ctx context.Context, userID, reason string, now time.Time) (err error) {
+	ctx, done := s.start(ctx, "BanUser")
+	defer func() { done(err) }()
+	return s.store.BanUser(ctx, userID, reason, now)
+}
+
+func (s *observedStore) UnbanUser(ctx context.Context, userID string) (err error) {
+	ctx, done := s.start(ctx, "UnbanUser")
+	defer func() { done(err) }()
+	return s.store.UnbanUser(ctx, userID)
+}
+
+func (s *observedStore) IsBanned(ctx context.Context, userID string) (_ bool, err error) {
+	ctx, done := s.start(ctx, "IsBanned")
+	defer func() { done(err) }()
+	return s.store.IsBanned(ctx, userID)
+}
+
+func (s *observedStore) CountLinks(ctx context.Context) (urls, users int, err error) {
+	ctx, done := s.start(ctx, "CountLinks")
+	defer func() { done(err) }()
+	return s.store.CountLinks(ctx)
+}
+
+func (s *observedStore) CountUserLinks(ctx context.Context, userID string) (_ int, err error) {
+	ctx, done := s.start(ctx, "CountUserLinks")
+	defer func() { done(err) }()
+	return s.store.CountUserLinks(ctx, userID)
+}
+
+func (s *observedStore) AddDailyUsage(
+	ctx context.Context, userID string, day time.Time, n, limit int,
+) (_ int, err error) {
+	ctx, done := s.start(ctx, "AddDailyUsage")
+	defer func() { done(err) }()
+	return s.store.AddDailyUsage(ctx, userID, day, n, limit)
+}
+
+func (s *observedStore) GetDailyUsage(ctx context.Context, userID string, day time.Time) (_ int, err error) {
+	ctx, done := s.start(ctx, "GetDailyUsage")
+	defer func() { done(err) }()
+	return s.store.GetDailyUsage(ctx, userID, day)
+}
+
+func (s *observedStore) GetOrCreateSecret(ctx context.Context, name string, secret []byte) (_ []byte, err error) {
+	ctx, done := s.start(ctx, "GetOrCreateSecret")
+	defer func() { done(err) }()
+	return s.store.GetOrCreateSecret(ctx, name, secret)
+}
+
+func (s *observedStore) Ping(ctx context.Context) (err error) {
+	ctx, done := s.start(ctx, "Ping")
+	defer func() { done(err) }()
+	return s.store.Ping(ctx)
+}
+
+func (s *observedStore) Close() (err error) {
+	defer func(start time.Time) { metrics.ObserveStorage(s.backend, "Close", start, err) }(time.Now())
+	return s.store.Close()
+}
@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	ierror "github.com/MomsEngineer/urlshortener/internal/errors"
+)
+
+// Usage compares the links of a user with the quotas, a zero limit
+// means no limit. Daily quotas reset at midnight UTC.
+type Usage struct {
+	Links          int
+	MaxLinks       int
+	LinksToday     int
+	MaxLinksPerDay int
+	MaxBatchSize   int
+	ResetsAt       time.Time
+}
+
+type quotas struct {
+	links       int
+	linksPerDay int
+	batchSize   int
+}
+
+type anonymousIPKey struct{}
+
+// WithAnonymousIP marks the request as made by an anonymous user from
+// ip. Its links count against the daily quota of the IP as well, so a
+// new cookie does not reset the quota.
+func WithAnonymousIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, anonymousIPKey{}, ip)
+}
+
+// dailyQuotaKeys returns the keys of the daily counters of the request.
+func (s *Storage) dailyQuotaKeys(ctx context.Context, userID string) []string {
+	keys := []string{userID}
+	if ip, _ := ctx.Value(anonymousIPKey{}).(string); ip != "" {
+		keys = append(keys, "ip:"+s.ipHashes.Hash(ip))
+	}
+
+	return keys
+}
+
+func (s *Storage) GetUsage(ctx context.Context, userID string) (*Usage, error) {
+	now := time.Now().UTC()
+
+	links, err := s.store.CountUserLinks(ctx, userID)
+	if err != nil {
+		s.log.Error(ctx, "Failed to count user links", err)
+		return nil, err
+	}
+
+	today, err := s.store.GetDailyUsage(ctx, userID, now)
+	if err != nil {
+		s.log.Error(ctx, "Failed to get daily usage", err)
+		return nil, err
+	}
+
+	return &Usage{
+		Links:          links,
+		MaxLinks:       s.quotas.links,
+		LinksToday:     today,
+		MaxLinksPerDay: s.quotas.linksPerDay,
+		MaxBatchSize:   s.quotas.batchSize,
+		ResetsAt:       now.Truncate(24 * time.Hour).Add(24 * time.Hour),
+	}, nil
+}
+
+// reserve counts n new links of the user against the quotas, release
+// gives the given number of them back to the daily quota if they were
+// not created. The
+// links of anonymous users also count against the daily quota of their
+// IP. The total is checked before saving, so concurrent requests may
+// exceed it by a few links.
+func (s *Storage) reserve(ctx context.Context, userID string,
+	n int) (release func(unused int), err error) {
+	if n == 0 {
+		return func(int) {}, nil
+	}
+
+	if s.quotas.links > 0 {
+		owned, err := s.store.CountUserLinks(ctx, userID)
+		if err != nil {
+			s.log.Error(ctx, "Failed to count user links", err)
+			return nil, err
+		}
+
+		if owned+n > s.quotas.links {
+			return nil, fmt.Errorf("%w: %d of %d links are in use",
+				ierror.ErrLinksQuota, owned, s.quotas.links)
+		}
+	}
+
+	day := time.Now()
+	var reserved []string
+	release = func(unused int) {
+		if unused == 0 {
+			return
+		}
+		for _, key := range reserved {
+			_, err := s.store.AddDailyUsage(context.WithoutCancel(ctx), key, day, -unused, 0)
+			if err != nil {
+				s.log.Error(ctx, "Failed to release daily usage", err)
+			}
+		}
+	}
+
+	for _, key := range s.dailyQuotaKeys(ctx, userID) {
+		used, err := s.store.AddDailyUsage(ctx, key, day, n, s.quotas.linksPerDay)
+		if errors.Is(err, ierror.ErrQuotaExceeded) {
+			release(n)
+			return nil, fmt.Errorf("%w: %d of %d links are created",
+				ierror.ErrDailyQuota, used, s.quotas.linksPerDay)
+		} else if err != nil {
+			s.log.Error(ctx, "Failed to count daily usage", err)
+			release(n)
+			return nil, err
+		}
+		reserved = append(reserved, key)
+	}
+
+	return release, nil
+}
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/MomsEngineer/urlshortener/internal/adapters/logger"
+)
+
+// reaper periodically marks expired links as deleted.
+type reaper struct {
+	store    StoreInterface
+	log      *logger.Logger
+	interval time.Duration
+	done     chan struct{}
+	wg       sync.WaitGroup
+	alive    heartbeat
+}
+
+func newReaper(store StoreInterface, interval time.Duration, log *logger.Logger) *reaper {
+	r := &reaper{
+		store:    store,
+		log:      log,
+		interval: interval,
+		done:     make(chan struct{}),
+	}
+
+	if interval <= 0 {
+		log.Info(context.Background(), "Expired links cleanup is disabled")
+		return r
+	}
+
+	r.alive.beat(time.Now())
+	r.wg.Add(1)
+	go r.run()
+
+	return r
+}
+
+func (r *reaper) run() {
+	defer r.wg.Done()
+	defer r.alive.stop()
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			r.reap(now)
+			r.alive.beat(time.Now())
+		case <-r.done:
+			return
+		}
+	}
+}
+
+func (r *reaper) reap(now time.Time) {
+	ctx := context.Background()
+	n, err := r.store.DeleteExpiredLinks(ctx, now)
+	if err != nil {
+		r.log.Error(ctx, "Failed to delete expired links", err)
+		return
+	}
+
+	if n > 0 {
+		r.log.Info(ctx, "Deleted expired links", logger.Int64("count", n))
+	}
+}
+
+// check fails if the reaper stopped or is stuck deleting, a disabled
+// reaper is always fine.
+func (r *reaper) check(now time.Time) error {
+	if r.interval <= 0 {
+		return nil
+	}
+
+	return r.alive.check(now, r.interval)
+}
+
+func (r *reaper) close() {
+	close(r.done)
+	r.wg.Wait()
+}
@@ -0,0 +1,20 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+)
+
+// ipHashSecret keys the visitor IP hashes unless IP_HASH_KEY is set.
+const ipHashSecret = "ip-hash"
+
+// Secret returns the secret kept in the store under name, it is
+// generated when it is first asked for.
+func (s *Storage) Secret(ctx context.Context, name string) ([]byte, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+
+	return s.store.GetOrCreateSecret(ctx, name, secret)
+}
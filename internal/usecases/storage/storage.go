@@ -3,122 +3,433 @@ package storage
 import (
 	"context"
 	"errors"
+	"fmt"
+	"time"
 
+	"github.com/MomsEngineer/urlshortener/internal/adapters/config"
+	"github.com/MomsEngineer/urlshortener/internal/adapters/health"
 	"github.com/MomsEngineer/urlshortener/internal/adapters/logger"
+	"github.com/MomsEngineer/urlshortener/internal/adapters/metrics"
 	db "github.com/MomsEngineer/urlshortener/internal/adapters/storage/db_storage"
 	fs "github.com/MomsEngineer/urlshortener/internal/adapters/storage/file_storage"
 	ms "github.com/MomsEngineer/urlshortener/internal/adapters/storage/map_storage"
+	"github.com/MomsEngineer/urlshortener/internal/entities/apikey"
+	"github.com/MomsEngineer/urlshortener/internal/entities/click"
 	"github.com/MomsEngineer/urlshortener/internal/entities/link"
+	"github.com/MomsEngineer/urlshortener/internal/entities/user"
 	ierror "github.com/MomsEngineer/urlshortener/internal/errors"
 )
 
-var log = logger.Create(logger.InfoLevel)
-
 type StoreInterface interface {
 	SaveLinksBatch(context.Context, []*link.Link) error
 	SaveLink(context.Context, *link.Link) error
 	GetLink(context.Context, *link.Link) error
 	GetLinksByUser(ctx context.Context, userID string) (map[string]string, error)
+	DeleteLinks(context.Context, []*link.Link) error
+	DeleteExpiredLinks(ctx context.Context, now time.Time) (int64, error)
+	SaveClicks(context.Context, []*click.Click) error
+	GetClickStats(ctx context.Context, short string) (*click.Stats, error)
+	SaveAPIKey(context.Context, *apikey.APIKey) error
+	GetAPIKey(ctx context.Context, hash string) (*apikey.APIKey, error)
+	GetAPIKeysByUser(ctx context.Context, userID string) ([]*apikey.APIKey, error)
+	RevokeAPIKey(ctx context.Context, userID, id string, now time.Time) error
+	// SaveUser hands the live links and API keys of fromUserID, if
+	// set, over to the new user in the same write, a failed save moves
+	// nothing.
+	SaveUser(ctx context.Context, u *user.User, fromUserID string) error
+	GetUserByLogin(ctx context.Context, login string) (*user.User, error)
+	GetUserByID(ctx context.Context, id string) (*user.User, error)
+	ListLinks(context.Context, link.Filter) ([]*link.Link, error)
+	DisableLink(ctx context.Context, short string, disabled bool) error
+	SetLinkOwner(ctx context.Context, short, userID string) error
+	SetUserRole(ctx context.Context, userID string, role user.Role) error
+	BanUser(ctx context.Context, userID, reason string, now time.Time) error
+	UnbanUser(ctx context.Context, userID string) error
+	IsBanned(ctx context.Context, userID string) (bool, error)
+	CountLinks(context.Context) (urls, users int, err error)
+	CountUserLinks(ctx context.Context, userID string) (int, error)
+	AddDailyUsage(ctx context.Context, userID string, day time.Time, n, limit int) (int, error)
+	GetDailyUsage(ctx context.Context, userID string, day time.Time) (int, error)
+	GetOrCreateSecret(ctx context.Context, name string, secret []byte) ([]byte, error)
 	Ping(context.Context) error
 	Close() error
 }
 
 type StoregeInterface interface {
-	SaveLinksBatch(cxt context.Context, userID string, links map[string]string) error
-	SaveLink(ctx context.Context, userID, original string) (string, error)
+	SaveLinksBatch(cxt context.Context, userID string, items []*BatchItem) error
+	SaveLink(ctx context.Context, userID, original string, opts ...link.Option) (string, error)
 	GetLink(ctx context.Context, userID, short string) (string, error)
 	GetLinksByUser(ctx context.Context, userID string) (map[string]string, error)
+	DeleteLinks(ctx context.Context, userID string, shorts []string) error
+	RecordClick(ctx context.Context, short, referrer, userAgent, ip string) error
+	GetLinkStats(ctx context.Context, userID, short string) (*click.Stats, error)
+	CreateAPIKey(ctx context.Context, userID, name string, scopes []apikey.Scope) (string, *apikey.APIKey, error)
+	ListAPIKeys(ctx context.Context, userID string) ([]*apikey.APIKey, error)
+	RevokeAPIKey(ctx context.Context, userID, id string) error
+	AuthenticateAPIKey(ctx context.Context, key string) (*apikey.APIKey, error)
+	Register(ctx context.Context, anonymousID, login, password string) (*user.User, error)
+	Login(ctx context.Context, login, password string) (*user.User, error)
+	UserRole(ctx context.Context, userID string) (user.Role, error)
+	ListAllLinks(context.Context, link.Filter) ([]*link.Link, error)
+	DisableLink(ctx context.Context, short string, disabled bool) error
+	ReassignLink(ctx context.Context, short, userID string) error
+	SetUserRole(ctx context.Context, userID string, role user.Role) error
+	BanUser(ctx context.Context, userID, reason string) error
+	UnbanUser(ctx context.Context, userID string) error
+	IsBanned(ctx context.Context, userID string) (bool, error)
+	GetStats(context.Context) (*Stats, error)
+	GetUsage(ctx context.Context, userID string) (*Usage, error)
+	Secret(ctx context.Context, name string) ([]byte, error)
+	HealthChecks() []health.Check
 	Ping(context.Context) error
 	Close() error
 }
 
+// Stats counts the live links and the distinct users owning them.
+type Stats struct {
+	URLs  int
+	Users int
+}
+
+// BatchItem is one link of a batch, ShortURL is filled
+// once the batch is saved. Err tells why the item was rejected.
+type BatchItem struct {
+	CorrelationID string
+	OriginalURL   string
+	ExpiresAt     time.Time
+	ShortURL      string
+	Err           error
+}
+
 type Storage struct {
-	store StoreInterface
+	store    StoreInterface
+	log      *logger.Logger
+	codes    *codeSource
+	urls     normalizer
+	deleter  *batcher[*link.Link]
+	clicks   *batcher[*click.Click]
+	ipHashes click.IPHasher
+	reaper   *reaper
+	admins   map[string]struct{}
+	quotas   quotas
+}
+
+func newStorage(store StoreInterface, gen link.Generator, cfg *config.Config, log *logger.Logger) *Storage {
+	return &Storage{
+		store:    store,
+		log:      log,
+		codes:    newCodeSource(gen, cfg.ShortCodeLength, log),
+		urls:     normalizer{stripFragment: cfg.StripFragments},
+		deleter:  newBatcher("delete", store.DeleteLinks, blockWhenFull, log),
+		clicks:   newBatcher("click", store.SaveClicks, dropWhenFull, log),
+		ipHashes: click.NewIPHasher([]byte(cfg.IPHashKey)),
+		reaper:   newReaper(store, cfg.ReaperInterval, log),
+		admins:   parseLogins(cfg.AdminLogins),
+		quotas: quotas{
+			links:       cfg.QuotaLinks,
+			linksPerDay: cfg.QuotaLinksPerDay,
+			batchSize:   cfg.QuotaBatchSize,
+		},
+	}
 }
 
-func Create(dsn, filePath string) (StoregeInterface, error) {
-	if dsn != "" {
-		store, err := db.NewDB(dsn)
+func Create(cfg *config.Config, log *logger.Logger) (StoregeInterface, error) {
+	ctx := context.Background()
+
+	gen, err := link.NewGenerator(cfg.ShortCodeGenerator)
+	if err != nil {
+		log.Error(ctx, "Invalid short code generator", err)
+		return nil, err
+	}
+
+	scope, err := link.ParseUniqueScope(cfg.UniqueOriginals)
+	if err != nil {
+		log.Error(ctx, "Invalid uniqueness scope", err)
+		return nil, err
+	}
+
+	var store StoreInterface
+	if cfg.DataBaseDSN != "" {
+		database, err := db.NewDB(cfg.DataBaseDSN, db.WithUniqueScope(scope), db.WithLogger(log))
+		if err != nil {
+			log.Error(ctx, "Failed to create DB storage", err)
+			return nil, err
+		}
+		log.Info(ctx, "Created DB storage")
+
+		store = observe(database, "postgres")
+	} else if cfg.FilePath != "" {
+		syncOpt, err := fs.SyncOption(cfg.FileSync)
 		if err != nil {
-			log.Error("Failed to create DB storage", err)
+			log.Error(ctx, "Invalid file sync mode", err)
 			return nil, err
 		}
-		log.Info("Created DB")
 
-		return &Storage{store: store}, nil
-	} else if filePath != "" {
-		store, err := fs.NewFileStorage(filePath)
+		file, err := fs.NewFileStorage(cfg.FilePath, syncOpt, fs.WithUniqueScope(scope), fs.WithLogger(log))
 		if err != nil {
-			log.Error("Failed to create file storage", err)
+			log.Error(ctx, "Failed to create file storage", err)
 			return nil, err
 		}
-		log.Info("Created file storage")
+		log.Info(ctx, "Created file storage", logger.String("path", cfg.FilePath))
 
-		return &Storage{store: store}, nil
+		store = observe(file, "file")
+	} else {
+		store = observe(ms.NewMapStorage(ms.WithUniqueScope(scope)), "memory")
+		log.Info(ctx, "Created map storage")
 	}
 
-	store := ms.NewMapStorage()
-	log.Info("Created map storage")
+	s := newStorage(store, gen, cfg, log)
 
-	return &Storage{store: store}, nil
+	// Without a configured key the click stats of all instances and
+	// restarts share one generated key.
+	if cfg.IPHashKey == "" {
+		key, err := s.Secret(ctx, ipHashSecret)
+		if err != nil {
+			log.Error(ctx, "Failed to load the IP hash key", err)
+			s.Close()
+			return nil, err
+		}
+		s.ipHashes = click.NewIPHasher(key)
+	}
+
+	return s, nil
 }
 
-func (s *Storage) SaveLinksBatch(ctx context.Context, userID string, ls map[string]string) error {
-	var links []*link.Link
+// SaveLinksBatch saves the normalized URLs of all items. If any URL is
+// invalid nothing is saved and the rejected items get their Err set.
+// Like SaveLink, only the created links count against the daily quota:
+// the batch needs room for all items, the ones whose original URL is
+// already shortened are given back.
+func (s *Storage) SaveLinksBatch(ctx context.Context, userID string, items []*BatchItem) error {
+	if s.quotas.batchSize > 0 && len(items) > s.quotas.batchSize {
+		return fmt.Errorf("%w: %d links, at most %d are allowed",
+			ierror.ErrBatchQuota, len(items), s.quotas.batchSize)
+	}
 
-	for id, original := range ls {
-		l, err := link.NewLink(userID, "", original)
-		if err != nil {
-			log.Error("Failed to create new link", err)
-			return err
+	originals := make([]string, len(items))
+	invalid := 0
+	for i, item := range items {
+		originals[i], item.Err = s.urls.normalize(item.OriginalURL)
+		if item.Err != nil {
+			invalid++
 		}
+	}
 
-		links = append(links, l)
-		ls[id] = l.ShortURL
+	if invalid > 0 {
+		s.log.Debug(ctx, "Rejected invalid URLs in batch", logger.Int("invalid", invalid))
+		return fmt.Errorf("%w: %d of %d URLs in batch", ierror.ErrInvalidURL, invalid, len(items))
 	}
 
-	if err := s.store.SaveLinksBatch(ctx, links); err != nil {
-		log.Error("Failed to save links batch", err)
+	release, err := s.reserve(ctx, userID, len(items))
+	if err != nil {
 		return err
 	}
 
-	return nil
+	created, err := s.saveLinksBatch(ctx, userID, originals, items)
+	release(len(items) - created)
+
+	return err
 }
 
-func (s *Storage) SaveLink(ctx context.Context, userID, original string) (string, error) {
-	l, err := link.NewLink(userID, "", original)
+// saveLinksBatch returns the number of links it created.
+func (s *Storage) saveLinksBatch(ctx context.Context, userID string,
+	originals []string, items []*BatchItem) (int, error) {
+	for attempt := 0; attempt < maxGenerateAttempts; attempt++ {
+		var links []*link.Link
+		shorts := make([]string, len(items))
+
+		for i, item := range items {
+			short, err := s.codes.next(originals[i], attempt)
+			if err != nil {
+				s.log.Error(ctx, "Failed to generate short code", err)
+				return 0, err
+			}
+			shorts[i] = short
+
+			l, err := link.NewLink(userID, short, originals[i], link.WithExpiry(item.ExpiresAt))
+			if err != nil {
+				s.log.Error(ctx, "Failed to create new link", err)
+				return 0, err
+			}
+
+			links = append(links, l)
+		}
+
+		err := s.store.SaveLinksBatch(ctx, links)
+		if errors.Is(err, ierror.ErrAliasTaken) {
+			s.log.Debug(ctx, "Short code collision in batch", logger.Int("attempt", attempt))
+			s.codes.collided(ctx, attempt)
+			continue
+		} else if err != nil {
+			s.log.Error(ctx, "Failed to save links batch", err)
+			return 0, err
+		}
+
+		created := 0
+		for i, l := range links {
+			items[i].ShortURL = l.ShortURL
+			// Already shortened originals keep their old code.
+			if l.ShortURL == shorts[i] {
+				created++
+			}
+		}
+		metrics.LinksCreated(created)
+
+		return created, nil
+	}
+
+	return 0, fmt.Errorf("no free short codes after %d attempts", maxGenerateAttempts)
+}
+
+// SaveLink saves the normalized link under a generated code, a
+// colliding code is replaced with a new one. A taken alias is
+// reported to the caller.
+func (s *Storage) SaveLink(ctx context.Context, userID, original string, opts ...link.Option) (string, error) {
+	original, err := s.urls.normalize(original)
 	if err != nil {
-		log.Error("Failed to create new link", err)
+		s.log.Debug(ctx, "Rejected invalid URL", logger.Err(err))
 		return "", err
 	}
 
-	if err := s.store.SaveLink(ctx, l); err != nil {
-		if errors.Is(err, ierror.ErrDuplicate) {
+	release, err := s.reserve(ctx, userID, 1)
+	if err != nil {
+		return "", err
+	}
+
+	short, err := s.saveLink(ctx, userID, original, opts...)
+	if err != nil {
+		release(1)
+	}
+
+	return short, err
+}
+
+func (s *Storage) saveLink(ctx context.Context, userID, original string, opts ...link.Option) (string, error) {
+	for attempt := 0; attempt < maxGenerateAttempts; attempt++ {
+		short, err := s.codes.next(original, attempt)
+		if err != nil {
+			s.log.Error(ctx, "Failed to generate short code", err)
+			return "", err
+		}
+
+		l, err := link.NewLink(userID, short, original, opts...)
+		if err != nil {
+			s.log.Error(ctx, "Failed to create new link", err)
+			return "", err
+		}
+
+		err = s.store.SaveLink(ctx, l)
+		if errors.Is(err, ierror.ErrAliasTaken) && l.ShortURL == short {
+			s.log.Debug(ctx, "Short code collision", logger.String("short", short), logger.Int("attempt", attempt))
+			s.codes.collided(ctx, attempt)
+			continue
+		} else if errors.Is(err, ierror.ErrDuplicate) {
 			return l.ShortURL, err
+		} else if errors.Is(err, ierror.ErrAliasTaken) {
+			s.log.Debug(ctx, "Alias already taken", logger.String("alias", l.ShortURL))
+			return "", err
+		} else if err != nil {
+			s.log.Error(ctx, "Failed to save link", err)
+			return "", err
 		}
-		log.Error("Failed to get link", err)
-		return "", err
+
+		metrics.LinksCreated(1)
+		return l.ShortURL, nil
 	}
 
-	return l.ShortURL, nil
+	return "", fmt.Errorf("no free short code after %d attempts", maxGenerateAttempts)
 }
 
 func (s *Storage) GetLink(ctx context.Context, userID, short string) (string, error) {
 	l, err := link.NewLink(userID, short, "")
 	if err != nil {
-		log.Error("Failed to create new link", err)
+		s.log.Error(ctx, "Failed to create new link", err)
 		return "", err
 	}
 
 	if err := s.store.GetLink(ctx, l); err != nil {
-		log.Error("Failed to get link", err)
+		s.log.Error(ctx, "Failed to get link", err)
 		return "", err
 	}
 
+	if l.IsDeleted {
+		s.log.Debug(ctx, "Link is deleted", logger.String("short", short))
+		return "", ierror.ErrDeleted
+	}
+
+	if l.IsDisabled {
+		s.log.Debug(ctx, "Link is disabled", logger.String("short", short))
+		return "", ierror.ErrDisabled
+	}
+
+	if l.IsExpired(time.Now()) {
+		s.log.Debug(ctx, "Link is expired", logger.String("short", short))
+		return "", ierror.ErrExpired
+	}
+
 	return l.OriginalURL, nil
 }
 
+// DeleteLinks queues the user's links for deletion and returns
+// without waiting for the store to process them. If the queue is full
+// it waits for room, so deletions are slowed down but never lost.
+func (s *Storage) DeleteLinks(ctx context.Context, userID string, shorts []string) error {
+	links := make([]*link.Link, 0, len(shorts))
+	for _, short := range shorts {
+		l, err := link.NewLink(userID, short, "")
+		if err != nil {
+			s.log.Error(ctx, "Failed to create new link", err)
+			return err
+		}
+
+		links = append(links, l)
+	}
+
+	if err := s.deleter.enqueue(ctx, links...); err != nil {
+		s.log.Error(ctx, "Failed to queue links for deletion", err)
+		return err
+	}
+
+	return nil
+}
+
+// RecordClick queues a redirect event, the store receives it with the
+// next batch. The click is dropped if the queue is full, the redirect
+// does not wait for the stats.
+func (s *Storage) RecordClick(ctx context.Context, short, referrer, userAgent, ip string) error {
+	return s.clicks.enqueue(ctx, click.NewClick(short, referrer, userAgent, s.ipHashes.Hash(ip)))
+}
+
+func (s *Storage) GetLinkStats(ctx context.Context, userID, short string) (*click.Stats, error) {
+	l, err := link.NewLink(userID, short, "")
+	if err != nil {
+		s.log.Error(ctx, "Failed to create new link", err)
+		return nil, err
+	}
+
+	if err := s.store.GetLink(ctx, l); err != nil {
+		s.log.Error(ctx, "Failed to get link", err)
+		return nil, err
+	}
+
+	if l.UserID != userID {
+		s.log.Debug(ctx, "Link is not owned by the user", logger.String("short", short))
+		return nil, ierror.ErrForbidden
+	}
+
+	stats, err := s.store.GetClickStats(ctx, short)
+	if err != nil {
+		s.log.Error(ctx, "Failed to get clicks", err)
+		return nil, err
+	}
+
+	return stats, nil
+}
+
 func (s *Storage) Close() error {
+	s.reaper.close()
+	s.deleter.close()
+	s.clicks.close()
 	return s.store.Close()
 }
 
@@ -129,14 +440,26 @@ func (s *Storage) Ping(ctx context.Context) error {
 func (s *Storage) GetLinksByUser(ctx context.Context, userID string) (map[string]string, error) {
 	links, err := s.store.GetLinksByUser(ctx, userID)
 	if err != nil {
-		log.Error("Failed to get links", err)
+		s.log.Error(ctx, "Failed to get links", err)
 		return nil, err
 	}
 
 	if len(links) == 0 {
-		log.Debug("Not found link for userd id", userID)
+		s.log.Debug(ctx, "User has no links")
 		return nil, ierror.ErrNoContent
 	}
 
 	return links, nil
 }
+
+// GetStats counts links that are not deleted, expired links are
+// counted until the reaper deletes them.
+func (s *Storage) GetStats(ctx context.Context) (*Stats, error) {
+	urls, users, err := s.store.CountLinks(ctx)
+	if err != nil {
+		s.log.Error(ctx, "Failed to count links", err)
+		return nil, err
+	}
+
+	return &Stats{URLs: urls, Users: users}, nil
+}
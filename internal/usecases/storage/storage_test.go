@@ -0,0 +1,526 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/MomsEngineer/urlshortener/internal/adapters/config"
+	"github.com/MomsEngineer/urlshortener/internal/adapters/logger"
+	ms "github.com/MomsEngineer/urlshortener/internal/adapters/storage/map_storage"
+	"github.com/MomsEngineer/urlshortener/internal/entities/click"
+	"github.com/MomsEngineer/urlshortener/internal/entities/link"
+	"github.com/MomsEngineer/urlshortener/internal/entities/user"
+	ierror "github.com/MomsEngineer/urlshortener/internal/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestDeleteLinks(t *testing.T) {
+	store := ms.NewMapStorage()
+	s := newStorage(store, link.RandomGenerator{}, &config.Config{}, logger.NewNop())
+
+	first, err := s.SaveLink(context.TODO(), "owner", "https://example.com")
+	require.NoError(t, err)
+
+	second, err := s.SaveLink(context.TODO(), "owner", "https://test.com")
+	require.NoError(t, err)
+
+	err = s.DeleteLinks(context.TODO(), "owner", []string{first})
+	require.NoError(t, err)
+
+	err = s.DeleteLinks(context.TODO(), "stranger", []string{second})
+	require.NoError(t, err)
+
+	// Close waits for the queued deletions to reach the store.
+	require.NoError(t, s.Close())
+
+	_, err = s.GetLink(context.TODO(), "owner", first)
+	assert.ErrorIs(t, err, ierror.ErrDeleted)
+
+	original, err := s.GetLink(context.TODO(), "owner", second)
+	require.NoError(t, err)
+	assert.Equal(t, "https://test.com", original)
+}
+
+func TestDeleteLinksAfterClose(t *testing.T) {
+	s := newStorage(ms.NewMapStorage(), link.RandomGenerator{}, &config.Config{}, logger.NewNop())
+	require.NoError(t, s.Close())
+
+	err := s.DeleteLinks(context.TODO(), "owner", []string{"short"})
+	assert.ErrorIs(t, err, ierror.ErrStorageUnavailable)
+
+	err = s.RecordClick(context.TODO(), "short", "", "", "10.0.0.1")
+	assert.ErrorIs(t, err, ierror.ErrStorageUnavailable)
+}
+
+func TestGetLinkStats(t *testing.T) {
+	store := ms.NewMapStorage()
+	s := newStorage(store, link.RandomGenerator{}, &config.Config{}, logger.NewNop())
+
+	short, err := s.SaveLink(context.TODO(), "owner", "https://example.com")
+	require.NoError(t, err)
+
+	for _, ip := range []string{"10.0.0.1", "10.0.0.1", "10.0.0.2"} {
+		err := s.RecordClick(context.TODO(), short, "https://referrer.com", "agent", ip)
+		require.NoError(t, err)
+	}
+
+	// Close waits for the queued clicks to reach the store.
+	require.NoError(t, s.Close())
+
+	stats, err := s.GetLinkStats(context.TODO(), "owner", short)
+	require.NoError(t, err)
+	assert.Equal(t, 3, stats.Total)
+	assert.Equal(t, 2, stats.Unique)
+	require.Len(t, stats.Daily, 1)
+	assert.Equal(t, 3, stats.Daily[0].Clicks)
+
+	_, err = s.GetLinkStats(context.TODO(), "stranger", short)
+	assert.ErrorIs(t, err, ierror.ErrForbidden)
+}
+
+func TestGetExpiredLink(t *testing.T) {
+	store := ms.NewMapStorage()
+	s := newStorage(store, link.RandomGenerator{}, &config.Config{}, logger.NewNop())
+	defer s.Close()
+
+	short, err := s.SaveLink(context.TODO(), "owner", "https://example.com",
+		link.WithExpiry(time.Now().Add(-time.Second)))
+	require.NoError(t, err)
+
+	_, err = s.GetLink(context.TODO(), "owner", short)
+	assert.ErrorIs(t, err, ierror.ErrExpired)
+
+	s.reaper.reap(time.Now())
+
+	_, err = s.GetLink(context.TODO(), "owner", short)
+	assert.ErrorIs(t, err, ierror.ErrDeleted)
+}
+
+// repeatGenerator returns the same code until it is asked to retry.
+type repeatGenerator struct{}
+
+func (repeatGenerator) Generate(_ string, length, attempt int) (string, error) {
+	return fmt.Sprintf("%0*d", length, attempt), nil
+}
+
+func TestSaveLinkCollision(t *testing.T) {
+	store := ms.NewMapStorage()
+	s := newStorage(store, repeatGenerator{}, &config.Config{ShortCodeLength: 4}, logger.NewNop())
+	defer s.Close()
+
+	first, err := s.SaveLink(context.TODO(), "owner", "https://example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "0000", first)
+
+	second, err := s.SaveLink(context.TODO(), "owner", "https://test.com")
+	require.NoError(t, err)
+	assert.Equal(t, "0001", second, "a colliding code must be regenerated")
+
+	third, err := s.SaveLink(context.TODO(), "owner", "https://third.com")
+	require.NoError(t, err)
+	assert.Equal(t, "00002", third, "repeated collisions must grow the code")
+
+	_, err = s.SaveLink(context.TODO(), "owner", "https://alias.com", link.WithAlias("0000"))
+	assert.ErrorIs(t, err, ierror.ErrAliasTaken, "a taken alias must not be regenerated")
+
+	items := []*BatchItem{
+		{CorrelationID: "1", OriginalURL: "https://batch.com"},
+	}
+	require.NoError(t, s.SaveLinksBatch(context.TODO(), "owner", items))
+	assert.Equal(t, "00000", items[0].ShortURL)
+}
+
+func TestSaveHashedLinkPerUser(t *testing.T) {
+	store := ms.NewMapStorage(ms.WithUniqueScope(link.UniquePerUser))
+	s := newStorage(store, link.HashGenerator{}, &config.Config{ShortCodeLength: 8}, logger.NewNop())
+	defer s.Close()
+
+	shorts := make(map[string]bool)
+	for _, userID := range []string{"first", "second", "third", "fourth"} {
+		short, err := s.SaveLink(context.TODO(), userID, "https://example.com")
+		require.NoError(t, err)
+		assert.Len(t, short, 8, "re-shortening one URL must not grow the codes")
+		shorts[short] = true
+	}
+	assert.Len(t, shorts, 4)
+
+	short, err := s.SaveLink(context.TODO(), "first", "https://test.com")
+	require.NoError(t, err)
+	assert.Len(t, short, 8)
+}
+
+func TestSaveDuplicateLink(t *testing.T) {
+	store := ms.NewMapStorage()
+	s := newStorage(store, link.RandomGenerator{}, &config.Config{}, logger.NewNop())
+	defer s.Close()
+
+	first, err := s.SaveLink(context.TODO(), "owner", "https://example.com")
+	require.NoError(t, err)
+
+	second, err := s.SaveLink(context.TODO(), "stranger", "https://example.com")
+	require.ErrorIs(t, err, ierror.ErrDuplicate)
+	assert.Equal(t, first, second, "a duplicate must return the existing short URL")
+}
+
+func TestSaveNormalizedDuplicateLink(t *testing.T) {
+	store := ms.NewMapStorage()
+	s := newStorage(store, link.RandomGenerator{}, &config.Config{StripFragments: true}, logger.NewNop())
+	defer s.Close()
+
+	first, err := s.SaveLink(context.TODO(), "owner", "HTTPS://Example.COM:443/path#top")
+	require.NoError(t, err)
+
+	second, err := s.SaveLink(context.TODO(), "stranger", " https://example.com/path ")
+	require.ErrorIs(t, err, ierror.ErrDuplicate)
+	assert.Equal(t, first, second, "differently written URLs must be duplicates")
+
+	original, err := s.GetLink(context.TODO(), "owner", first)
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/path", original)
+}
+
+func TestSaveInvalidBatch(t *testing.T) {
+	store := ms.NewMapStorage()
+	s := newStorage(store, link.RandomGenerator{}, &config.Config{}, logger.NewNop())
+	defer s.Close()
+
+	items := []*BatchItem{
+		{CorrelationID: "1", OriginalURL: "https://example.com"},
+		{CorrelationID: "2", OriginalURL: "javascript:alert(1)"},
+	}
+	require.ErrorIs(t, s.SaveLinksBatch(context.TODO(), "owner", items), ierror.ErrInvalidURL)
+
+	assert.NoError(t, items[0].Err)
+	assert.ErrorIs(t, items[1].Err, ierror.ErrInvalidURL)
+
+	links, err := store.GetLinksByUser(context.TODO(), "owner")
+	require.NoError(t, err)
+	assert.Empty(t, links, "an invalid batch must not save any link")
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	store := ms.NewMapStorage()
+	s := newStorage(store, link.RandomGenerator{}, &config.Config{}, logger.NewNop())
+	defer s.Close()
+
+	plain, k, err := s.CreateAPIKey(context.TODO(), "owner", "ci", nil)
+	require.NoError(t, err)
+
+	got, err := s.AuthenticateAPIKey(context.TODO(), plain)
+	require.NoError(t, err)
+	assert.Equal(t, "owner", got.UserID)
+
+	_, err = s.AuthenticateAPIKey(context.TODO(), "usk_unknown")
+	require.ErrorIs(t, err, ierror.ErrUnauthorized)
+
+	require.NoError(t, s.RevokeAPIKey(context.TODO(), "owner", k.ID))
+	_, err = s.AuthenticateAPIKey(context.TODO(), plain)
+	require.ErrorIs(t, err, ierror.ErrUnauthorized, "a revoked key must be rejected")
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	store := ms.NewMapStorage()
+	s := newStorage(store, link.RandomGenerator{}, &config.Config{}, logger.NewNop())
+	defer s.Close()
+
+	short, err := s.SaveLink(context.TODO(), "anonymous", "https://example.com")
+	require.NoError(t, err)
+
+	u, err := s.Register(context.TODO(), "anonymous", " Alice ", "password")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", u.Login)
+
+	links, err := s.GetLinksByUser(context.TODO(), u.ID)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{short: "https://example.com"}, links,
+		"links of the anonymous user must move to the account")
+
+	_, err = s.Register(context.TODO(), "", "alice", "password")
+	require.ErrorIs(t, err, ierror.ErrDuplicate)
+
+	got, err := s.Login(context.TODO(), "ALICE", "password")
+	require.NoError(t, err)
+	assert.Equal(t, u.ID, got.ID)
+
+	_, err = s.Login(context.TODO(), "alice", "wrong password")
+	require.ErrorIs(t, err, ierror.ErrUnauthorized)
+
+	_, err = s.Login(context.TODO(), "bob", "password")
+	require.ErrorIs(t, err, ierror.ErrUnauthorized)
+}
+
+func TestModeration(t *testing.T) {
+	store := ms.NewMapStorage()
+	s := newStorage(store, link.RandomGenerator{}, &config.Config{AdminLogins: "Root, boss"}, logger.NewNop())
+	defer s.Close()
+
+	short, err := s.SaveLink(context.TODO(), "spammer", "https://example.com")
+	require.NoError(t, err)
+
+	require.NoError(t, s.DisableLink(context.TODO(), short, true))
+	_, err = s.GetLink(context.TODO(), "", short)
+	require.ErrorIs(t, err, ierror.ErrDisabled)
+	require.ErrorIs(t, err, ierror.ErrGone)
+
+	links, err := s.ListAllLinks(context.TODO(), link.Filter{Limit: -1})
+	require.NoError(t, err)
+	assert.Len(t, links, 1)
+
+	root, err := s.Register(context.TODO(), "", "root", "password")
+	require.NoError(t, err)
+	assert.Equal(t, user.RoleAdmin, root.Role, "configured admins must get the admin role")
+
+	u, err := s.Register(context.TODO(), "", "alice", "password")
+	require.NoError(t, err)
+	assert.Equal(t, user.RoleUser, u.Role)
+
+	require.ErrorIs(t, s.SetUserRole(context.TODO(), u.ID, "root"), user.ErrInvalidRole)
+	require.NoError(t, s.SetUserRole(context.TODO(), u.ID, user.RoleModerator))
+	role, err := s.UserRole(context.TODO(), u.ID)
+	require.NoError(t, err)
+	assert.Equal(t, user.RoleModerator, role, "a changed role must apply without a new login")
+	require.NoError(t, s.SetUserRole(context.TODO(), u.ID, user.RoleUser))
+	role, err = s.UserRole(context.TODO(), u.ID)
+	require.NoError(t, err)
+	assert.Equal(t, user.RoleUser, role, "a demotion must apply without a new login")
+	require.NoError(t, s.SetUserRole(context.TODO(), u.ID, user.RoleModerator))
+	u, err = s.Login(context.TODO(), "alice", "password")
+	require.NoError(t, err)
+	assert.Equal(t, user.RoleModerator, u.Role)
+
+	require.ErrorIs(t, s.SetUserRole(context.TODO(), root.ID, user.RoleUser), ierror.ErrForbidden,
+		"configured admins cannot be demoted")
+	role, err = s.UserRole(context.TODO(), root.ID)
+	require.NoError(t, err)
+	assert.Equal(t, user.RoleAdmin, role)
+	_, err = s.UserRole(context.TODO(), "missing")
+	require.ErrorIs(t, err, ierror.ErrNotFound)
+
+	require.NoError(t, s.BanUser(context.TODO(), u.ID, "spam"))
+	_, err = s.Login(context.TODO(), "alice", "password")
+	require.ErrorIs(t, err, ierror.ErrForbidden, "a banned user must not log in")
+
+	plain, _, err := s.CreateAPIKey(context.TODO(), u.ID, "ci", nil)
+	require.NoError(t, err)
+	_, err = s.AuthenticateAPIKey(context.TODO(), plain)
+	require.ErrorIs(t, err, ierror.ErrForbidden, "keys of a banned user must be rejected")
+
+	require.NoError(t, s.UnbanUser(context.TODO(), u.ID))
+	_, err = s.Login(context.TODO(), "alice", "password")
+	require.NoError(t, err)
+}
+
+func TestQuotas(t *testing.T) {
+	store := ms.NewMapStorage()
+	s := newStorage(store, link.RandomGenerator{}, &config.Config{
+		QuotaLinks:       4,
+		QuotaLinksPerDay: 3,
+		QuotaBatchSize:   2,
+	}, logger.NewNop())
+	defer s.Close()
+
+	batch := func(urls ...string) []*BatchItem {
+		var items []*BatchItem
+		for i, u := range urls {
+			items = append(items, &BatchItem{CorrelationID: strconv.Itoa(i), OriginalURL: u})
+		}
+		return items
+	}
+
+	err := s.SaveLinksBatch(context.TODO(), "alice",
+		batch("https://a.example.com", "https://b.example.com", "https://c.example.com"))
+	require.ErrorIs(t, err, ierror.ErrBatchQuota)
+
+	require.NoError(t, s.SaveLinksBatch(context.TODO(), "alice",
+		batch("https://a.example.com", "https://b.example.com")))
+
+	_, err = s.SaveLink(context.TODO(), "alice", "https://a.example.com")
+	require.ErrorIs(t, err, ierror.ErrDuplicate)
+
+	_, err = s.SaveLink(context.TODO(), "alice", "https://c.example.com")
+	require.NoError(t, err)
+
+	_, err = s.SaveLink(context.TODO(), "alice", "https://d.example.com")
+	require.ErrorIs(t, err, ierror.ErrDailyQuota)
+	require.ErrorIs(t, err, ierror.ErrQuotaExceeded)
+
+	usage, err := s.GetUsage(context.TODO(), "alice")
+	require.NoError(t, err)
+	assert.Equal(t, 3, usage.Links)
+	assert.Equal(t, 3, usage.LinksToday, "a duplicate must not count against the daily quota")
+	assert.Equal(t, 4, usage.MaxLinks)
+	assert.Equal(t, 3, usage.MaxLinksPerDay)
+	assert.Equal(t, 2, usage.MaxBatchSize)
+	assert.True(t, usage.ResetsAt.After(time.Now()))
+
+	_, err = store.AddDailyUsage(context.TODO(), "alice", time.Now(), -3, 0)
+	require.NoError(t, err)
+	err = s.SaveLinksBatch(context.TODO(), "alice", batch("https://d.example.com", "https://e.example.com"))
+	require.ErrorIs(t, err, ierror.ErrLinksQuota)
+
+	_, err = s.SaveLink(context.TODO(), "bob", "https://d.example.com")
+	require.NoError(t, err, "quotas are per user")
+}
+
+func TestBatchQuotaDuplicates(t *testing.T) {
+	store := ms.NewMapStorage()
+	s := newStorage(store, link.RandomGenerator{}, &config.Config{QuotaLinksPerDay: 4}, logger.NewNop())
+	defer s.Close()
+
+	today := func() int {
+		used, err := store.GetDailyUsage(context.TODO(), "alice", time.Now())
+		require.NoError(t, err)
+		return used
+	}
+
+	items := []*BatchItem{
+		{CorrelationID: "1", OriginalURL: "https://a.example.com"},
+		{CorrelationID: "2", OriginalURL: "https://b.example.com"},
+		{CorrelationID: "3", OriginalURL: "https://b.example.com"},
+	}
+	require.NoError(t, s.SaveLinksBatch(context.TODO(), "alice", items))
+	assert.Equal(t, 2, today(), "a duplicate inside a batch must not count")
+
+	require.NoError(t, s.SaveLinksBatch(context.TODO(), "alice", items[:2]))
+	assert.Equal(t, 2, today(), "a resubmitted batch must not count")
+
+	require.NoError(t, s.SaveLinksBatch(context.TODO(), "alice", []*BatchItem{
+		{CorrelationID: "1", OriginalURL: "https://a.example.com"},
+		{CorrelationID: "2", OriginalURL: "https://c.example.com"},
+	}))
+	assert.Equal(t, 3, today())
+}
+
+func TestAnonymousQuotaByIP(t *testing.T) {
+	store := ms.NewMapStorage()
+	s := newStorage(store, link.RandomGenerator{}, &config.Config{QuotaLinksPerDay: 2}, logger.NewNop())
+	defer s.Close()
+
+	ctx := WithAnonymousIP(context.TODO(), "10.0.0.1")
+	_, err := s.SaveLink(ctx, "first cookie", "https://a.example.com")
+	require.NoError(t, err)
+	_, err = s.SaveLink(ctx, "second cookie", "https://b.example.com")
+	require.NoError(t, err)
+
+	_, err = s.SaveLink(ctx, "third cookie", "https://c.example.com")
+	require.ErrorIs(t, err, ierror.ErrDailyQuota, "a new cookie must not reset the quota of the IP")
+	used, err := store.GetDailyUsage(context.TODO(), "third cookie", time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 0, used, "a rejected link must not count against the user")
+
+	_, err = s.SaveLink(WithAnonymousIP(context.TODO(), "10.0.0.2"), "third cookie", "https://c.example.com")
+	require.NoError(t, err, "other IPs have their own quota")
+	_, err = s.SaveLink(context.TODO(), "account", "https://d.example.com")
+	require.NoError(t, err, "logged in users are not counted per IP")
+}
+
+func TestObservedStoreSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	s := newStorage(observe(ms.NewMapStorage(), "memory"), link.RandomGenerator{}, &config.Config{}, logger.NewNop())
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "request")
+	short, err := s.SaveLink(ctx, "owner", "https://example.com")
+	require.NoError(t, err)
+	_, err = s.GetLink(ctx, "owner", "missing")
+	require.ErrorIs(t, err, ierror.ErrNotFound)
+	parent.End()
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+
+	for _, name := range []string{"storage.SaveLink", "storage.GetLink"} {
+		require.Contains(t, spans, name)
+		assert.Equal(t, parent.SpanContext().SpanID(), spans[name].Parent().SpanID())
+		assert.Contains(t, spans[name].Attributes(), attribute.String("storage.backend", "memory"))
+	}
+	// A missing link is an answer, not a failure of the store.
+	assert.Equal(t, codes.Unset, spans["storage.GetLink"].Status().Code)
+	assert.NotEmpty(t, short)
+}
+
+func TestHealthChecks(t *testing.T) {
+	s := newStorage(observe(ms.NewMapStorage(), "memory"), link.RandomGenerator{},
+		&config.Config{ReaperInterval: time.Minute}, logger.NewNop())
+
+	run := func() map[string]error {
+		res := make(map[string]error)
+		for _, check := range s.HealthChecks() {
+			res[check.Name] = check.Run(context.Background())
+		}
+		return res
+	}
+
+	assert.Equal(t, map[string]error{"storage": nil, "workers": nil}, run())
+
+	require.NoError(t, s.Close())
+	err := run()["workers"]
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "delete batcher: stopped")
+	assert.ErrorContains(t, err, "reaper: stopped")
+}
+
+func TestHeartbeat(t *testing.T) {
+	now := time.Now()
+	var h heartbeat
+	h.beat(now)
+
+	assert.NoError(t, h.check(now.Add(2*time.Second), time.Second))
+	assert.ErrorContains(t, h.check(now.Add(5*time.Second), time.Second), "no progress for 5s")
+
+	h.stop()
+	assert.ErrorContains(t, h.check(now, time.Second), "stopped")
+}
+
+func TestBatcherFullQueue(t *testing.T) {
+	release := make(chan struct{})
+	flush := func(context.Context, []int) error {
+		<-release
+		return nil
+	}
+	items := make([]int, batchSize+queueSize+10)
+
+	drop := newBatcher("test", flush, dropWhenFull, logger.NewNop())
+	assert.NoError(t, drop.enqueue(context.TODO(), items...), "a full queue must drop items without waiting")
+
+	block := newBatcher("test", flush, blockWhenFull, logger.NewNop())
+	ctx, cancel := context.WithTimeout(context.TODO(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, block.enqueue(ctx, items...), context.DeadlineExceeded)
+
+	close(release)
+	drop.close()
+	block.close()
+}
+
+func TestIPHashKey(t *testing.T) {
+	s, err := Create(&config.Config{ShortCodeGenerator: "random", UniqueOriginals: "global"}, logger.NewNop())
+	require.NoError(t, err)
+	defer s.Close()
+
+	generated := s.(*Storage).ipHashes.Hash("10.0.0.1")
+	key, err := s.(*Storage).Secret(context.TODO(), ipHashSecret)
+	require.NoError(t, err)
+	assert.Equal(t, click.NewIPHasher(key).Hash("10.0.0.1"), generated, "the generated key must be kept")
+
+	s, err = Create(&config.Config{ShortCodeGenerator: "random", UniqueOriginals: "global",
+		IPHashKey: "pepper"}, logger.NewNop())
+	require.NoError(t, err)
+	defer s.Close()
+	assert.Equal(t, click.NewIPHasher([]byte("pepper")).Hash("10.0.0.1"), s.(*Storage).ipHashes.Hash("10.0.0.1"))
+}
@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/MomsEngineer/urlshortener/internal/adapters/logger"
+	"github.com/MomsEngineer/urlshortener/internal/entities/user"
+	ierror "github.com/MomsEngineer/urlshortener/internal/errors"
+)
+
+// Register creates an account. The links and API keys of the anonymous
+// cookie user, if any, are handed over to it in the same write, so a
+// failed registration can be retried with the same login.
+func (s *Storage) Register(ctx context.Context, anonymousID, login,
+	password string) (*user.User, error) {
+	u, err := user.NewUser(login, password)
+	if err != nil {
+		s.log.Debug(ctx, "Failed to create user", logger.Err(err))
+		return nil, err
+	}
+	if s.isAdminLogin(u.Login) {
+		u.Role = user.RoleAdmin
+	}
+
+	if err := s.store.SaveUser(ctx, u, anonymousID); err != nil {
+		if errors.Is(err, ierror.ErrDuplicate) {
+			return nil, fmt.Errorf("%w: login %q is taken", ierror.ErrDuplicate, u.Login)
+		}
+		s.log.Error(ctx, "Failed to save user", err)
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// Login checks the password of the account, a wrong login and a wrong
+// password are reported alike.
+func (s *Storage) Login(ctx context.Context, login, password string) (*user.User, error) {
+	u, err := s.store.GetUserByLogin(ctx, user.NormalizeLogin(login))
+	if errors.Is(err, ierror.ErrNotFound) {
+		return nil, fmt.Errorf("%w: wrong login or password", ierror.ErrUnauthorized)
+	} else if err != nil {
+		s.log.Error(ctx, "Failed to get user", err)
+		return nil, err
+	}
+
+	if !u.CheckPassword(password) {
+		return nil, fmt.Errorf("%w: wrong login or password", ierror.ErrUnauthorized)
+	}
+
+	if err := s.checkBan(ctx, u.ID); err != nil {
+		return nil, err
+	}
+
+	if s.isAdminLogin(u.Login) {
+		u.Role = user.RoleAdmin
+	}
+
+	return u, nil
+}
+
+// UserRole returns the current role of the account, so a changed role
+// applies to the next request.
+func (s *Storage) UserRole(ctx context.Context, userID string) (user.Role, error) {
+	u, err := s.store.GetUserByID(ctx, userID)
+	if err != nil {
+		if !errors.Is(err, ierror.ErrNotFound) {
+			s.log.Error(ctx, "Failed to get user", err)
+		}
+		return "", err
+	}
+
+	if s.isAdminLogin(u.Login) {
+		return user.RoleAdmin, nil
+	}
+
+	return u.Role, nil
+}
+
+// parseLogins parses the comma separated logins of the configured
+// admins, who get the admin role whatever role is stored. They cannot
+// be demoted, remove them from ADMIN_LOGINS instead.
+func parseLogins(s string) map[string]struct{} {
+	logins := make(map[string]struct{})
+	for _, login := range strings.Split(s, ",") {
+		if login = user.NormalizeLogin(login); login != "" {
+			logins[login] = struct{}{}
+		}
+	}
+
+	return logins
+}
+
+func (s *Storage) isAdminLogin(login string) bool {
+	_, ok := s.admins[login]
+	return ok
+}
@@ -0,0 +1,3 @@
+-- +migrate Down
+ALTER TABLE links
+DROP COLUMN is_deleted;
\ No newline at end of file
@@ -0,0 +1,3 @@
+-- +migrate Up
+ALTER TABLE links
+ADD COLUMN is_deleted BOOLEAN NOT NULL DEFAULT FALSE;
\ No newline at end of file
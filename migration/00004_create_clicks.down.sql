@@ -0,0 +1,2 @@
+-- +migrate Down
+DROP TABLE IF EXISTS clicks;
\ No newline at end of file
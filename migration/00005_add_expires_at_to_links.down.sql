@@ -0,0 +1,5 @@
+-- +migrate Down
+DROP INDEX IF EXISTS links_expires_at_idx;
+
+ALTER TABLE links
+DROP COLUMN expires_at;
\ No newline at end of file
@@ -0,0 +1,6 @@
+-- +migrate Up
+ALTER TABLE links
+ADD COLUMN expires_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS links_expires_at_idx ON links (expires_at)
+WHERE expires_at IS NOT NULL AND is_deleted = FALSE;
\ No newline at end of file
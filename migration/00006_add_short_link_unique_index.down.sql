@@ -0,0 +1,2 @@
+-- +migrate Down
+DROP INDEX IF EXISTS links_short_link_idx;
\ No newline at end of file
@@ -0,0 +1,2 @@
+-- +migrate Up
+CREATE UNIQUE INDEX IF NOT EXISTS links_short_link_idx ON links (short_link);
\ No newline at end of file
@@ -0,0 +1,13 @@
+-- +migrate Down
+DROP INDEX IF EXISTS links_user_original_link_idx;
+
+-- The global constraint allows a single row per original URL. The live
+-- and then the oldest link of each URL is kept, the other links of the
+-- URL are removed together with their codes.
+DELETE FROM links l
+USING links keep
+WHERE keep.original_link = l.original_link
+  AND (keep.is_deleted, keep.id) < (l.is_deleted, l.id);
+
+ALTER TABLE links
+ADD CONSTRAINT links_original_link_key UNIQUE (original_link);
\ No newline at end of file
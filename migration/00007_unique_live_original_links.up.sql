@@ -0,0 +1,6 @@
+-- +migrate Up
+ALTER TABLE links
+DROP CONSTRAINT IF EXISTS links_original_link_key;
+
+CREATE UNIQUE INDEX IF NOT EXISTS links_user_original_link_idx ON links (user_id, original_link)
+WHERE is_deleted = FALSE;
\ No newline at end of file
@@ -0,0 +1,8 @@
+-- +migrate Down
+DROP TABLE IF EXISTS banned_users;
+
+ALTER TABLE users
+DROP COLUMN role;
+
+ALTER TABLE links
+DROP COLUMN is_disabled;
\ No newline at end of file
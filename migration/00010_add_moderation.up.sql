@@ -0,0 +1,12 @@
+-- +migrate Up
+ALTER TABLE links
+ADD COLUMN is_disabled BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE users
+ADD COLUMN role VARCHAR(16) NOT NULL DEFAULT 'user';
+
+CREATE TABLE IF NOT EXISTS banned_users (
+    user_id VARCHAR(255) PRIMARY KEY,
+    reason TEXT NOT NULL DEFAULT '',
+    banned_at TIMESTAMPTZ NOT NULL
+);
\ No newline at end of file
@@ -0,0 +1,2 @@
+-- +migrate Down
+DROP TABLE IF EXISTS rate_limits;
\ No newline at end of file
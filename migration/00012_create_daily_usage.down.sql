@@ -0,0 +1,2 @@
+-- +migrate Down
+DROP TABLE IF EXISTS daily_usage;
\ No newline at end of file
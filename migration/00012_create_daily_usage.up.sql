@@ -0,0 +1,7 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS daily_usage (
+    user_id VARCHAR(255) NOT NULL,
+    day DATE NOT NULL,
+    links INTEGER NOT NULL,
+    PRIMARY KEY (user_id, day)
+);
\ No newline at end of file
@@ -0,0 +1,2 @@
+-- +migrate Down
+DROP TABLE IF EXISTS secrets;
\ No newline at end of file
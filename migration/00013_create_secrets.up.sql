@@ -0,0 +1,5 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS secrets (
+    name VARCHAR(64) PRIMARY KEY,
+    value BYTEA NOT NULL
+);
\ No newline at end of file